@@ -0,0 +1,184 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HandleAccept registers a new request handle with the given path and method,
+// like Handle, which only handles requests accepting the given media type,
+// e.g. application/json, according to their Accept header.
+// Several handles with different media types can be registered for the same
+// method and path. Of the media types acceptable for a request, the one with
+// the highest quality value (q) is chosen, the first one in registration
+// order if several have the same. A media range like text/* or */* matches
+// all media types it covers, the most specific range matching a media type
+// determines its quality. A request without Accept header accepts any media
+// type.
+// A handle registered for the method and path with Handle (or any other way)
+// handles the requests accepting none of the media types. It must be
+// registered after the first HandleAccept call for the path, otherwise
+// HandleAccept panics since the path is already registered. Without it such
+// requests are answered with 406 Not Acceptable.
+// The responses of all these handles get the header Vary: Accept.
+// HandleAccept panics if the media type is not of the form type/subtype or
+// contains a wildcard.
+func (r *Router) HandleAccept(method, path, mediaType string, handle Handle) {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	i := strings.IndexByte(mediaType, '/')
+	if i <= 0 || i == len(mediaType)-1 || strings.ContainsAny(mediaType, "*;, ") ||
+		strings.IndexByte(mediaType[i+1:], '/') >= 0 {
+		panic("invalid media type '" + mediaType + "' in path '" + path + "'")
+	}
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+
+	id := method + " " + path
+	if ar := r.loadTrees().accepts[id]; ar != nil {
+		for _, t := range ar.mediaTypes {
+			if t == mediaType {
+				panic("a handle is already registered for media type '" + mediaType +
+					"' in path '" + path + "'")
+			}
+		}
+		ar.mediaTypes = append(ar.mediaTypes, mediaType)
+		ar.handles = append(ar.handles, handle)
+		return
+	}
+
+	ar := &acceptRoute{r: r, id: id, mediaTypes: []string{mediaType}, handles: []Handle{handle}}
+	r.Handle(method, path, ar.serve)
+	t := r.writableTrees()
+	if t.accepts == nil {
+		t.accepts = make(map[string]*acceptRoute)
+	}
+	t.accepts[id] = ar
+}
+
+// HandleAccept registers a new request handle with the given method and the
+// path prefixed by the group prefix, which only handles requests accepting
+// the given media type. The handle is wrapped by the middleware of the group.
+// See Router.HandleAccept.
+func (g *Group) HandleAccept(method, path, mediaType string, handle Handle) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g.r.HandleAccept(method, g.prefix+path, mediaType, g.wrap(handle))
+}
+
+// The routes registered with HandleAccept for a method and path. Like for
+// queryRoute, the handle in the tree serves with the one in the current trees.
+type acceptRoute struct {
+	r          *Router
+	id         string // method and path
+	mediaTypes []string
+	handles    []Handle
+
+	// Handle of the route registered without media type, if any
+	fallback Handle
+}
+
+func (ar *acceptRoute) serve(w http.ResponseWriter, req *http.Request, ps Params) {
+	if current := ar.r.loadTrees().accepts[ar.id]; current != nil {
+		ar = current
+	}
+	w.Header().Add("Vary", "Accept")
+	if i := negotiate(req.Header.Get("Accept"), ar.mediaTypes); i >= 0 {
+		ar.handles[i](w, req, ps)
+		return
+	}
+	if ar.fallback != nil {
+		ar.fallback(w, req, ps)
+		return
+	}
+	http.Error(w,
+		http.StatusText(http.StatusNotAcceptable),
+		http.StatusNotAcceptable,
+	)
+}
+
+// Returns the index of the media type preferred by the Accept header accept,
+// or -1 if none of them is acceptable.
+func negotiate(accept string, mediaTypes []string) int {
+	if strings.TrimSpace(accept) == "" {
+		return 0
+	}
+	best, bestQ := -1, 0.0
+	for i, mediaType := range mediaTypes {
+		if q := acceptQuality(accept, mediaType); q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// Returns the quality value the Accept header accept assigns to the media
+// type, which is that of the most specific matching media range. Media
+// ranges with an invalid quality value are ignored.
+func acceptQuality(accept, mediaType string) float64 {
+	slash := strings.IndexByte(mediaType, '/')
+	q, specificity := 0.0, 0
+	for accept != "" {
+		var rng string
+		if i := strings.IndexByte(accept, ','); i >= 0 {
+			rng, accept = accept[:i], accept[i+1:]
+		} else {
+			rng, accept = accept, ""
+		}
+
+		rngQ := 1.0
+		if i := strings.IndexByte(rng, ';'); i >= 0 {
+			var ok bool
+			if rngQ, ok = parseQuality(rng[i+1:]); !ok {
+				continue
+			}
+			rng = rng[:i]
+		}
+		rng = strings.ToLower(strings.TrimSpace(rng))
+
+		var s int
+		switch {
+		case rng == mediaType:
+			s = 3
+		case rng == mediaType[:slash]+"/*":
+			s = 2
+		case rng == "*/*":
+			s = 1
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = rngQ, s
+		}
+	}
+	return q
+}
+
+// Returns the value of the q parameter in the parameters of a media range,
+// or 1 if there is none. Reports false if the value is invalid.
+func parseQuality(params string) (float64, bool) {
+	for params != "" {
+		var param string
+		if i := strings.IndexByte(params, ';'); i >= 0 {
+			param, params = params[:i], params[i+1:]
+		} else {
+			param, params = params, ""
+		}
+		param = strings.TrimSpace(param)
+		if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+			continue
+		}
+		q, err := strconv.ParseFloat(param[2:], 64)
+		if err != nil || q < 0 || q > 1 {
+			return 0, false
+		}
+		return q, true
+	}
+	return 1, true
+}
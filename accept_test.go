@@ -0,0 +1,124 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterHandleAccept(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("id")
+		}
+	}
+
+	router := New()
+	router.HandleAccept(http.MethodGet, "/report", "application/json", handle("json"))
+	router.HandleAccept(http.MethodGet, "/report", "text/html", handle("html"))
+	router.HandleAccept(http.MethodGet, "/users/:id", "Application/JSON", handle("json"))
+	router.GET("/users/:id", handle("plain"))
+	router.Group("/api").HandleAccept(http.MethodGet, "/items", "text/csv", handle("csv"))
+
+	tests := []struct {
+		path   string
+		accept string
+		routed string
+		code   int
+	}{
+		{"/report", "", "json", http.StatusOK},
+		{"/report", "application/json", "json", http.StatusOK},
+		{"/report", "text/html", "html", http.StatusOK},
+		{"/report", "TEXT/HTML", "html", http.StatusOK},
+		{"/report", "text/html;q=0.5, application/json;q=0.9", "json", http.StatusOK},
+		{"/report", "application/json;q=0.5, text/html", "html", http.StatusOK},
+		{"/report", "application/json, text/html", "json", http.StatusOK},
+		{"/report", "text/*", "html", http.StatusOK},
+		{"/report", "*/*", "json", http.StatusOK},
+		{"/report", "*/*;q=0.1, text/html;level=1;q=0.2", "html", http.StatusOK},
+		{"/report", "text/*;q=0.8, */*;q=0.9", "json", http.StatusOK},
+		{"/report", "application/json;q=0, */*", "html", http.StatusOK},
+		{"/report", "application/json;q=2, text/html;q=0.1", "html", http.StatusOK},
+		{"/report", "image/png", "", http.StatusNotAcceptable},
+		{"/report", "*/*;q=0", "", http.StatusNotAcceptable},
+		{"/users/1", "application/json", "json1", http.StatusOK},
+		{"/users/2", "image/png", "plain2", http.StatusOK},
+		{"/api/items", "text/csv", "csv", http.StatusOK},
+		{"/api/items", "text/html", "", http.StatusNotAcceptable},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		router.ServeHTTP(w, r)
+		if routed != test.routed || w.Code != test.code {
+			t.Errorf("%s with Accept %q: routed to %q with code %d, want %q with code %d",
+				test.path, test.accept, routed, w.Code, test.routed, test.code)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("%s with Accept %q: Vary=%q, want Accept", test.path, test.accept, vary)
+		}
+	}
+}
+
+func TestRouterHandleAcceptInvalid(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.HandleAccept(http.MethodGet, "/report", "text/html", handle)
+	router.GET("/plain", handle)
+
+	for name, register := range map[string]func(){
+		"no subtype":     func() { router.HandleAccept(http.MethodGet, "/report", "text", handle) },
+		"empty subtype":  func() { router.HandleAccept(http.MethodGet, "/report", "text/", handle) },
+		"wildcard":       func() { router.HandleAccept(http.MethodGet, "/report", "text/*", handle) },
+		"parameters":     func() { router.HandleAccept(http.MethodGet, "/report", "text/csv;q=1", handle) },
+		"nil handle":     func() { router.HandleAccept(http.MethodGet, "/report", "text/csv", nil) },
+		"duplicate type": func() { router.HandleAccept(http.MethodGet, "/report", "TEXT/HTML", handle) },
+		"after plain":    func() { router.HandleAccept(http.MethodGet, "/plain", "text/html", handle) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Errorf("%s: no panic", name)
+		}
+	}
+}
+
+func TestRouterHandleAcceptQuery(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	// Accept routes fall back to query routes, which fall back to the route
+	// registered last
+	router := New()
+	router.HandleAccept(http.MethodGet, "/search", "text/html", handle("html"))
+	router.HandleQuery(http.MethodGet, "/search", "q", handle("query"))
+	router.GET("/search", handle("plain"))
+
+	tests := []struct {
+		url, accept, routed string
+	}{
+		{"/search?q=go", "text/html", "html"},
+		{"/search?q=go", "application/json", "query"},
+		{"/search", "application/json", "plain"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		r.Header.Set("Accept", test.accept)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != test.routed {
+			t.Errorf("%s with Accept %q: routed to %q, want %q", test.url, test.accept, routed, test.routed)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// BindParams stores the values of the Params in the fields of the struct dst
+// points to. The Param bound to a field is named by the param key of the
+// field tag, e.g.
+//
+//	type UserPost struct {
+//		User string `param:"user,required"`
+//		ID   int    `param:"id"`
+//	}
+//
+// Fields without the tag are skipped, as are Params without a field. The
+// fields of embedded structs are bound as if they were fields of dst. A nil
+// embedded pointer is allocated if one of its fields is bound, unless its type
+// is unexported.
+//
+// Fields of type string, bool, int, uint and float (of any size) are
+// supported, as are types implementing encoding.TextUnmarshaler, e.g. UUID
+// types, and pointers to any of these, which are allocated if the Param
+// exists. Values are converted like by the typed accessors of Params, e.g.
+// Params.ParamInt.
+// If a Param with the option required does not exist or a value can not be
+// converted, a *ParamError is returned for the first such field. The fields
+// bound before remain set.
+// BindParams panics if dst is not a non-nil pointer to a struct, if a tag has
+// an unknown option or belongs to an unexported field, or if a Param is bound
+// to a field of an unsupported type.
+func BindParams(ps Params, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic("BindParams requires a non-nil pointer to a struct, got " + v.Kind().String())
+	}
+	_, err := bindStruct(ps, v.Elem())
+	return err
+}
+
+// Binds the Params to the fields of the struct v. Reports whether a field was
+// set.
+func bindStruct(ps Params, v reflect.Value) (bound bool, err error) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("param")
+		if !ok {
+			if field.Anonymous {
+				ok, err := bindEmbedded(ps, v.Field(i))
+				bound = bound || ok
+				if err != nil {
+					return bound, err
+				}
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			panic("BindParams can not set unexported field " + t.Name() + "." + field.Name)
+		}
+
+		name, required := tag, false
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			if tag[j+1:] != "required" {
+				panic("unknown option '" + tag[j+1:] + "' in param tag of field " + t.Name() + "." + field.Name)
+			}
+			name, required = tag[:j], true
+		}
+		value, ok := ps.get(name)
+		if !ok {
+			if required {
+				return bound, paramError(name, value, ErrParamNotFound)
+			}
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return bound, paramError(name, value, err)
+		}
+		bound = true
+	}
+	return bound, nil
+}
+
+// Binds the fields of an embedded struct or pointer to a struct without a
+// param tag.
+func bindEmbedded(ps Params, v reflect.Value) (bool, error) {
+	switch {
+	case v.Kind() == reflect.Struct:
+		return bindStruct(ps, v)
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if !v.IsNil() {
+			return bindStruct(ps, v.Elem())
+		}
+		if !v.CanSet() {
+			// Pointer to an unexported struct type
+			return false, nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		bound, err := bindStruct(ps, elem.Elem())
+		if bound {
+			v.Set(elem)
+		}
+		return bound, err
+	}
+	return false, nil
+}
+
+// Converts the value to the type of the field and sets it.
+func setField(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		elem := reflect.New(v.Type().Elem())
+		if err := setField(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		panic("BindParams does not support fields of type " + v.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Minimal UUID type in its canonical text form
+type testUUID [16]byte
+
+func (u *testUUID) UnmarshalText(text []byte) error {
+	if len(text) != 36 {
+		return errors.New("invalid UUID length")
+	}
+	j := 0
+	for i := 0; i < 36; i += 2 {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if text[i] != '-' {
+				return errors.New("invalid UUID format")
+			}
+			i--
+			continue
+		}
+		b, err := strconv.ParseUint(string(text[i:i+2]), 16, 8)
+		if err != nil {
+			return errors.New("invalid UUID format")
+		}
+		u[j] = byte(b)
+		j++
+	}
+	return nil
+}
+
+type bindPage struct {
+	Page  uint16 `param:"page"`
+	Draft *bool  `param:"draft"`
+}
+
+type BindOwner struct {
+	Owner string `param:"owner"`
+}
+
+type bindTarget struct {
+	bindPage
+	*BindOwner
+	User  string   `param:"user,required"`
+	ID    int64    `param:"id"`
+	Score float32  `param:"score"`
+	Ref   *int     `param:"ref"`
+	UUID  testUUID `param:"uuid"`
+	Skip  string
+}
+
+func TestBindParams(t *testing.T) {
+	ps := Params{
+		{"user", "gopher"},
+		{"id", "-42"},
+		{"score", "0.5"},
+		{"uuid", "01234567-89ab-cdef-0123-456789abcdef"},
+		{"page", "3"},
+		{"draft", "true"},
+		{"owner", "julien"},
+		{"Skip", "x"},
+		{MatchedRoutePathParam, "/:user"},
+	}
+	var dst bindTarget
+	if err := BindParams(ps, &dst); err != nil {
+		t.Fatalf("BindParams failed: %v", err)
+	}
+	draft := true
+	want := bindTarget{
+		bindPage:  bindPage{Page: 3, Draft: &draft},
+		BindOwner: &BindOwner{Owner: "julien"},
+		User:      "gopher",
+		ID:        -42,
+		Score:     0.5,
+		UUID: testUUID{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef,
+			0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("got %+v, want %+v", dst, want)
+	}
+
+	// Missing optional params keep the zero value, embedded pointers are not
+	// allocated if none of their fields is bound
+	dst = bindTarget{}
+	if err := BindParams(Params{{"user", "gopher"}}, &dst); err != nil {
+		t.Fatalf("BindParams failed: %v", err)
+	}
+	if dst.User != "gopher" || dst.Ref != nil || dst.BindOwner != nil || dst.Draft != nil {
+		t.Errorf("unexpected result %+v", dst)
+	}
+}
+
+func TestBindParamsErrors(t *testing.T) {
+	tests := []struct {
+		ps    Params
+		name  string
+		value string
+		err   error
+	}{
+		{Params{}, "user", "", ErrParamNotFound},
+		{Params{{"user", "a"}, {"id", "x"}}, "id", "x", strconv.ErrSyntax},
+		{Params{{"user", "a"}, {"page", "70000"}}, "page", "70000", strconv.ErrRange},
+		{Params{{"user", "a"}, {"draft", "maybe"}}, "draft", "maybe", strconv.ErrSyntax},
+		{Params{{"user", "a"}, {"ref", "1.5"}}, "ref", "1.5", strconv.ErrSyntax},
+		{Params{{"user", "a"}, {"score", "high"}}, "score", "high", strconv.ErrSyntax},
+		{Params{{"user", "a"}, {"uuid", "0123"}}, "uuid", "0123", nil},
+	}
+	for _, test := range tests {
+		var dst bindTarget
+		err := BindParams(test.ps, &dst)
+		pe, ok := err.(*ParamError)
+		if !ok {
+			t.Errorf("%v: got %v, want *ParamError", test.ps, err)
+			continue
+		}
+		if pe.Name != test.name || pe.Value != test.value || (test.err != nil && pe.Err != test.err) {
+			t.Errorf("%v: unexpected error %#v", test.ps, pe)
+		}
+	}
+}
+
+func TestBindParamsInvalid(t *testing.T) {
+	ps := Params{{"id", "1"}}
+	var unsupported struct {
+		ID []int `param:"id"`
+	}
+	var unexported struct {
+		id int `param:"id"`
+	}
+	var option struct {
+		ID int `param:"id,optional"`
+	}
+	var nilPtr *bindTarget
+
+	for name, dst := range map[string]interface{}{
+		"non-pointer":      bindTarget{},
+		"nil pointer":      nilPtr,
+		"non-struct":       new(int),
+		"nil":              nil,
+		"unsupported type": &unsupported,
+		"unexported field": &unexported,
+		"unknown option":   &option,
+	} {
+		if recv := catchPanic(func() { BindParams(ps, dst) }); recv == nil {
+			t.Errorf("%s: no panic", name)
+		}
+	}
+	_ = unexported.id
+}
@@ -0,0 +1,71 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS headers of automatic replies to preflight
+// requests, see Router.CORS.
+type CORSConfig struct {
+	// Origins which are allowed to make cross-origin requests, e.g.
+	// "https://example.com". The origin "*" allows all origins.
+	AllowedOrigins []string
+
+	// Request headers which are allowed in cross-origin requests.
+	AllowedHeaders []string
+
+	// If enabled, cross-origin requests may include credentials like cookies.
+	// The origin of the request is then sent back instead of "*".
+	AllowCredentials bool
+
+	// How long the results of a preflight request may be cached.
+	// Not sent if 0.
+	MaxAge time.Duration
+}
+
+// Sets the CORS headers for a preflight request allowing the given methods.
+// No headers are set if the origin of the request is not allowed.
+func (c *CORSConfig) setPreflightHeaders(header http.Header, req *http.Request, allow string) {
+	origin := req.Header.Get("Origin")
+	if origin == "" || req.Header.Get("Access-Control-Request-Method") == "" {
+		// Not a preflight request
+		return
+	}
+
+	allowOrigin := ""
+	for _, o := range c.AllowedOrigins {
+		if o == "*" && !c.AllowCredentials {
+			allowOrigin = "*"
+			break
+		}
+		if o == "*" || o == origin {
+			allowOrigin = origin
+			break
+		}
+	}
+	if allowOrigin == "" {
+		return
+	}
+
+	if allowOrigin != "*" {
+		header.Add("Vary", "Origin")
+	}
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	header.Set("Access-Control-Allow-Methods", allow)
+	if len(c.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(c.AllowedHeaders, ", "))
+	}
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+}
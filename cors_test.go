@@ -0,0 +1,96 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterCORS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.POST("/path", handlerFunc)
+	router.CORS = &CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Content-Type", "X-Token"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	preflight := func(path, origin string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(http.MethodOptions, path, nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("/path", "https://example.com")
+	want := map[string]string{
+		"Allow":                            "GET, POST, OPTIONS",
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Methods":     "GET, POST, OPTIONS",
+		"Access-Control-Allow-Headers":     "Content-Type, X-Token",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Credentials": "",
+		"Vary":                             "Origin",
+	}
+	for key, value := range want {
+		if got := w.Header().Get(key); got != value {
+			t.Errorf("header %s: got %q, want %q", key, got, value)
+		}
+	}
+
+	// Unknown origin
+	w = preflight("/path", "https://evil.com")
+	if w.Header().Get("Allow") == "" || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unexpected headers for disallowed origin: %v", w.Header())
+	}
+
+	// Plain OPTIONS request
+	w = preflight("/path", "")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("CORS headers set for non-preflight request: %v", w.Header())
+	}
+
+	// Path without handles
+	w = preflight("/nope", "https://example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("CORS headers set for unknown path: %v", w.Header())
+	}
+
+	// All origins
+	router.CORS.AllowedOrigins = []string{"*"}
+	w = preflight("/path", "https://other.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("wildcard origin: got %q", got)
+	}
+	router.CORS.AllowCredentials = true
+	w = preflight("/path", "https://other.com")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://other.com" {
+		t.Errorf("wildcard origin with credentials: got %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("credentials: got %q", got)
+	}
+
+	// GlobalOPTIONS is still called and can override the headers
+	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Max-Age", "1")
+		w.WriteHeader(http.StatusNoContent)
+	})
+	w = preflight("/path", "https://other.com")
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Max-Age") != "1" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "GET, POST, OPTIONS" {
+		t.Errorf("GlobalOPTIONS with CORS failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
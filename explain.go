@@ -0,0 +1,155 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Explain returns a description of how the router looks up the path for the
+// method, e.g. to find out why a request matches a surprising route. For
+// each searched tree (see MethodWildcard and AutoHEAD) it lists the static,
+// param and catch-all nodes the path is matched against, followed by the
+// route found, if any:
+//
+//	tree GET
+//	  static "/users/" matches
+//	  param :id matches "42"
+//	  static "/posts" matches
+//	  found route /users/:id/posts
+//
+// Since a static segment and a wildcard never share the same position, at
+// most one child node continues the path at each node, there are no ties
+// to break.
+// The path is looked up as given, i.e. it is neither cleaned nor are
+// trailing slashes and multiple slashes fixed like by ServeHTTP. Explain is
+// slow and only meant for debugging, the output may change between
+// versions.
+func (r *Router) Explain(method, path string) string {
+	trees := r.loadTrees().trees
+	methods := []string{method}
+	switch {
+	case method == MethodWildcard:
+	case method == http.MethodHead && r.AutoHEAD:
+		methods = append(methods, http.MethodGet, MethodWildcard)
+	default:
+		methods = append(methods, MethodWildcard)
+	}
+
+	var buf []byte
+	trace := func(format string, a ...interface{}) {
+		buf = append(buf, "  "...)
+		buf = append(buf, fmt.Sprintf(format, a...)...)
+		buf = append(buf, '\n')
+	}
+	searched := false
+	for _, m := range methods {
+		root := trees[m]
+		if root == nil {
+			continue
+		}
+		searched = true
+		buf = append(buf, "tree "+m+"\n"...)
+		root.explain(path, r.CaseInsensitive, trace)
+
+		handle, _, tsr, fullPath := root.getValue(path, nil, r.CaseInsensitive)
+		if handle != nil {
+			trace("found route %s", fullPath)
+			return string(buf)
+		}
+		if tsr {
+			trace("no route found, but one for the path with (without) trailing slash")
+		} else {
+			trace("no route found")
+		}
+	}
+	if !searched {
+		buf = append(buf, "no routes registered for method "+method+"\n"...)
+	}
+	return string(buf)
+}
+
+// Walks down the subtree like getValue and reports each decision to trace.
+func (n *node) explain(path string, foldCase bool, trace func(format string, a ...interface{})) {
+	for {
+		prefix := n.path
+		if len(path) < len(prefix) || !equalPath(path[:len(prefix)], prefix, foldCase) {
+			trace("static %q does not match %q", prefix, path)
+			return
+		}
+		if prefix != "" {
+			trace("static %q matches", prefix)
+		}
+		path = path[len(prefix):]
+		if path == "" {
+			if n.handle == nil {
+				trace("no route ends at static %q", prefix)
+			}
+			return
+		}
+
+		if !n.wildChild {
+			c := path[0]
+			if foldCase {
+				c = toLowerASCII(c)
+			}
+			i := strings.IndexByte(n.indices, c)
+			if i < 0 {
+				trace("no static child continues with %q", path)
+				return
+			}
+			n = n.children[i]
+			continue
+		}
+
+		n = n.children[0]
+		switch n.nType {
+		case param:
+			end := strings.IndexByte(path, '/')
+			if end < 0 {
+				end = len(path)
+			}
+			if n.constraint != nil && !n.constraint.MatchString(path[:end]) {
+				trace("param %s does not match %q, the constraint is not satisfied", n.path, path[:end])
+				return
+			}
+			trace("param %s matches %q", n.path, path[:end])
+			path = path[end:]
+			if path == "" {
+				if n.handle == nil {
+					trace("no route ends at param %s", n.path)
+				}
+				return
+			}
+			if len(n.children) == 0 {
+				trace("no route continues after param %s with %q", n.path, path)
+				return
+			}
+			n = n.children[0]
+
+		case catchAll:
+			name := n.path[1:]
+			if n.suffix != "" {
+				end := len(path) - len(n.suffix)
+				if end < 1 || !equalPath(path[end:], n.suffix, foldCase) {
+					trace("catch-all %s does not match %q, the suffix %q is missing", name, path, n.suffix)
+					return
+				}
+				path = path[:end]
+			}
+			if n.constraint != nil && !n.constraint.MatchString(path) {
+				trace("catch-all %s does not match %q, the constraint is not satisfied", name, path)
+				return
+			}
+			trace("catch-all %s matches %q", name, path)
+			return
+
+		default:
+			panic("invalid node type")
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterExplain(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/users/:id(^[0-9]+$)/posts", handle)
+	router.GET("/users/:id(^[0-9]+$)", handle)
+	router.GET("/src/*path", handle)
+	router.GET("/proxy/*target/info", handle)
+	router.GET("/about/", handle)
+	// Overlaps with /users/:id, which wins for GET requests
+	router.Handle(MethodWildcard, "/users/admin", handle)
+
+	tests := []struct {
+		method, path, explanation string
+	}{
+		{http.MethodGet, "/users/42/posts", `tree GET
+  static "/" matches
+  static "users/" matches
+  param :id(^[0-9]+$) matches "42"
+  static "/posts" matches
+  found route /users/:id(^[0-9]+$)/posts
+`},
+		{http.MethodGet, "/users/admin", `tree GET
+  static "/" matches
+  static "users/" matches
+  param :id(^[0-9]+$) does not match "admin", the constraint is not satisfied
+  no route found
+tree *
+  static "/users/admin" matches
+  found route /users/admin
+`},
+		{http.MethodGet, "/src/a/b", `tree GET
+  static "/" matches
+  static "src" matches
+  catch-all *path matches "/a/b"
+  found route /src/*path
+`},
+		{http.MethodGet, "/proxy/a/b/info", `tree GET
+  static "/" matches
+  static "proxy" matches
+  catch-all *target matches "/a/b"
+  found route /proxy/*target/info
+`},
+		{http.MethodGet, "/proxy/a/b", `tree GET
+  static "/" matches
+  static "proxy" matches
+  catch-all *target does not match "/a/b", the suffix "/info" is missing
+  no route found
+tree *
+  static "/users/admin" does not match "/proxy/a/b"
+  no route found
+`},
+		{http.MethodGet, "/about", `tree GET
+  static "/" matches
+  static "about/" does not match "about"
+  no route found, but one for the path with (without) trailing slash
+tree *
+  static "/users/admin" does not match "/about"
+  no route found
+`},
+		{http.MethodGet, "/nope", `tree GET
+  static "/" matches
+  no static child continues with "nope"
+  no route found
+tree *
+  static "/users/admin" does not match "/nope"
+  no route found
+`},
+		{http.MethodPost, "/users/1", `tree *
+  static "/users/admin" does not match "/users/1"
+  no route found
+`},
+		{MethodWildcard, "/users/admin", `tree *
+  static "/users/admin" matches
+  found route /users/admin
+`},
+	}
+	for _, test := range tests {
+		if explanation := router.Explain(test.method, test.path); explanation != test.explanation {
+			t.Errorf("Explain(%q, %q) =\n%s\nwant\n%s", test.method, test.path, explanation, test.explanation)
+		}
+	}
+
+	if explanation := New().Explain(http.MethodGet, "/"); explanation != "no routes registered for method GET\n" {
+		t.Errorf("Explain without routes = %q", explanation)
+	}
+}
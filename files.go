@@ -0,0 +1,213 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ServeFilesWithFallback serves files from the given file system root, just
+// like ServeFiles. Requests for files which do not exist are handled by
+// onNotFound instead of the plain 404 page of http.FileServer.
+// If onNotFound is nil, the Router's NotFound handler is used, or
+// http.NotFound if it is not set either.
+// The fallback handler is called with the original request path.
+func (r *Router) ServeFilesWithFallback(path string, root http.FileSystem, onNotFound http.Handler) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+
+	r.GET(path, r.fileServerFallbackHandle(root, onNotFound))
+}
+
+// ServeFilesWithFallback serves files from the given file system root under
+// the path prefixed by the group prefix. See Router.ServeFilesWithFallback.
+func (g *Group) ServeFilesWithFallback(path string, root http.FileSystem, onNotFound http.Handler) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	g.GET(path, g.r.fileServerFallbackHandle(root, onNotFound))
+}
+
+// ServeFilesNoListing serves files from the given file system root, just like
+// ServeFiles, but without directory listings. Requests for directories
+// without an index.html file are answered with 404 Not Found, directories
+// with an index.html file serve it as usual.
+func (r *Router) ServeFilesNoListing(path string, root http.FileSystem) {
+	r.ServeFiles(path, noListingFileSystem{root})
+}
+
+// ServeFilesNoListing serves files from the given file system root under the
+// path prefixed by the group prefix. See Router.ServeFilesNoListing.
+func (g *Group) ServeFilesNoListing(path string, root http.FileSystem) {
+	g.ServeFiles(path, noListingFileSystem{root})
+}
+
+// ServeFilesWithCache serves files from the given file system root, just like
+// ServeFiles, and sets the Cache-Control header of successful responses to
+// cacheControl, e.g. "public, max-age=31536000, immutable".
+// The header is only set for files which are served (including partial
+// content and 304 Not Modified responses), not for errors like 404 Not Found
+// or redirects. Last-Modified and conditional requests are handled by
+// http.FileServer as usual.
+func (r *Router) ServeFilesWithCache(path string, root http.FileSystem, cacheControl string) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	r.GET(path, fileServerCacheHandle(root, cacheControl))
+}
+
+// ServeFilesWithCache serves files from the given file system root under the
+// path prefixed by the group prefix. See Router.ServeFilesWithCache.
+func (g *Group) ServeFilesWithCache(path string, root http.FileSystem, cacheControl string) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	g.GET(path, fileServerCacheHandle(root, cacheControl))
+}
+
+// Returns a request handle serving files like fileServerHandle, which sets the
+// Cache-Control header of successful responses.
+func fileServerCacheHandle(root http.FileSystem, cacheControl string) Handle {
+	serveFile := fileServerHandle(root)
+
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		serveFile(&cacheWriter{ResponseWriter: w, cacheControl: cacheControl}, req, ps)
+	}
+}
+
+// cacheWriter sets the Cache-Control header if the status code of the
+// response marks a success.
+type cacheWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	written      bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if !w.written {
+		w.written = true
+		if code >= 200 && code < 300 || code == http.StatusNotModified {
+			w.Header().Set("Cache-Control", w.cacheControl)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// contextWriter fails all writes once the context is done, so that a file
+// server stops copying a file.
+type contextWriter struct {
+	http.ResponseWriter
+	ctx context.Context
+}
+
+func (w contextWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom implements io.ReaderFrom, so that files are still sent with
+// sendfile if the wrapped http.ResponseWriter supports it.
+func (w contextWriter) ReadFrom(src io.Reader) (int64, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	// Hide ReadFrom from io.Copy, which would call it again
+	return io.Copy(struct{ io.Writer }{w}, src)
+}
+
+// noListingFileSystem hides directories without an index.html file.
+type noListingFileSystem struct {
+	fs http.FileSystem
+}
+
+func (nfs noListingFileSystem) Open(name string) (http.File, error) {
+	f, err := nfs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if stat.IsDir() {
+		index, err := nfs.fs.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
+// Returns a request handle serving files like fileServerHandle, which calls
+// onNotFound if the file server responds with 404.
+func (r *Router) fileServerFallbackHandle(root http.FileSystem, onNotFound http.Handler) Handle {
+	serveFile := fileServerHandle(root)
+
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		path := req.URL.Path
+		nfw := &notFoundWriter{ResponseWriter: w}
+		serveFile(nfw, req, ps)
+		if !nfw.notFound {
+			return
+		}
+
+		req.URL.Path = path
+		notFound := onNotFound
+		if notFound == nil {
+			notFound = r.NotFound
+		}
+		if notFound != nil {
+			notFound.ServeHTTP(w, req)
+		} else {
+			http.NotFound(w, req)
+		}
+	}
+}
+
+// notFoundWriter discards a 404 response, so that it can be replaced.
+type notFoundWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+func (w *notFoundWriter) WriteHeader(code int) {
+	if code == http.StatusNotFound {
+		// Drop the headers set by http.Error
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Del("X-Content-Type-Options")
+		w.notFound = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *notFoundWriter) Write(b []byte) (int, error) {
+	if w.notFound {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,55 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package httprouter
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// ServeFS serves files from the directory dir of the file system fsys, like
+// ServeFiles with http.FS(fsys). The path must end with "/*filepath".
+// Since an embed.FS contains the embedding directory, dir is typically the
+// directory named in the go:embed directive, e.g.
+//
+//	//go:embed static
+//	var staticFS embed.FS
+//
+//	router.ServeFS("/static/*filepath", staticFS, "static")
+//
+// If dir is empty or ".", the files are served from the root of fsys.
+// ServeFS panics if dir is not a directory of fsys. It requires Go 1.16 or
+// later, like the io/fs package.
+func (r *Router) ServeFS(path string, fsys fs.FS, dir string) {
+	r.ServeFiles(path, http.FS(subFS(fsys, dir)))
+}
+
+// ServeFS serves files from the directory dir of the file system fsys under
+// the path prefixed by the group prefix. See Router.ServeFS.
+func (g *Group) ServeFS(path string, fsys fs.FS, dir string) {
+	g.ServeFiles(path, http.FS(subFS(fsys, dir)))
+}
+
+// Returns the subtree of fsys rooted at the directory dir.
+func subFS(fsys fs.FS, dir string) fs.FS {
+	if dir == "" || dir == "." {
+		return fsys
+	}
+	info, err := fs.Stat(fsys, dir)
+	if err != nil {
+		panic("can not serve files from '" + dir + "': " + err.Error())
+	}
+	if !info.IsDir() {
+		panic("can not serve files from '" + dir + "': not a directory")
+	}
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic("can not serve files from '" + dir + "': " + err.Error())
+	}
+	return sub
+}
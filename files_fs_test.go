@@ -0,0 +1,92 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// Laid out like an embed.FS of the directory testdata/embed, which contains
+// the embedding directory.
+var embedFS = fstest.MapFS{
+	"testdata/embed/site/index.html":   {Data: []byte("index")},
+	"testdata/embed/site/css/main.css": {Data: []byte("body{}")},
+}
+
+func TestRouterServeFilesNoListing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index/index.html": {Data: []byte("index")},
+		"index/a.txt":      {Data: []byte("a")},
+		"list/b.txt":       {Data: []byte("b")},
+	}
+
+	router := New()
+	router.ServeFilesNoListing("/static/*filepath", http.FS(fsys))
+	router.Group("/group").ServeFilesNoListing("/*filepath", http.FS(fsys))
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/index/", http.StatusOK, "index"},
+		{"/static/index/a.txt", http.StatusOK, "a"},
+		{"/static/list/", http.StatusNotFound, "404 page not found\n"},
+		{"/static/list/b.txt", http.StatusOK, "b"},
+		{"/static/", http.StatusNotFound, "404 page not found\n"},
+		{"/group/list/", http.StatusNotFound, "404 page not found\n"},
+		{"/group/index/", http.StatusOK, "index"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want %d %q", test.path, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+}
+
+func TestRouterServeFS(t *testing.T) {
+	router := New()
+	router.ServeFS("/static/*filepath", embedFS, "testdata/embed/site")
+	router.ServeFS("/all/*filepath", embedFS, "")
+	router.Group("/group").ServeFS("/css/*filepath", embedFS, "testdata/embed/site/css")
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/static/", http.StatusOK, "index"},
+		{"/static/css/main.css", http.StatusOK, "body{}"},
+		{"/static/missing.txt", http.StatusNotFound, "404 page not found\n"},
+		{"/all/testdata/embed/site/css/main.css", http.StatusOK, "body{}"},
+		{"/group/css/main.css", http.StatusOK, "body{}"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want %d %q", test.path, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+
+	for _, dir := range []string{"testdata/missing", "testdata/embed/site/index.html", "../testdata"} {
+		recv := catchPanic(func() {
+			router.ServeFS("/invalid/*filepath", embedFS, dir)
+		})
+		if recv == nil {
+			t.Errorf("ServeFS did not panic for dir %q", dir)
+		}
+	}
+}
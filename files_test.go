@@ -0,0 +1,277 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a temporary directory containing the given files.
+func tempFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "httprouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRouterServeFilesWithFallback(t *testing.T) {
+	dir := tempFiles(t, map[string]string{"hello.txt": "Hello, World!"})
+	defer os.RemoveAll(dir)
+
+	var fallbackPath string
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackPath = r.URL.Path
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("custom"))
+	})
+
+	router := New()
+	router.ServeFilesWithFallback("/static/*filepath", http.Dir(dir), fallback)
+	router.ServeFilesWithFallback("/default/*filepath", http.Dir(dir), nil)
+
+	tests := []struct {
+		path   string
+		header string
+		code   int
+		body   string
+	}{
+		{"/static/hello.txt", "", http.StatusOK, "Hello, World!"},
+		{"/static/hello.txt", "bytes=0-4", http.StatusPartialContent, "Hello"},
+		{"/static/missing.txt", "", http.StatusTeapot, "custom"},
+		{"/default/missing.txt", "", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			r.Header.Set("Range", test.header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want %d %q", test.path, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+	if fallbackPath != "/static/missing.txt" {
+		t.Errorf("fallback called with path %q", fallbackPath)
+	}
+
+	// The Router's NotFound handler is used by default
+	router.NotFound = fallback
+	r, _ := http.NewRequest(http.MethodGet, "/default/missing.txt", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot || w.Header().Get("X-Content-Type-Options") != "" {
+		t.Errorf("NotFound fallback failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFilesWithFallback("/noFilepath", http.Dir(dir), nil)
+	})
+	if recv == nil {
+		t.Error("registering path not ending with '*filepath' did not panic")
+	}
+}
+
+// cancelWriter cancels the context of the request after the first write.
+type cancelWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w cancelWriter) Write(b []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(b)
+}
+
+// readerFromRecorder records the readers passed to ReadFrom.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	srcs []io.Reader
+}
+
+func (w *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	w.srcs = append(w.srcs, src)
+	return io.Copy(w.ResponseRecorder, src)
+}
+
+func TestRouterServeFilesCanceled(t *testing.T) {
+	const size = 1 << 20
+	dir := tempFiles(t, map[string]string{
+		"large.bin": strings.Repeat("x", size),
+	})
+	defer os.RemoveAll(dir)
+
+	router := New()
+	router.ServeFiles("/files/*filepath", http.Dir(dir))
+
+	// Served completely while the context is active
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/files/large.bin", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.ServeHTTP(w, r.WithContext(ctx))
+	if w.Code != http.StatusOK || w.Body.Len() != size {
+		t.Fatalf("got code %d and %d bytes, want 200 and %d bytes", w.Code, w.Body.Len(), size)
+	}
+
+	// Aborted once the context is canceled mid-stream
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	cw := cancelWriter{httptest.NewRecorder(), cancel}
+	r, _ = http.NewRequest(http.MethodGet, "/files/large.bin", nil)
+	router.ServeHTTP(cw, r.WithContext(ctx))
+	if n := cw.Body.Len(); cw.Code != http.StatusOK || n == 0 || n >= size {
+		t.Errorf("got code %d and %d bytes after canceling the context, want 200 and less than %d", cw.Code, n, size)
+	}
+
+	// The file itself is passed to ReadFrom, e.g. for sendfile
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	rw := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r, _ = http.NewRequest(http.MethodGet, "/files/large.bin", nil)
+	router.ServeHTTP(rw, r.WithContext(ctx))
+	if rw.Body.Len() != size || len(rw.srcs) != 1 {
+		t.Fatalf("got %d bytes in %d ReadFrom calls, want %d bytes in 1 call", rw.Body.Len(), len(rw.srcs), size)
+	}
+	if lr, ok := rw.srcs[0].(*io.LimitedReader); !ok {
+		t.Errorf("ReadFrom got %T, want *io.LimitedReader", rw.srcs[0])
+	} else if _, ok := lr.R.(*os.File); !ok {
+		t.Errorf("ReadFrom got a reader of %T, want *os.File", lr.R)
+	}
+}
+
+func TestRouterServeFilesPanicHandler(t *testing.T) {
+	dir := tempFiles(t, map[string]string{"file.txt": "content"})
+	defer os.RemoveAll(dir)
+
+	router := New()
+	router.PanicHandler = func(http.ResponseWriter, *http.Request, interface{}) {}
+	router.ServeFiles("/files/*filepath", http.Dir(dir))
+
+	// The wrapper of the ResponseWriter keeps sendfile
+	rw := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r, _ := http.NewRequest(http.MethodGet, "/files/file.txt", nil)
+	router.ServeHTTP(rw, r)
+	if rw.Body.String() != "content" || len(rw.srcs) != 1 {
+		t.Fatalf("got body %q in %d ReadFrom calls", rw.Body.String(), len(rw.srcs))
+	}
+	if lr, ok := rw.srcs[0].(*io.LimitedReader); !ok {
+		t.Errorf("ReadFrom got %T, want *io.LimitedReader", rw.srcs[0])
+	} else if _, ok := lr.R.(*os.File); !ok {
+		t.Errorf("ReadFrom got a reader of %T, want *os.File", lr.R)
+	}
+}
+
+func TestRouterServeFilesWithCache(t *testing.T) {
+	dir := tempFiles(t, map[string]string{
+		"app.js":          "console.log(1)",
+		"docs/index.html": "docs",
+	})
+	defer os.RemoveAll(dir)
+
+	const cacheControl = "public, max-age=31536000, immutable"
+	router := New()
+	router.ServeFilesWithCache("/static/*filepath", http.Dir(dir), cacheControl)
+	router.Group("/v1").ServeFilesWithCache("/static/*filepath", http.Dir(dir), cacheControl)
+
+	modified := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		path   string
+		header string
+		value  string
+		code   int
+		cached bool
+	}{
+		{"/static/app.js", "", "", http.StatusOK, true},
+		{"/v1/static/app.js", "", "", http.StatusOK, true},
+		{"/static/app.js", "Range", "bytes=0-6", http.StatusPartialContent, true},
+		{"/static/app.js", "If-Modified-Since", modified, http.StatusNotModified, true},
+		{"/static/docs/", "", "", http.StatusOK, true},
+		{"/static/missing.js", "", "", http.StatusNotFound, false},
+		{"/static/docs", "", "", http.StatusMovedPermanently, false},
+		{"/static/docs/index.html", "", "", http.StatusMovedPermanently, false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got code %d, want %d", test.path, w.Code, test.code)
+		}
+		if cached := w.Header().Get("Cache-Control") == cacheControl; cached != test.cached {
+			t.Errorf("%s (%d): Cache-Control header %q", test.path, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.ServeFilesWithCache("/noFilepath", http.Dir(dir), cacheControl)
+	})
+	if recv == nil {
+		t.Error("registering path not ending with '*filepath' did not panic")
+	}
+}
+
+func TestRouterServeFilesIndexRedirect(t *testing.T) {
+	dir := tempFiles(t, map[string]string{
+		"index.html":      "root",
+		"myindex.html":    "mine",
+		"docs/index.html": "docs",
+	})
+	defer os.RemoveAll(dir)
+
+	// http.FileServer redirects requests for index.html files to their
+	// directory
+	router := New()
+	router.ServeFiles("/static/*filepath", http.Dir(dir))
+	router.Group("/v1").ServeFiles("/files/*filepath", http.Dir(dir))
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+		body     string
+	}{
+		{"/static/index.html", http.StatusMovedPermanently, "./", ""},
+		{"/static/docs/index.html?v=1", http.StatusMovedPermanently, "./?v=1", ""},
+		{"/v1/files/docs/index.html", http.StatusMovedPermanently, "./", ""},
+		{"/static/", http.StatusOK, "", "root"},
+		{"/static/docs/", http.StatusOK, "", "docs"},
+		{"/static/myindex.html", http.StatusOK, "", "mine"},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: got code %d and Location %q, want %d and %q",
+				test.path, w.Code, w.Header().Get("Location"), test.code, test.location)
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s: got body %q, want %q", test.path, w.Body.String(), test.body)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "net/http"
+
+// Middleware wraps a request handle, e.g. to run code before and after the
+// wrapped handle is called or to decide whether it is called at all.
+// A single route can be wrapped by simply registering mw(handle).
+type Middleware func(Handle) Handle
+
+// Group is a set of routes sharing a common path prefix.
+// All routes registered through a group are added to the trees of the Router
+// the group belongs to, therefore Lookup and ServeHTTP treat them exactly like
+// routes registered with the full path directly on the Router.
+type Group struct {
+	r          *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Group returns a new group of routes, for which the given prefix is prepended
+// to the path of every registered route.
+// The prefix must begin with '/'. It is cleaned with CleanPath and a trailing
+// slash is removed, thus r.Group("/api/") and r.Group("/api") are equivalent.
+func (r *Router) Group(prefix string) *Group {
+	return &Group{
+		r:      r,
+		prefix: cleanPrefix(prefix),
+	}
+}
+
+// Group returns a new nested group of routes, which inherits the prefix and
+// the middleware of its parent group.
+// Middleware added to the parent group afterwards is not inherited.
+func (g *Group) Group(prefix string) *Group {
+	return &Group{
+		r:          g.r,
+		prefix:     g.prefix + cleanPrefix(prefix),
+		middleware: g.middleware[:len(g.middleware):len(g.middleware)],
+	}
+}
+
+// Use adds middleware to the group. It wraps all routes which are registered
+// through the group afterwards, routes registered before are not affected.
+// Middleware is applied in the order it was added, the first one being the
+// outermost, i.e. it is called first.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+func cleanPrefix(prefix string) string {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+
+	prefix = CleanPath(prefix)
+	if prefix[len(prefix)-1] == '/' {
+		// Routes start with a '/' themselves
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+// GET is a shortcut for group.Handle(http.MethodGet, path, handle)
+func (g *Group) GET(path string, handle Handle) {
+	g.Handle(http.MethodGet, path, handle)
+}
+
+// HEAD is a shortcut for group.Handle(http.MethodHead, path, handle)
+func (g *Group) HEAD(path string, handle Handle) {
+	g.Handle(http.MethodHead, path, handle)
+}
+
+// OPTIONS is a shortcut for group.Handle(http.MethodOptions, path, handle)
+func (g *Group) OPTIONS(path string, handle Handle) {
+	g.Handle(http.MethodOptions, path, handle)
+}
+
+// POST is a shortcut for group.Handle(http.MethodPost, path, handle)
+func (g *Group) POST(path string, handle Handle) {
+	g.Handle(http.MethodPost, path, handle)
+}
+
+// PUT is a shortcut for group.Handle(http.MethodPut, path, handle)
+func (g *Group) PUT(path string, handle Handle) {
+	g.Handle(http.MethodPut, path, handle)
+}
+
+// PATCH is a shortcut for group.Handle(http.MethodPatch, path, handle)
+func (g *Group) PATCH(path string, handle Handle) {
+	g.Handle(http.MethodPatch, path, handle)
+}
+
+// DELETE is a shortcut for group.Handle(http.MethodDelete, path, handle)
+func (g *Group) DELETE(path string, handle Handle) {
+	g.Handle(http.MethodDelete, path, handle)
+}
+
+// CONNECT is a shortcut for group.Handle(http.MethodConnect, path, handle)
+func (g *Group) CONNECT(path string, handle Handle) {
+	g.Handle(http.MethodConnect, path, handle)
+}
+
+// TRACE is a shortcut for group.Handle(http.MethodTrace, path, handle)
+func (g *Group) TRACE(path string, handle Handle) {
+	g.Handle(http.MethodTrace, path, handle)
+}
+
+// Any registers the handle for the path prefixed by the group prefix with the
+// same methods as Router.Any.
+func (g *Group) Any(path string, handle Handle) {
+	g.Handles(anyMethods, path, handle)
+}
+
+// Handles registers the same request handle for each of the given methods.
+// See Group.Handle.
+func (g *Group) Handles(methods []string, path string, handle Handle) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g.r.Handles(methods, g.prefix+path, g.wrap(handle))
+}
+
+// HandleBothSlash registers the handle for the path prefixed by the group
+// prefix both with and without a trailing slash. The handle is wrapped by the
+// middleware of the group. See Router.HandleBothSlash.
+func (g *Group) HandleBothSlash(method, path string, handle Handle) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g.r.HandleBothSlash(method, g.prefix+path, g.wrap(handle))
+}
+
+// Handle registers a new request handle with the given method and the path
+// prefixed by the group prefix. The handle is wrapped by the middleware of
+// the group. See Router.Handle.
+func (g *Group) Handle(method, path string, handle Handle) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g.r.Handle(method, g.prefix+path, g.wrap(handle))
+}
+
+// Wraps the handle with the middleware of the group.
+func (g *Group) wrap(handle Handle) Handle {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		handle = g.middleware[i](handle)
+	}
+	return handle
+}
+
+// Handler is an adapter which allows the usage of an http.Handler as a
+// request handle. See Router.Handler.
+func (g *Group) Handler(method, path string, handler http.Handler) {
+	g.Handle(method, path, handlerHandle(handler))
+}
+
+// HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
+// request handle. See Router.HandlerFunc.
+func (g *Group) HandlerFunc(method, path string, handler http.HandlerFunc) {
+	g.Handler(method, path, handler)
+}
+
+// HandleC is an adapter which allows the usage of a HandleC as a request
+// handle. See Router.HandleC.
+func (g *Group) HandleC(method, path string, handle HandleC) {
+	g.Handle(method, path, contextHandle(handle))
+}
+
+// GETC is a shortcut for group.HandleC(http.MethodGet, path, handle)
+func (g *Group) GETC(path string, handle HandleC) {
+	g.HandleC(http.MethodGet, path, handle)
+}
+
+// POSTC is a shortcut for group.HandleC(http.MethodPost, path, handle)
+func (g *Group) POSTC(path string, handle HandleC) {
+	g.HandleC(http.MethodPost, path, handle)
+}
+
+// ServeFiles serves files from the given file system root under the path
+// prefixed by the group prefix. See Router.ServeFiles.
+func (g *Group) ServeFiles(path string, root http.FileSystem) {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	g.GET(path, fileServerHandle(root))
+}
@@ -0,0 +1,195 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var get, post, users, handler bool
+
+	router := New()
+	api := router.Group("/api/v1/")
+	api.GET("/status", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		get = true
+	})
+	api.POST("/status", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		post = true
+	})
+	api.Handler(http.MethodGet, "/handler", handlerStruct{&handler})
+
+	u := api.Group("/users")
+	u.GET("/:name", func(w http.ResponseWriter, r *http.Request, ps Params) {
+		users = true
+		want := Params{Param{"name", "gopher"}}
+		if !reflect.DeepEqual(ps, want) {
+			t.Fatalf("wrong wildcard values: want %v, got %v", want, ps)
+		}
+	})
+
+	w := new(mockResponseWriter)
+
+	r, _ := http.NewRequest(http.MethodGet, "/api/v1/status", nil)
+	router.ServeHTTP(w, r)
+	if !get {
+		t.Error("routing GET failed")
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/api/v1/status", nil)
+	router.ServeHTTP(w, r)
+	if !post {
+		t.Error("routing POST failed")
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/api/v1/handler", nil)
+	router.ServeHTTP(w, r)
+	if !handler {
+		t.Error("routing Handler failed")
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/api/v1/users/gopher", nil)
+	router.ServeHTTP(w, r)
+	if !users {
+		t.Error("routing nested group failed")
+	}
+
+	// The group shares the trees of the router
+	if handle, _, _ := router.Lookup(http.MethodGet, "/api/v1/users/gopher"); handle == nil {
+		t.Error("Lookup of a group route failed")
+	}
+	if handle, _, _ := router.Lookup(http.MethodGet, "/status"); handle != nil {
+		t.Error("Got handle for path without group prefix")
+	}
+
+	// Registering the full path directly conflicts with the group route
+	recv := catchPanic(func() {
+		router.GET("/api/v1/status", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	})
+	if recv == nil {
+		t.Error("registering duplicate group route did not panic")
+	}
+}
+
+func TestGroupPrefix(t *testing.T) {
+	router := New()
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"/", ""},
+		{"/api", "/api"},
+		{"/api/", "/api"},
+		{"//api//v1/", "/api/v1"},
+		{"/api/../v2", "/v2"},
+	}
+	for _, test := range tests {
+		if g := router.Group(test.prefix); g.prefix != test.want {
+			t.Errorf("Group(%q): got prefix %q, want %q", test.prefix, g.prefix, test.want)
+		}
+	}
+
+	if g := router.Group("/api/").Group("/v1/").Group("/"); g.prefix != "/api/v1" {
+		t.Errorf("nested groups: got prefix %q, want %q", g.prefix, "/api/v1")
+	}
+
+	recv := catchPanic(func() {
+		router.Group("api")
+	})
+	if recv == nil {
+		t.Error("group prefix not beginning with '/' did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.Group("/api").GET("status", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	})
+	if recv == nil {
+		t.Error("group path not beginning with '/' did not panic")
+	}
+}
+
+func TestGroupRoot(t *testing.T) {
+	routed := false
+
+	router := New()
+	router.Group("/api").GET("/", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		routed = true
+	})
+
+	r, _ := http.NewRequest(http.MethodGet, "/api/", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if !routed {
+		t.Error("routing group root failed")
+	}
+
+	// The trailing slash redirect works just like for regular routes
+	r, _ = http.NewRequest(http.MethodGet, "/api", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/api/" {
+		t.Errorf("trailing slash redirect failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) {
+				calls = append(calls, name+":"+ps.ByName("id"))
+				next(w, r, ps)
+			}
+		}
+	}
+	handle := func(name string) Handle {
+		return func(w http.ResponseWriter, r *http.Request, _ Params) {
+			calls = append(calls, name)
+		}
+	}
+
+	router := New()
+
+	admin := router.Group("/admin")
+	admin.GET("/before", handle("before"))
+	admin.Use(trace("auth"), trace("log"))
+	admin.GET("/users/:id", handle("admin"))
+	admin.HandlerFunc(http.MethodGet, "/stats", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "stats")
+	})
+
+	nested := admin.Group("/nested")
+	admin.Use(trace("late"))
+	nested.GET("/:id", handle("nested"))
+
+	public := router.Group("/public")
+	public.Use(trace("cache"))
+	public.GET("/users/:id", handle("public"))
+
+	router.GET("/plain", handle("plain"))
+
+	tests := []struct {
+		path  string
+		calls []string
+	}{
+		{"/admin/before", []string{"before"}},
+		{"/admin/users/1", []string{"auth:1", "log:1", "admin"}},
+		{"/admin/stats", []string{"auth:", "log:", "stats"}},
+		{"/admin/nested/2", []string{"auth:2", "log:2", "nested"}},
+		{"/public/users/3", []string{"cache:3", "public"}},
+		{"/plain", []string{"plain"}},
+	}
+	for _, test := range tests {
+		calls = nil
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("wrong calls for %s: want %v, got %v", test.path, test.calls, calls)
+		}
+	}
+}
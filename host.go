@@ -0,0 +1,292 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// A host pattern containing wildcard labels, see Router.Host.
+type hostPattern struct {
+	labels []string
+	router *Router
+}
+
+// Host returns the Router for the given host. Routes registered with it only
+// match requests for this host. Repeated calls with the same host return the
+// same Router:
+//
+//	router.Host("api.example.com").GET("/users", Users)
+//
+// The host is matched case-insensitively against the host of the request,
+// without the port. IP addresses are matched exactly, IPv6 addresses may be
+// given with or without brackets, e.g. [::1] matches requests for [::1]:8080.
+// Besides exact host names, the host may contain wildcard labels:
+//
+//	:name.example.com   named label, matches a single label, e.g. a.example.com
+//	*.example.com       catch-all label, matches one or more labels
+//
+// The value of a named label is prepended to the Params of the matched route.
+// A catch-all label must be the first label of the host.
+// Exact hosts are tried first, then the host patterns with the most static
+// labels.
+//
+// The returned Router handles requests for its host with its own options,
+// e.g. RedirectTrailingSlash, and its own NotFound handler. If it is not set,
+// requests which can not be routed by the host Router are handled by the next
+// host Router matching the host in the order above instead, and finally by
+// the host-agnostic routes of r. The routes of each host are thus isolated,
+// e.g. api.example.com/v1/users and admin.example.com/v1/users can be routed
+// to different handles, while routes shared by all hosts only need to be
+// registered with r. Such a route also takes precedence over the redirects
+// (see RedirectTrailingSlash and RedirectFixedPath), the automatic OPTIONS
+// responses and the 405 responses of the host Router. The PanicHandler of r
+// applies to all hosts.
+func (r *Router) Host(host string) *Router {
+	if r.parent != nil {
+		panic("hosts can not be nested for host '" + host + "'")
+	}
+	if host == "" {
+		panic("host must not be empty")
+	}
+	host = strings.ToLower(trimBrackets(host))
+
+	if hr := r.hosts[host]; hr != nil {
+		return hr
+	}
+	for _, hp := range r.hostPatterns {
+		if strings.Join(hp.labels, ".") == host {
+			return hp.router
+		}
+	}
+
+	hr := New()
+	hr.parent = r
+
+	var labels []string
+	static := 0
+	if net.ParseIP(host) == nil {
+		labels = strings.Split(host, ".")
+	}
+	for i, label := range labels {
+		switch {
+		case label == "":
+			panic("empty label in host '" + host + "'")
+		case label[0] == '*':
+			if label != "*" {
+				panic("catch-all labels must not be named in host '" + host + "'")
+			}
+			if i > 0 {
+				panic("catch-all label must be the first label in host '" + host + "'")
+			}
+		case label[0] == ':':
+			if len(label) < 2 {
+				panic("wildcards must be named with a non-empty name in host '" + host + "'")
+			}
+		default:
+			static++
+		}
+	}
+
+	if static == len(labels) {
+		// Host names without wildcard labels and IP addresses
+		if r.hosts == nil {
+			r.hosts = make(map[string]*Router)
+		}
+		r.hosts[host] = hr
+		return hr
+	}
+
+	// Insert the pattern after all patterns with at least as many static
+	// labels
+	pos := len(r.hostPatterns)
+	for i, hp := range r.hostPatterns {
+		if staticLabels(hp.labels) < static {
+			pos = i
+			break
+		}
+	}
+	r.hostPatterns = append(r.hostPatterns, hostPattern{})
+	copy(r.hostPatterns[pos+1:], r.hostPatterns[pos:])
+	r.hostPatterns[pos] = hostPattern{labels: labels, router: hr}
+	return hr
+}
+
+func staticLabels(labels []string) (n int) {
+	for _, label := range labels {
+		if label[0] != ':' && label[0] != '*' {
+			n++
+		}
+	}
+	return
+}
+
+// Strips the port from the host of a request, and the brackets of an IPv6
+// address, e.g. [::1]:8080 becomes ::1.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return trimBrackets(host)
+}
+
+// Removes the brackets around an IPv6 address without port, e.g. [::1].
+func trimBrackets(host string) string {
+	if len(host) > 2 && host[0] == '[' && host[len(host)-1] == ']' {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// Returns the host Router matching the given request host and the values of
+// named labels, or nil if no host Router matches.
+func (r *Router) matchHost(host string) (*Router, Params) {
+	return r.nextHost(host, nil)
+}
+
+// Returns the host Router matching the given request host which follows the
+// host Router after in precedence order, i.e. the exact host first and then
+// the host patterns, and the values of its named labels. If after is nil, the
+// first matching host Router is returned. If there is none, nil is returned.
+func (r *Router) nextHost(host string, after *Router) (*Router, Params) {
+	host = strings.ToLower(hostname(host))
+
+	i := 0
+	if after == nil {
+		if hr := r.hosts[host]; hr != nil {
+			return hr, nil
+		}
+	} else if r.hosts[host] != after {
+		// Continue after the pattern of after
+		for i < len(r.hostPatterns) && r.hostPatterns[i].router != after {
+			i++
+		}
+		i++
+	}
+
+	for ; i < len(r.hostPatterns); i++ {
+		if ps, ok := matchHostLabels(r.hostPatterns[i].labels, host); ok {
+			return r.hostPatterns[i].router, ps
+		}
+	}
+	return nil, nil
+}
+
+// Serves a request which the host Router hr could not route with the next
+// matching host Router, or with the host-agnostic routes if there is none.
+func (r *Router) serveAfterHost(w http.ResponseWriter, req *http.Request, hr *Router, matched *Params) {
+	if next, hostParams := r.nextHost(req.Host, hr); next != nil {
+		next.serve(w, req, hostParams, matched)
+		return
+	}
+	r.serve(w, req, nil, matched)
+}
+
+// Reports whether the host Router r hands requests for the routed path
+// without a route over to the next host Router or the host-agnostic routes,
+// i.e. whether it has no handler of its own for them.
+func (r *Router) fallsBack(path string) bool {
+	return r.parent != nil && r.Fallback == nil && r.NotFound == nil &&
+		r.notFoundChain == nil && r.notFoundHandler(path) == nil
+}
+
+// Returns the first Router a request without a route in the host Router hr
+// falls back to which has a route for it, i.e. the next matching host Router
+// or r with the host-agnostic routes, and the values of its named labels. It
+// returns nil if no such Router has a route for the request, or if one of
+// them does not fall back any further.
+func (r *Router) routingAfterHost(req *http.Request, hr *Router) (*Router, Params) {
+	next, hostParams := r.nextHost(req.Host, hr)
+	for next != nil {
+		path, _ := next.requestPath(req)
+		if next.routesPath(next.roots(req.Method), path) {
+			return next, hostParams
+		}
+		if !next.fallsBack(path) {
+			return nil, nil
+		}
+		next, hostParams = r.nextHost(req.Host, next)
+	}
+	if path, _ := r.requestPath(req); r.routesPath(r.roots(req.Method), path) {
+		return r, nil
+	}
+	return nil, nil
+}
+
+func matchHostLabels(labels []string, host string) (ps Params, ok bool) {
+	for i := len(labels) - 1; i >= 0; i-- {
+		label := labels[i]
+		if label == "*" {
+			// Matches all remaining labels, at least one
+			return ps, host != ""
+		}
+
+		// Cut the last label of the host
+		value := host
+		if j := strings.LastIndexByte(host, '.'); j >= 0 {
+			value = host[j+1:]
+			host = host[:j]
+		} else {
+			host = ""
+		}
+		if value == "" {
+			return nil, false
+		}
+
+		if label[0] == ':' {
+			ps = append(Params{Param{Key: label[1:], Value: value}}, ps...)
+		} else if label != value {
+			return nil, false
+		}
+
+		if host == "" && i > 0 {
+			// Not enough labels
+			return nil, false
+		}
+	}
+	return ps, host == ""
+}
+
+// Prepends the params of the host to the params of the route.
+func (r *Router) withHostParams(hostParams Params, ps *Params) *Params {
+	n := len(hostParams)
+	if ps != nil {
+		n += len(*ps)
+	}
+	// Leave room for the matched route path
+	merged := make(Params, 0, n+1)
+	merged = append(merged, hostParams...)
+	if ps != nil {
+		merged = append(merged, *ps...)
+		r.putParams(ps)
+	}
+	return &merged
+}
+
+// LookupHost allows the manual lookup of a host + method + path combo, like
+// Lookup does for the host-agnostic routes.
+// The routes of the host Routers matching the host are tried first, in the
+// order of Host. If the path can not be found there, the host-agnostic routes
+// are tried.
+func (r *Router) LookupHost(host, method, path string) (Handle, Params, bool) {
+	var tsr bool
+	hr, hostParams := r.matchHost(host)
+	for hr != nil {
+		handle, ps, hostTsr := hr.Lookup(method, path)
+		if handle != nil {
+			if len(hostParams) > 0 {
+				ps = append(hostParams, ps...)
+			}
+			return handle, ps, hostTsr
+		}
+		tsr = tsr || hostTsr
+		hr, hostParams = r.nextHost(host, hr)
+	}
+
+	handle, ps, fallbackTsr := r.Lookup(method, path)
+	return handle, ps, tsr || fallbackTsr
+}
@@ -0,0 +1,321 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterHost(t *testing.T) {
+	var routed string
+	var params Params
+	handle := func(name string) Handle {
+		return func(w http.ResponseWriter, r *http.Request, ps Params) {
+			routed = name
+			params = ps
+		}
+	}
+
+	router := New()
+	router.GET("/users/:id", handle("any"))
+	router.GET("/status", handle("status"))
+	router.Host("api.example.com").GET("/users/:id", handle("api"))
+	router.Host(":tenant.example.com").GET("/users/:id", handle("tenant"))
+	router.Host("*.example.org").GET("/users/:id", handle("org"))
+	router.Host(":sub.api.example.org").GET("/users/:id", handle("org-api"))
+
+	if router.Host("API.example.com") != router.Host("api.example.com") {
+		t.Error("Host returned different routers for the same host")
+	}
+
+	tests := []struct {
+		host   string
+		path   string
+		routed string
+		params Params
+	}{
+		{"api.example.com", "/users/1", "api", Params{{"id", "1"}}},
+		{"API.Example.COM:8080", "/users/1", "api", Params{{"id", "1"}}},
+		{"acme.example.com", "/users/2", "tenant", Params{{"tenant", "acme"}, {"id", "2"}}},
+		{"a.b.example.com", "/users/3", "any", Params{{"id", "3"}}},
+		{"example.com", "/users/4", "any", Params{{"id", "4"}}},
+		{"a.example.org", "/users/5", "org", Params{{"id", "5"}}},
+		{"a.b.example.org", "/users/6", "org", Params{{"id", "6"}}},
+		{"v1.api.example.org", "/users/7", "org-api", Params{{"sub", "v1"}, {"id", "7"}}},
+		{"example.org", "/users/8", "any", Params{{"id", "8"}}},
+		{"other.com", "/users/9", "any", Params{{"id", "9"}}},
+		{"api.example.com", "/status", "status", nil},
+		{"acme.example.com", "/status", "status", nil},
+	}
+	for _, test := range tests {
+		routed, params = "", nil
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if routed != test.routed {
+			t.Errorf("%s%s: routed to %q, want %q", test.host, test.path, routed, test.routed)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s%s: got params %v, want %v", test.host, test.path, params, test.params)
+		}
+	}
+
+	handle2, ps, _ := router.LookupHost("acme.example.com", http.MethodGet, "/users/2")
+	if handle2 == nil {
+		t.Fatal("LookupHost failed")
+	}
+	if want := (Params{{"tenant", "acme"}, {"id", "2"}}); !reflect.DeepEqual(ps, want) {
+		t.Errorf("LookupHost: got params %v, want %v", ps, want)
+	}
+	if handle2, _, _ = router.LookupHost("acme.example.com", http.MethodGet, "/status"); handle2 == nil {
+		t.Error("LookupHost did not fall back to host-agnostic routes")
+	}
+}
+
+func TestRouterHostIsolation(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("tenant")
+		}
+	}
+
+	router := New()
+	router.GET("/v1/users", handle("any"))
+	router.GET("/health", handle("any-health"))
+	router.Host("api.example.com").GET("/v1/users", handle("api"))
+	router.Host("admin.example.com").GET("/v1/users", handle("admin"))
+	router.Host(":tenant.example.com").GET("/v1/users", handle("tenant-"))
+	router.Host(":tenant.example.com").GET("/v1/metrics", handle("metrics-"))
+	router.Host("*.com").GET("/v1/metrics", handle("com-metrics"))
+	router.Host("*.com").GET("/health", handle("com-health"))
+
+	tests := []struct {
+		host, path, routed string
+	}{
+		// Exact hosts first
+		{"api.example.com", "/v1/users", "api"},
+		{"admin.example.com", "/v1/users", "admin"},
+		{"acme.example.com", "/v1/users", "tenant-acme"},
+
+		// Then the host patterns matching the host
+		{"api.example.com", "/v1/metrics", "metrics-api"},
+		{"acme.example.com", "/v1/metrics", "metrics-acme"},
+		{"admin.example.com", "/health", "com-health"},
+
+		// Then the host-agnostic routes
+		{"other.org", "/v1/users", "any"},
+		{"other.org", "/health", "any-health"},
+		{"other.com", "/v1/users", "any"},
+
+		{"other.org", "/v1/metrics", ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		r.Host = test.host
+		router.ServeHTTP(w, r)
+		if routed != test.routed {
+			t.Errorf("%s%s: routed to %q, want %q", test.host, test.path, routed, test.routed)
+		}
+		if handle, ps, _ := router.LookupHost(test.host, http.MethodGet, test.path); handle != nil {
+			routed = ""
+			handle(nil, nil, ps)
+		}
+		if routed != test.routed {
+			t.Errorf("LookupHost(%s, %s): routed to %q, want %q", test.host, test.path, routed, test.routed)
+		}
+	}
+
+	// A NotFound handler of a host stops the fallback
+	router.Host("api.example.com").NotFound = http.NotFoundHandler()
+	r, _ := http.NewRequest(http.MethodGet, "/v1/metrics", nil)
+	r.Host = "api.example.com"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got Code %d, want 404", w.Code)
+	}
+}
+
+func TestRouterHostIP(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.GET("/", handle("any"))
+	router.Host("[::1]").GET("/", handle("ipv6"))
+	router.Host("2001:DB8::1").GET("/", handle("ipv6 upper"))
+	router.Host("127.0.0.1").GET("/", handle("ipv4"))
+	router.Host("example.com").GET("/", handle("name"))
+
+	if router.Host("::1") != router.Host("[::1]") {
+		t.Error("Host returned different routers for the same IPv6 address")
+	}
+
+	tests := []struct {
+		host   string
+		routed string
+	}{
+		{"[::1]:8080", "ipv6"},
+		{"[::1]", "ipv6"},
+		{"[2001:db8::1]:443", "ipv6 upper"},
+		{"[::2]:8080", "any"},
+		{"127.0.0.1:8080", "ipv4"},
+		{"127.0.0.1", "ipv4"},
+		{"127.0.0.2", "any"},
+		{"example.com:443", "name"},
+		{"example.com", "name"},
+		{"example.com.evil:443", "any"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Host = test.host
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if routed != test.routed {
+			t.Errorf("%s: routed to %q, want %q", test.host, routed, test.routed)
+		}
+	}
+}
+
+func TestHostname(t *testing.T) {
+	tests := []struct {
+		host, hostname string
+	}{
+		{"example.com", "example.com"},
+		{"example.com:443", "example.com"},
+		{"[::1]:8080", "::1"},
+		{"[::1]", "::1"},
+		{"::1", "::1"},
+		{"[fe80::1%25en0]:80", "fe80::1%25en0"},
+		{"[::1", "[::1"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if hostname := hostname(test.host); hostname != test.hostname {
+			t.Errorf("hostname(%q) = %q, want %q", test.host, hostname, test.hostname)
+		}
+	}
+}
+
+func TestRouterHostNotFound(t *testing.T) {
+	router := New()
+	router.GET("/fallback", func(w http.ResponseWriter, r *http.Request, _ Params) {})
+
+	api := router.Host("api.example.com")
+	api.GET("/users/", func(w http.ResponseWriter, r *http.Request, _ Params) {})
+
+	// Trailing slash redirect of the host router
+	r, _ := http.NewRequest(http.MethodGet, "/users", nil)
+	r.Host = "api.example.com"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/users/" {
+		t.Errorf("trailing slash redirect failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Fallback to the host-agnostic routes
+	r, _ = http.NewRequest(http.MethodGet, "/fallback", nil)
+	r.Host = "api.example.com"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("fallback failed: Code=%d", w.Code)
+	}
+
+	// Custom NotFound handler of the host router
+	api.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("host NotFound handler failed: Code=%d", w.Code)
+	}
+}
+
+func TestRouterHostFallbackPrecedence(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(w http.ResponseWriter, r *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.POST("/v1/users", handle("any-users"))
+	router.GET("/v1/items/", handle("any-items"))
+	router.GET("/v1/tenants/", handle("any-tenants"))
+	router.Host("api.example.com").GET("/v1/users", handle("api-users"))
+	router.Host("api.example.com").GET("/v1/items", handle("api-items"))
+	router.Host("api.example.com").GET("/v1/orders", handle("api-orders"))
+	router.Host("api.example.com").GET("/v1/tenants", handle("api-tenants"))
+	router.Host(":tenant.example.com").GET("/v1/tenants/", handle("tenant-tenants"))
+
+	tests := []struct {
+		method   string
+		host     string
+		path     string
+		code     int
+		routed   string
+		location string
+	}{
+		// Exact routes of the host-agnostic routes win over 405 and redirects
+		{http.MethodPost, "api.example.com", "/v1/users", http.StatusOK, "any-users", ""},
+		{http.MethodGet, "api.example.com", "/v1/items/", http.StatusOK, "any-items", ""},
+		// Exact routes of following host routers win over redirects
+		{http.MethodGet, "api.example.com", "/v1/tenants/", http.StatusOK, "tenant-tenants", ""},
+		// The host router still applies its policies without another route
+		{http.MethodPost, "api.example.com", "/v1/orders", http.StatusMethodNotAllowed, "", ""},
+		{http.MethodGet, "api.example.com", "/v1/orders/", http.StatusMovedPermanently, "", "/v1/orders"},
+		{http.MethodGet, "api.example.com", "/v1/users", http.StatusOK, "api-users", ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		r.Host = test.host
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s%s: Code=%d, routed=%q, Location=%q; want %d, %q, %q",
+				test.method, test.host, test.path, w.Code, routed, w.Header().Get("Location"),
+				test.code, test.routed, test.location)
+		}
+	}
+}
+
+func TestRouterHostInvalid(t *testing.T) {
+	router := New()
+	for _, host := range []string{
+		"",
+		"a..example.com",
+		"api.*.example.com",
+		"*name.example.com",
+		":.example.com",
+	} {
+		recv := catchPanic(func() {
+			router.Host(host)
+		})
+		if recv == nil {
+			t.Errorf("invalid host %q did not panic", host)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.Host("example.com").Host("api.example.com")
+	})
+	if recv == nil {
+		t.Error("nested Host did not panic")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+// Package httproutertest provides utilities for testing the routes of an
+// httprouter.Router, e.g.
+//
+//	rt := httproutertest.New(router)
+//	rt.Assert(t, http.MethodGet, "/users/42", "/users/:id", map[string]string{"id": "42"})
+//	rt.AssertNotFound(t, http.MethodGet, "/nope")
+//
+// Routes are looked up with Router.LookupDetailed, i.e. without calling any
+// handle, but with the path processing and redirect decisions of ServeHTTP,
+// e.g. for CleanPathBeforeRouting or IgnoreTrailingSlash. Paths are given
+// escaped, like in a request, e.g. /files/a%2Fb.
+package httproutertest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// TestingT is the part of testing.TB used to report failed assertions.
+// If it also has the method Helper, like testing.TB since Go 1.9, the
+// assertions are marked as helpers, so that failures are reported at the
+// line of the caller.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// Implemented by testing.TB since Go 1.9. Helper must be called by the
+// assertions themselves to mark them as helpers.
+type helper interface {
+	Helper()
+}
+
+// RouterTester asserts the outcome of looking up paths in a Router.
+type RouterTester struct {
+	Router *httprouter.Router
+}
+
+// New returns a RouterTester for the router.
+func New(router *httprouter.Router) *RouterTester {
+	return &RouterTester{Router: router}
+}
+
+// Assert checks that the path is matched by the route registered with
+// wantPattern, e.g. /users/:id, and that the values of its parameters are
+// wantParams. A nil or empty wantParams expects no parameters. Otherwise the
+// test is marked as failed. If no route matches, the failure reports whether
+// the router would redirect the request instead.
+func (rt *RouterTester) Assert(t TestingT, method, path, wantPattern string, wantParams map[string]string) {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	res := rt.Router.LookupDetailed(method, path)
+	if !res.Found {
+		t.Errorf("%s %s: no route found (%s), want route %s", method, path, describe(res), wantPattern)
+		return
+	}
+	if res.Route != wantPattern {
+		t.Errorf("%s %s: matched route %s, want %s", method, path, res.Route, wantPattern)
+	}
+	if diff := diffParams(res.Params, wantParams); diff != "" {
+		t.Errorf("%s %s: wrong params for route %s:\n%s", method, path, res.Route, diff)
+	}
+}
+
+// AssertNotFound checks that no route matches the path and that the router
+// would not redirect the request either, i.e. that it would be handled as
+// 404 or 405. Otherwise the test is marked as failed.
+func (rt *RouterTester) AssertNotFound(t TestingT, method, path string) {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	res := rt.Router.LookupDetailed(method, path)
+	if res.Found || res.TrailingSlashRedirect || res.FixedPath != "" {
+		t.Errorf("%s %s: %s, want no route", method, path, describe(res))
+	}
+}
+
+// AssertTrailingSlashRedirect checks that no route matches the path and that
+// the router would redirect the request to the path with (without) the
+// trailing slash, see Router.RedirectTrailingSlash. Otherwise the test is
+// marked as failed.
+func (rt *RouterTester) AssertTrailingSlashRedirect(t TestingT, method, path string) {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	res := rt.Router.LookupDetailed(method, path)
+	if !res.TrailingSlashRedirect {
+		t.Errorf("%s %s: %s, want trailing slash redirect", method, path, describe(res))
+	}
+}
+
+// AssertFixedPathRedirect checks that no route matches the path and that the
+// router would redirect the request to wantPath, see
+// Router.RedirectFixedPath. Otherwise the test is marked as failed.
+func (rt *RouterTester) AssertFixedPathRedirect(t TestingT, method, path, wantPath string) {
+	if h, ok := t.(helper); ok {
+		h.Helper()
+	}
+	res := rt.Router.LookupDetailed(method, path)
+	if res.FixedPath != wantPath {
+		t.Errorf("%s %s: %s, want fixed path redirect to %s", method, path, describe(res), wantPath)
+	}
+}
+
+// Describes the outcome of a lookup.
+func describe(res httprouter.LookupResult) string {
+	switch {
+	case res.Found:
+		return "matched route " + res.Route
+	case res.TrailingSlashRedirect:
+		return "trailing slash redirect"
+	case res.FixedPath != "":
+		return "fixed path redirect to " + res.FixedPath
+	}
+	return "not found"
+}
+
+// Returns a description of the differences between the params and the wanted
+// values, one per line and sorted by key, or an empty string if there are
+// none.
+func diffParams(ps httprouter.Params, want map[string]string) string {
+	got := make(map[string]string, len(ps))
+	var lines []string
+	for _, p := range ps {
+		if _, ok := got[p.Key]; ok {
+			lines = append(lines, fmt.Sprintf("\t%s: duplicate param", p.Key))
+			continue
+		}
+		got[p.Key] = p.Value
+	}
+	for key, value := range got {
+		if wantValue, ok := want[key]; !ok {
+			lines = append(lines, fmt.Sprintf("\t%s: unexpected param %q", key, value))
+		} else if value != wantValue {
+			lines = append(lines, fmt.Sprintf("\t%s: got %q, want %q", key, value, wantValue))
+		}
+	}
+	for key, wantValue := range want {
+		if _, ok := got[key]; !ok {
+			lines = append(lines, fmt.Sprintf("\t%s: missing param, want %q", key, wantValue))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,133 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httproutertest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// recorder records the failures of assertions.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func testRouter() *RouterTester {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ httprouter.Params) {}
+	router := httprouter.New()
+	router.GET("/users/:id", handle)
+	router.GET("/users/:id/posts/:post", handle)
+	router.GET("/src/*filepath", handle)
+	router.GET("/about/", handle)
+	return New(router)
+}
+
+func TestAssert(t *testing.T) {
+	rt := testRouter()
+
+	// Passing assertions
+	rt.Assert(t, http.MethodGet, "/users/42", "/users/:id", map[string]string{"id": "42"})
+	rt.Assert(t, http.MethodGet, "/users/1/posts/2", "/users/:id/posts/:post",
+		map[string]string{"id": "1", "post": "2"})
+	rt.Assert(t, http.MethodGet, "/src/a/b.go", "/src/*filepath", map[string]string{"filepath": "/a/b.go"})
+	rt.Assert(t, http.MethodGet, "/about/", "/about/", nil)
+	rt.AssertNotFound(t, http.MethodGet, "/nope")
+	rt.AssertNotFound(t, http.MethodPost, "/users/42")
+	rt.AssertTrailingSlashRedirect(t, http.MethodGet, "/about")
+	rt.AssertTrailingSlashRedirect(t, http.MethodGet, "/users/42/")
+	rt.AssertFixedPathRedirect(t, http.MethodGet, "/ABOUT/", "/about/")
+	rt.Assert(t, http.MethodGet, "/users/a%20b", "/users/:id", map[string]string{"id": "a b"})
+
+	// The options of the router apply like for ServeHTTP
+	rt.Router.IgnoreTrailingSlash = true
+	rt.Assert(t, http.MethodGet, "/about", "/about/", nil)
+	rt.Router.IgnoreTrailingSlash = false
+
+	// Failing assertions
+	tests := []struct {
+		assert func(t TestingT)
+		errors []string
+	}{
+		{
+			func(t TestingT) {
+				rt.Assert(t, http.MethodGet, "/users/42", "/user/:id", map[string]string{"id": "42"})
+			},
+			[]string{"GET /users/42: matched route /users/:id, want /user/:id"},
+		},
+		{
+			func(t TestingT) {
+				rt.Assert(t, http.MethodGet, "/users/1/posts/2", "/users/:id/posts/:post",
+					map[string]string{"id": "2", "name": "x"})
+			},
+			[]string{"GET /users/1/posts/2: wrong params for route /users/:id/posts/:post:\n" +
+				"\tid: got \"1\", want \"2\"\n" +
+				"\tname: missing param, want \"x\"\n" +
+				"\tpost: unexpected param \"2\""},
+		},
+		{
+			func(t TestingT) { rt.Assert(t, http.MethodGet, "/about", "/about/", nil) },
+			[]string{"GET /about: no route found (trailing slash redirect), want route /about/"},
+		},
+		{
+			func(t TestingT) { rt.Assert(t, http.MethodGet, "/nope", "/nope", nil) },
+			[]string{"GET /nope: no route found (not found), want route /nope"},
+		},
+		{
+			func(t TestingT) { rt.AssertNotFound(t, http.MethodGet, "/users/42") },
+			[]string{"GET /users/42: matched route /users/:id, want no route"},
+		},
+		{
+			func(t TestingT) { rt.AssertNotFound(t, http.MethodGet, "/ABOUT/") },
+			[]string{"GET /ABOUT/: fixed path redirect to /about/, want no route"},
+		},
+		{
+			func(t TestingT) { rt.AssertTrailingSlashRedirect(t, http.MethodGet, "/about/") },
+			[]string{"GET /about/: matched route /about/, want trailing slash redirect"},
+		},
+		{
+			func(t TestingT) { rt.AssertFixedPathRedirect(t, http.MethodGet, "/nope", "/about/") },
+			[]string{"GET /nope: not found, want fixed path redirect to /about/"},
+		},
+	}
+	for i, test := range tests {
+		r := new(recorder)
+		test.assert(r)
+		if fmt.Sprint(r.errors) != fmt.Sprint(test.errors) {
+			t.Errorf("%d: got errors %q, want %q", i, r.errors, test.errors)
+		}
+	}
+}
+
+// helperRecorder additionally counts the calls of Helper.
+type helperRecorder struct {
+	recorder
+	helpers int
+}
+
+func (r *helperRecorder) Helper() {
+	r.helpers++
+}
+
+func TestAssertHelper(t *testing.T) {
+	rt := testRouter()
+	rec := new(helperRecorder)
+	rt.Assert(rec, http.MethodGet, "/users/42", "/users/:id", map[string]string{"id": "42"})
+	rt.AssertNotFound(rec, http.MethodGet, "/nope")
+	rt.AssertTrailingSlashRedirect(rec, http.MethodGet, "/about")
+	rt.AssertFixedPathRedirect(rec, http.MethodGet, "/USERS/42", "/users/42")
+	if len(rec.errors) != 0 {
+		t.Fatalf("unexpected failures: %v", rec.errors)
+	}
+	if rec.helpers != 4 {
+		t.Errorf("Helper called %d times, want 4", rec.helpers)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// MountPathParam is the name of the catch-all parameter of mounted handlers,
+// see Router.Mount.
+const MountPathParam = "mountpath"
+
+// Mount forwards all requests for paths below the given prefix to the given
+// handler, e.g. another Router. The prefix is stripped from the request path
+// before the handler is called:
+//
+//	router.Mount("/admin", adminRouter) // /admin/users is served as /users
+//
+// The prefix is cleaned like the prefix of a Group. The prefix itself, e.g.
+// /admin, does not belong to the mounted subtree and is redirected to /admin/
+// if RedirectTrailingSlash is enabled, which is then served as / by the
+// handler. Within the subtree, the handler is responsible for all responses,
+// i.e. a mounted Router uses its own NotFound handler and its own redirects.
+//
+// Internally a catch-all route with the parameter MountPathParam is registered
+// with MethodWildcard, so that requests with any method reach the handler,
+// including non-standard ones like PROPFIND. Like for other wildcard routes,
+// a route registered for a specific method below the prefix takes precedence
+// over the mount for that method, while the subtree can not contain any other
+// routes for all methods. If the prefix contains parameters, their values are
+// stored in the request context, see ParamsFromContext.
+func (r *Router) Mount(prefix string, handler http.Handler) {
+	r.Handle(MethodWildcard, cleanPrefix(prefix)+"/*"+MountPathParam, mountHandle(handler))
+}
+
+// Mount forwards all requests for paths below the given prefix, prefixed by
+// the group prefix, to the given handler. See Router.Mount.
+func (g *Group) Mount(prefix string, handler http.Handler) {
+	g.Handle(MethodWildcard, cleanPrefix(prefix)+"/*"+MountPathParam, mountHandle(handler))
+}
+
+// SubtreePathParam is the name of the catch-all parameter of subtree routes,
+// see Router.HandleSubtree.
+const SubtreePathParam = "subpath"
+
+// HandleSubtree registers the handle for the given prefix and all paths below
+// it, e.g. for /admin, /admin/ and /admin/users/1:
+//
+//	router.HandleSubtree(http.MethodGet, "/admin", adminHandle)
+//
+// The prefix is cleaned like the prefix of a Group. Internally the routes
+// prefix and prefix/*subpath are registered with the same handle. The path
+// below the prefix is thus available as the parameter SubtreePathParam, e.g.
+// /users/1, which is empty for the prefix itself.
+// More specific routes below the prefix can not take precedence over the
+// subtree: since a catch-all parameter can not share its position with
+// another segment, registering a route below the prefix panics, whether it is
+// registered before or after HandleSubtree (TryHandle returns the conflict as
+// an error instead). More specific paths must be dispatched by the handle
+// itself, e.g. based on the value of SubtreePathParam.
+func (r *Router) HandleSubtree(method, prefix string, handle Handle) {
+	prefix = cleanPrefix(prefix)
+	if prefix != "" {
+		r.Handle(method, prefix, handle)
+	}
+	r.Handle(method, prefix+"/*"+SubtreePathParam, handle)
+}
+
+// HandleSubtree registers the handle for the given prefix, prefixed by the
+// group prefix, and all paths below it. The handle is wrapped by the
+// middleware of the group. See Router.HandleSubtree.
+func (g *Group) HandleSubtree(method, prefix string, handle Handle) {
+	if len(prefix) < 1 || prefix[0] != '/' {
+		panic("prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	g.r.HandleSubtree(method, g.prefix+prefix, g.wrap(handle))
+}
+
+// Returns a request handle which strips the path up to the catch-all parameter
+// from the request and calls the handler.
+func mountHandle(handler http.Handler) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		path := withLeadingSlash(ps.ByName(MountPathParam))
+
+		r2 := new(http.Request)
+		*r2 = *req
+		r2.URL = new(url.URL)
+		*r2.URL = *req.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+
+		// Params of the prefix
+		for i := range ps {
+			if ps[i].Key == MountPathParam {
+				ps = ps[:i:i]
+				break
+			}
+		}
+		if len(ps) > 0 {
+			r2 = r2.WithContext(context.WithValue(r2.Context(), ParamsKey, ps))
+		}
+
+		handler.ServeHTTP(w, r2)
+	}
+}
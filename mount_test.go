@@ -0,0 +1,163 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterMount(t *testing.T) {
+	var routed string
+	var params Params
+
+	admin := New()
+	admin.GET("/", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		routed = "index " + r.URL.Path
+	})
+	admin.POST("/users/:name", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		routed = "user " + r.URL.Path
+		params = ps
+	})
+	admin.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routed = "admin not found " + r.URL.Path
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	router := New()
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "root"
+	})
+	router.Mount("/admin/", admin)
+	router.Mount("/tenants/:tenant", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		routed = "tenant " + r.URL.Path
+		params = ParamsFromContext(r.Context())
+	}))
+	router.Group("/api").Mount("/v1", admin)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		routed string
+		params Params
+	}{
+		{http.MethodGet, "/", http.StatusOK, "root", nil},
+		{http.MethodGet, "/admin/", http.StatusOK, "index /", nil},
+		{http.MethodPost, "/admin/users/gopher", http.StatusOK, "user /users/gopher", Params{Param{"name", "gopher"}}},
+		{http.MethodGet, "/admin/nope", http.StatusNotFound, "admin not found /nope", nil},
+		{http.MethodGet, "/admin", http.StatusMovedPermanently, "", nil},
+		{http.MethodDelete, "/tenants/acme/x", http.StatusOK, "tenant /x", Params{Param{"tenant", "acme"}}},
+		{"PROPFIND", "/tenants/acme/dav/", http.StatusOK, "tenant /dav/", Params{Param{"tenant", "acme"}}},
+		{"PURGE", "/admin/users/gopher", http.StatusMethodNotAllowed, "", nil},
+		{http.MethodGet, "/api/v1/", http.StatusOK, "index /", nil},
+	}
+	for _, test := range tests {
+		routed, params = "", nil
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s %s: got %d %q, want %d %q", test.method, test.path, w.Code, routed, test.code, test.routed)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s %s: wrong parameter values: want %v, got %v", test.method, test.path, test.params, params)
+		}
+		if test.routed != "" && r.URL.Path != test.path {
+			t.Errorf("%s %s: request path modified to %q", test.method, test.path, r.URL.Path)
+		}
+	}
+
+	// Routes for specific methods take precedence over the mount
+	router.GET("/admin/other", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = "other"
+	})
+	for method, want := range map[string]string{
+		http.MethodGet:  "other",
+		http.MethodPost: "admin not found /other",
+	} {
+		routed = ""
+		r, _ := http.NewRequest(method, "/admin/other", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != want {
+			t.Errorf("%s /admin/other: got %q, want %q", method, routed, want)
+		}
+	}
+	recv := catchPanic(func() {
+		router.Handle(MethodWildcard, "/admin/other", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	})
+	if recv == nil {
+		t.Error("registering wildcard route in mounted subtree did not panic")
+	}
+}
+
+func TestRouterHandleSubtree(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + " " + ps.ByName(SubtreePathParam)
+		}
+	}
+
+	router := New()
+	router.HandleSubtree(http.MethodGet, "/admin/", handle("admin"))
+	router.GET("/adminx", handle("adminx"))
+	router.Group("/api").HandleSubtree(http.MethodGet, "/v1", handle("v1"))
+
+	root := New()
+	root.HandleSubtree(http.MethodGet, "/", handle("root"))
+
+	tests := []struct {
+		router *Router
+		path   string
+		routed string
+	}{
+		{router, "/admin", "admin "},
+		{router, "/admin/", "admin /"},
+		{router, "/admin/x/y", "admin /x/y"},
+		{router, "/adminx", "adminx "},
+		{router, "/api/v1", "v1 "},
+		{router, "/api/v1/items", "v1 /items"},
+		{root, "/", "root /"},
+		{root, "/x", "root /x"},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		test.router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || routed != test.routed {
+			t.Errorf("%s: got %d %q, want 200 %q", test.path, w.Code, routed, test.routed)
+		}
+	}
+
+	if errs := router.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+	if errs := root.Validate(); errs != nil {
+		t.Errorf("Validate failed for root subtree: %v", errs)
+	}
+
+	// The subtree can not contain more specific routes
+	recv := catchPanic(func() {
+		router.GET("/admin/users", handle("users"))
+	})
+	if recv == nil {
+		t.Error("registering route in subtree did not panic")
+	}
+	specific := New()
+	specific.GET("/admin/users", handle("users"))
+	if err := specific.TryHandle(http.MethodGet, "/admin/*"+SubtreePathParam, handle("admin")); err == nil {
+		t.Error("subtree over existing route did not fail")
+	}
+	recv = catchPanic(func() {
+		router.Group("/api").HandleSubtree(http.MethodGet, "v2", handle("v2"))
+	})
+	if recv == nil {
+		t.Error("prefix not beginning with '/' did not panic")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrParamNotFound is reported by the typed accessors of Params, e.g.
+// Params.ParamInt, if no Param with the requested name exists.
+var ErrParamNotFound = errors.New("parameter not found")
+
+// ParamError records a failed conversion of a parameter value.
+type ParamError struct {
+	Name  string // name of the parameter
+	Value string // value which could not be converted
+	Err   error  // reason, e.g. ErrParamNotFound, strconv.ErrSyntax or strconv.ErrRange
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == ErrParamNotFound {
+		return "parameter '" + e.Name + "': " + e.Err.Error()
+	}
+	return "parameter '" + e.Name + "': invalid value '" + e.Value + "': " + e.Err.Error()
+}
+
+// Unwrap returns the reason of the failed conversion.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the value of the first Param which key matches the given name and
+// whether such a Param was found.
+func (ps Params) get(name string) (string, bool) {
+	for i := range ps {
+		if ps[i].Key == name {
+			return ps[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Converts a strconv error to a ParamError.
+func paramError(name, value string, err error) error {
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	return &ParamError{Name: name, Value: value, Err: err}
+}
+
+// ByNameDefault returns the value of the first Param which key matches the
+// given name. If no matching Param is found, def is returned.
+// Unlike with ByName, an existing Param with an empty value can thus be
+// distinguished from a missing one.
+func (ps Params) ByNameDefault(name, def string) string {
+	if value, ok := ps.get(name); ok {
+		return value
+	}
+	return def
+}
+
+// ByNameFold returns the value of the first Param which key matches the given
+// name under Unicode case-folding, e.g. ByNameFold("ID") returns the value of
+// the Param with the key id. If no matching Param is found, an empty string is
+// returned.
+func (ps Params) ByNameFold(name string) string {
+	for i := range ps {
+		if strings.EqualFold(ps[i].Key, name) {
+			return ps[i].Value
+		}
+	}
+	return ""
+}
+
+// Range calls f for each Param in order, with its key and value. If f returns
+// false, Range stops.
+func (ps Params) Range(f func(key, value string) bool) {
+	for i := range ps {
+		if !f(ps[i].Key, ps[i].Value) {
+			return
+		}
+	}
+}
+
+// Map returns the Params as a map from their keys to their values. If a key
+// occurs more than once, the map holds the value of the first Param, like
+// ByName returns it. Map returns nil for empty Params, the map is only
+// allocated if there are Params.
+func (ps Params) Map() map[string]string {
+	if len(ps) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(ps))
+	for i := len(ps) - 1; i >= 0; i-- {
+		m[ps[i].Key] = ps[i].Value
+	}
+	return m
+}
+
+// String returns the Params in order in the form key1=value1&key2=value2,
+// e.g. for logging. Keys and values are escaped like by url.QueryEscape, so
+// the result is unambiguous even if they contain '=' or '&'.
+func (ps Params) String() string {
+	var buf []byte
+	for i := range ps {
+		if i > 0 {
+			buf = append(buf, '&')
+		}
+		buf = append(buf, url.QueryEscape(ps[i].Key)...)
+		buf = append(buf, '=')
+		buf = append(buf, url.QueryEscape(ps[i].Value)...)
+	}
+	return string(buf)
+}
+
+// Equal reports whether ps and other contain the same Params regardless of
+// their order, e.g. for assertions in tests. A Param occurring more than once
+// must occur as often in both. Nil and empty Params are equal.
+func (ps Params) Equal(other Params) bool {
+	if len(ps) != len(other) {
+		return false
+	}
+	matched := make([]bool, len(other))
+outer:
+	for i := range ps {
+		for j := range other {
+			if !matched[j] && other[j] == ps[i] {
+				matched[j] = true
+				continue outer
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ParamInt returns the value of the first Param which key matches the given
+// name, converted to an int.
+// If no matching Param is found or the value is not a valid base 10 integer
+// within the range of int, a *ParamError is returned.
+func (ps Params) ParamInt(name string) (int, error) {
+	value, ok := ps.get(name)
+	if !ok {
+		return 0, paramError(name, value, ErrParamNotFound)
+	}
+	i, err := strconv.ParseInt(value, 10, 0)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return int(i), nil
+}
+
+// ParamInt64 returns the value of the first Param which key matches the given
+// name, converted to an int64.
+// If no matching Param is found or the value is not a valid base 10 integer
+// within the range of int64, a *ParamError is returned.
+func (ps Params) ParamInt64(name string) (int64, error) {
+	value, ok := ps.get(name)
+	if !ok {
+		return 0, paramError(name, value, ErrParamNotFound)
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return i, nil
+}
+
+// ParamUint returns the value of the first Param which key matches the given
+// name, converted to an uint.
+// If no matching Param is found or the value is not a valid base 10 unsigned
+// integer within the range of uint, a *ParamError is returned.
+func (ps Params) ParamUint(name string) (uint, error) {
+	value, ok := ps.get(name)
+	if !ok {
+		return 0, paramError(name, value, ErrParamNotFound)
+	}
+	i, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, paramError(name, value, err)
+	}
+	return uint(i), nil
+}
+
+// ParamBool returns the value of the first Param which key matches the given
+// name, converted to a bool. The values accepted by strconv.ParseBool are
+// valid, e.g. "1", "t", "true", "0", "f" and "false".
+// If no matching Param is found or the value is not valid, a *ParamError is
+// returned.
+func (ps Params) ParamBool(name string) (bool, error) {
+	value, ok := ps.get(name)
+	if !ok {
+		return false, paramError(name, value, ErrParamNotFound)
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, paramError(name, value, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,314 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParamsByNameDefault(t *testing.T) {
+	ps := Params{
+		Param{"name", "gopher"},
+		Param{"empty", ""},
+	}
+	if v := ps.ByNameDefault("name", "def"); v != "gopher" {
+		t.Errorf("wrong value for existing param: got %q", v)
+	}
+	if v := ps.ByNameDefault("empty", "def"); v != "" {
+		t.Errorf("wrong value for empty param: got %q", v)
+	}
+	if v := ps.ByNameDefault("noKey", "def"); v != "def" {
+		t.Errorf("wrong value for missing param: got %q", v)
+	}
+	if v := Params(nil).ByNameDefault("noKey", "def"); v != "def" {
+		t.Errorf("wrong value for nil params: got %q", v)
+	}
+}
+
+func TestParamsByNameFold(t *testing.T) {
+	ps := Params{
+		Param{"id", "1"},
+		Param{"userName", "gopher"},
+		Param{"ID", "2"},
+	}
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"id", "1"},
+		{"ID", "1"}, // the first matching Param
+		{"Id", "1"},
+		{"username", "gopher"},
+		{"USERNAME", "gopher"},
+		{"user", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if v := ps.ByNameFold(test.name); v != test.value {
+			t.Errorf("ByNameFold(%q) = %q, want %q", test.name, v, test.value)
+		}
+	}
+	if v := Params(nil).ByNameFold("id"); v != "" {
+		t.Errorf("wrong value for nil params: got %q", v)
+	}
+}
+
+func TestParamsRange(t *testing.T) {
+	ps := Params{
+		Param{"user", "gopher"},
+		Param{"repo", "httprouter"},
+		Param{"id", "42"},
+	}
+
+	var got []string
+	ps.Range(func(key, value string) bool {
+		got = append(got, key+"="+value)
+		return key != "repo"
+	})
+	if want := []string{"user=gopher", "repo=httprouter"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Range called f for %v, want %v", got, want)
+	}
+
+	Params(nil).Range(func(_, _ string) bool {
+		t.Error("Range called f for nil params")
+		return true
+	})
+
+	n := 0
+	allocs := testing.AllocsPerRun(100, func() {
+		ps.Range(func(key, value string) bool {
+			n += len(key) + len(value)
+			return true
+		})
+	})
+	if allocs != 0 {
+		t.Errorf("Range allocated %v times, want 0", allocs)
+	}
+}
+
+func TestParamsMap(t *testing.T) {
+	ps := Params{
+		Param{"id", "1"},
+		Param{"name", "gopher"},
+		Param{"id", "2"},
+	}
+	if m, want := ps.Map(), map[string]string{"id": "1", "name": "gopher"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("Map() = %v, want %v", m, want)
+	}
+	if m := (Params{}).Map(); m != nil {
+		t.Errorf("Map() = %v for empty params, want nil", m)
+	}
+}
+
+func TestParamsString(t *testing.T) {
+	tests := []struct {
+		ps     Params
+		result string
+	}{
+		{nil, ""},
+		{Params{{"id", "1"}}, "id=1"},
+		{Params{{"id", "1"}, {"name", ""}, {"id", "2"}}, "id=1&name=&id=2"},
+		{Params{{"path", "/a b&c=d"}}, "path=%2Fa+b%26c%3Dd"},
+		{Params{{"a=b", "c"}}, "a%3Db=c"},
+	}
+	for _, test := range tests {
+		if result := test.ps.String(); result != test.result {
+			t.Errorf("String() = %q, want %q", result, test.result)
+		}
+	}
+}
+
+func TestParamsEqual(t *testing.T) {
+	ps := Params{{"id", "1"}, {"name", ""}, {"id", "2"}}
+	tests := []struct {
+		other Params
+		equal bool
+	}{
+		{Params{{"id", "1"}, {"name", ""}, {"id", "2"}}, true},
+		{Params{{"id", "2"}, {"id", "1"}, {"name", ""}}, true},
+		{Params{{"id", "1"}, {"name", ""}, {"id", "1"}}, false},
+		{Params{{"id", "1"}, {"name", "x"}, {"id", "2"}}, false},
+		{Params{{"id", "1"}, {"id", "2"}}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if equal := ps.Equal(test.other); equal != test.equal {
+			t.Errorf("Equal(%v) = %v, want %v", test.other, equal, test.equal)
+		}
+		if equal := test.other.Equal(ps); equal != test.equal {
+			t.Errorf("%v.Equal() = %v, want %v", test.other, equal, test.equal)
+		}
+	}
+	if !(Params{}).Equal(nil) {
+		t.Error("empty Params are not equal to nil")
+	}
+}
+
+func TestParamsTyped(t *testing.T) {
+	ps := Params{
+		Param{"int", "-42"},
+		Param{"plus", "+7"},
+		Param{"big", "9223372036854775807"},
+		Param{"overflow", "9223372036854775808"},
+		Param{"underflow", "-9223372036854775809"},
+		Param{"uintOverflow", "18446744073709551616"},
+		Param{"text", "gopher"},
+		Param{"float", "1.5"},
+		Param{"empty", ""},
+		Param{"true", "true"},
+		Param{"one", "1"},
+		Param{"F", "F"},
+	}
+
+	check := func(name string, err, want error) {
+		if want == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", name, err)
+			}
+			return
+		}
+		pe, ok := err.(*ParamError)
+		if !ok {
+			t.Errorf("%s: want *ParamError, got %T (%v)", name, err, err)
+			return
+		}
+		if pe.Name != name || pe.Value != ps.ByName(name) || pe.Err != want {
+			t.Errorf("%s: wrong error: %#v", name, pe)
+		}
+	}
+
+	intTests := []struct {
+		name string
+		want int64
+		err  error
+	}{
+		{"int", -42, nil},
+		{"plus", 7, nil},
+		{"big", 9223372036854775807, nil},
+		{"overflow", 0, strconv.ErrRange},
+		{"underflow", 0, strconv.ErrRange},
+		{"text", 0, strconv.ErrSyntax},
+		{"float", 0, strconv.ErrSyntax},
+		{"empty", 0, strconv.ErrSyntax},
+		{"noKey", 0, ErrParamNotFound},
+	}
+	for _, test := range intTests {
+		i, err := ps.ParamInt64(test.name)
+		check(test.name, err, test.err)
+		if i != test.want {
+			t.Errorf("ParamInt64(%q) = %d, want %d", test.name, i, test.want)
+		}
+
+		if strconv.IntSize == 64 {
+			i, err := ps.ParamInt(test.name)
+			check(test.name, err, test.err)
+			if int64(i) != test.want {
+				t.Errorf("ParamInt(%q) = %d, want %d", test.name, i, test.want)
+			}
+		}
+	}
+
+	uintTests := []struct {
+		name string
+		want uint
+		err  error
+	}{
+		{"plus", 0, strconv.ErrSyntax},
+		{"one", 1, nil},
+		{"int", 0, strconv.ErrSyntax},
+		{"uintOverflow", 0, strconv.ErrRange},
+		{"empty", 0, strconv.ErrSyntax},
+		{"noKey", 0, ErrParamNotFound},
+	}
+	for _, test := range uintTests {
+		u, err := ps.ParamUint(test.name)
+		check(test.name, err, test.err)
+		if u != test.want {
+			t.Errorf("ParamUint(%q) = %d, want %d", test.name, u, test.want)
+		}
+	}
+
+	boolTests := []struct {
+		name string
+		want bool
+		err  error
+	}{
+		{"true", true, nil},
+		{"one", true, nil},
+		{"F", false, nil},
+		{"text", false, strconv.ErrSyntax},
+		{"empty", false, strconv.ErrSyntax},
+		{"noKey", false, ErrParamNotFound},
+	}
+	for _, test := range boolTests {
+		b, err := ps.ParamBool(test.name)
+		check(test.name, err, test.err)
+		if b != test.want {
+			t.Errorf("ParamBool(%q) = %t, want %t", test.name, b, test.want)
+		}
+	}
+}
+
+func TestParamError(t *testing.T) {
+	ps := Params{Param{"id", "abc"}}
+
+	_, err := ps.ParamInt("id")
+	if want := "parameter 'id': invalid value 'abc': invalid syntax"; err == nil || err.Error() != want {
+		t.Errorf("wrong error message: want %q, got %v", want, err)
+	}
+	if pe, ok := err.(*ParamError); !ok || pe.Unwrap() != strconv.ErrSyntax {
+		t.Errorf("wrong wrapped error: %v", err)
+	}
+
+	_, err = ps.ParamInt("noKey")
+	if want := "parameter 'noKey': parameter not found"; err == nil || err.Error() != want {
+		t.Errorf("wrong error message: want %q, got %v", want, err)
+	}
+}
+
+var benchParams = Params{
+	Param{"user", "gopher"},
+	Param{"repo", "httprouter"},
+	Param{"branch", "master"},
+	Param{"id", "42"},
+}
+
+func BenchmarkParamsByName(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchParams.ByName("id")
+	}
+}
+
+func BenchmarkParamsByNameFold(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchParams.ByNameFold("ID")
+	}
+}
+
+var benchMap map[string]string
+
+func BenchmarkParamsRange(b *testing.B) {
+	n := 0
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchParams.Range(func(key, value string) bool {
+			n += len(value)
+			return true
+		})
+	}
+}
+
+func BenchmarkParamsMap(b *testing.B) {
+	var m map[string]string
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m = benchParams.Map()
+	}
+	benchMap = m
+}
@@ -5,6 +5,8 @@
 
 package httprouter
 
+import "strings"
+
 // CleanPath is the URL version of path.Clean, it returns a canonical URL path
 // for p, eliminating . and .. elements.
 //
@@ -41,6 +43,70 @@ func CleanPath(p string) string {
 	}
 }
 
+// CleanPathStrict cleans p like CleanPath and additionally reports whether the
+// cleaned path differs from p, e.g. to decide whether a redirect is required.
+func CleanPathStrict(p string) (cleaned string, changed bool) {
+	cleaned = CleanPath(p)
+	return cleaned, cleaned != p
+}
+
+// CleanPathDecoded cleans p like CleanPath, but additionally treats the
+// percent-encoded dot %2e (or %2E) as '.' in path elements consisting only of
+// dots, e.g. /foo/%2e%2e/bar is cleaned to /bar.
+// It is meant for paths which are still percent-encoded, like URL.RawPath,
+// in which encoded dot segments would otherwise escape the rules of CleanPath.
+// All other percent-encoded characters are left as they are, including %2e
+// within other elements, like in /file%2etxt, and encoded slashes (%2f).
+func CleanPathDecoded(p string) string {
+	if strings.IndexByte(p, '%') < 0 {
+		return CleanPath(p)
+	}
+
+	buf := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		// Find the end of the element
+		j := i
+		for j < len(p) && p[j] != '/' {
+			j++
+		}
+
+		if dots := decodeDots(p[i:j]); dots != "" {
+			buf = append(buf, dots...)
+		} else {
+			buf = append(buf, p[i:j]...)
+		}
+		if j < len(p) {
+			buf = append(buf, '/')
+		}
+		i = j
+	}
+	return CleanPath(string(buf))
+}
+
+// Returns "." or ".." if the path element consists of one or two dots, either
+// literal or encoded as %2e. Otherwise an empty string is returned.
+func decodeDots(elem string) string {
+	dots := 0
+	for i := 0; i < len(elem); {
+		switch {
+		case elem[i] == '.':
+			i++
+		case len(elem)-i >= 3 && elem[i] == '%' && elem[i+1] == '2' && (elem[i+2] == 'e' || elem[i+2] == 'E'):
+			i += 3
+		default:
+			return ""
+		}
+		dots++
+	}
+	switch dots {
+	case 1:
+		return "."
+	case 2:
+		return ".."
+	}
+	return ""
+}
+
 func cleanPathStack64(p string) string {
 	buf := make([]byte, 0, 64)
 	return cleanPath(p, &buf)
@@ -146,6 +212,25 @@ func cleanPath(p string, buf *[]byte) string {
 	return string((*buf)[:w])
 }
 
+// Replaces multiple slashes in p with a single slash, like rule 1 of
+// CleanPath. Unlike CleanPath it neither eliminates . and .. elements nor adds
+// a leading slash. p is returned as is if it has no multiple slashes.
+func collapseSlashes(p string) string {
+	i := strings.Index(p, "//")
+	if i < 0 {
+		return p
+	}
+
+	buf := make([]byte, i+1, len(p)-1)
+	copy(buf, p[:i+1])
+	for r := i + 2; r < len(p); r++ {
+		if p[r] != '/' || buf[len(buf)-1] != '/' {
+			buf = append(buf, p[r])
+		}
+	}
+	return string(buf)
+}
+
 func bufApp(buf *[]byte, s string, w int, c byte) {
 	b := *buf
 	if len(b) == 0 {
@@ -160,3 +245,93 @@ func bufApp(buf *[]byte, s string, w int, c byte) {
 	}
 	b[w] = c
 }
+
+// Decodes the percent-encoded characters of s, like url.PathUnescape, which
+// requires Go 1.8. If keepSlash is true, encoded slashes (%2F) are left as
+// they are. Reports false if s contains an invalid escape.
+func unescape(s string, keepSlash bool) (string, bool) {
+	if strings.IndexByte(s, '%') < 0 {
+		return s, true
+	}
+
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			buf = append(buf, s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", false
+		}
+		hi, ok1 := unhex(s[i+1])
+		lo, ok2 := unhex(s[i+2])
+		if !ok1 || !ok2 {
+			return "", false
+		}
+		if c := hi<<4 | lo; c != '/' || !keepSlash {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, s[i:i+3]...)
+		}
+		i += 2
+	}
+	return string(buf), true
+}
+
+// Decodes the percent-encoded unreserved characters of the escaped path p
+// (letters, digits, '-', '.', '_' and '~'), which RFC 3986 considers equivalent
+// to their encoded form, e.g. /%61bout to /about. All other escapes, including
+// encoded slashes and invalid escapes, are left as they are. p is returned as
+// is if it has no such escape.
+func normalizeEscapes(p string) string {
+	i := strings.IndexByte(p, '%')
+	if i < 0 {
+		return p
+	}
+
+	var buf []byte
+	for ; i < len(p); i++ {
+		if p[i] != '%' || i+2 >= len(p) {
+			if buf != nil {
+				buf = append(buf, p[i])
+			}
+			continue
+		}
+		hi, ok1 := unhex(p[i+1])
+		lo, ok2 := unhex(p[i+2])
+		c := hi<<4 | lo
+		if !ok1 || !ok2 || !isUnreserved(c) {
+			if buf != nil {
+				buf = append(buf, p[i])
+			}
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, i, len(p))
+			copy(buf, p[:i])
+		}
+		buf = append(buf, c)
+		i += 2
+	}
+	if buf == nil {
+		return p
+	}
+	return string(buf)
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
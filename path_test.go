@@ -77,6 +77,144 @@ func TestPathClean(t *testing.T) {
 	}
 }
 
+func TestPathCleanStrict(t *testing.T) {
+	for _, test := range cleanTests {
+		s, changed := CleanPathStrict(test.path)
+		if s != test.result {
+			t.Errorf("CleanPathStrict(%q) = %q, want %q", test.path, s, test.result)
+		}
+		if changed != (test.path != test.result) {
+			t.Errorf("CleanPathStrict(%q): changed = %v", test.path, changed)
+		}
+	}
+
+	tests := []struct {
+		path    string
+		result  string
+		changed bool
+	}{
+		{"//a//b/../c", "/a/c", true},
+		{".", "/", true},
+		{"", "/", true},
+		{"/", "/", false},
+		{"/a/b/", "/a/b/", false},
+	}
+	for _, test := range tests {
+		s, changed := CleanPathStrict(test.path)
+		if s != test.result || changed != test.changed {
+			t.Errorf("CleanPathStrict(%q) = %q, %v, want %q, %v", test.path, s, changed, test.result, test.changed)
+		}
+	}
+}
+
+func TestPathCleanDecoded(t *testing.T) {
+	for _, test := range cleanTests {
+		if s := CleanPathDecoded(test.path); s != test.result {
+			t.Errorf("CleanPathDecoded(%q) = %q, want %q", test.path, s, test.result)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		result string
+	}{
+		// Encoded dot segments are removed
+		{"/foo/%2e%2e/bar", "/bar"},
+		{"/foo/%2E%2E/bar", "/bar"},
+		{"/foo/%2e./bar", "/bar"},
+		{"/foo/.%2e/bar", "/bar"},
+		{"/foo/%2e/bar", "/foo/bar"},
+		{"/foo/%2e%2e", "/"},
+		{"/foo/%2e%2e/", "/"},
+		{"/%2e%2e/%2e%2e/etc/passwd", "/etc/passwd"},
+		{"%2e%2e/etc/passwd", "/etc/passwd"},
+		{"/static/%2e%2e//%2e%2e/secret", "/secret"},
+
+		// Other encodings are left intact
+		{"/foo/%2e%2e%2fbar", "/foo/%2e%2e%2fbar"},
+		{"/foo/%2e%2e%5cbar", "/foo/%2e%2e%5cbar"},
+		{"/foo/%252e%252e/bar", "/foo/%252e%252e/bar"},
+		{"/foo/%2e%2e%2e/bar", "/foo/%2e%2e%2e/bar"},
+		{"/file%2etxt", "/file%2etxt"},
+		{"/a%20b/%2e/c", "/a%20b/c"},
+		{"/foo/%2", "/foo/%2"},
+		{"/foo/%2e%2", "/foo/%2e%2"},
+		{"/foo/%", "/foo/%"},
+	}
+	for _, test := range tests {
+		if s := CleanPathDecoded(test.path); s != test.result {
+			t.Errorf("CleanPathDecoded(%q) = %q, want %q", test.path, s, test.result)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		s         string
+		keepSlash bool
+		result    string
+		ok        bool
+	}{
+		{"", false, "", true},
+		{"abc", false, "abc", true},
+		{"john%20doe", false, "john doe", true},
+		{"a%2Fb%2fc", false, "a/b/c", true},
+		{"a%2Fb%2fc", true, "a%2Fb%2fc", true},
+		{"a%2Fb%20c", true, "a%2Fb c", true},
+		{"caf%C3%A9", false, "caf\u00e9", true},
+		{"a+b", false, "a+b", true},
+		{"%", false, "", false},
+		{"%2", true, "", false},
+		{"%zz", false, "", false},
+		{"a%2", false, "", false},
+	}
+	for _, test := range tests {
+		if result, ok := unescape(test.s, test.keepSlash); result != test.result || ok != test.ok {
+			t.Errorf("unescape(%q, %v) = %q, %v, want %q, %v", test.s, test.keepSlash, result, ok, test.result, test.ok)
+		}
+	}
+}
+
+func TestNormalizeEscapes(t *testing.T) {
+	tests := []struct {
+		path, result string
+	}{
+		{"", ""},
+		{"/about", "/about"},
+		{"/%61bout", "/about"},
+		{"/%41%7a%30%2D%2e%5F%7E", "/Az0-._~"},
+		{"/caf%C3%A9", "/caf%C3%A9"},
+		{"/a%2Fb%20c", "/a%2Fb%20c"},
+		{"/%zz%6", "/%zz%6"},
+		{"/%%61", "/%a"},
+	}
+	for _, test := range tests {
+		if result := normalizeEscapes(test.path); result != test.result {
+			t.Errorf("normalizeEscapes(%q) = %q, want %q", test.path, result, test.result)
+		}
+	}
+}
+
+func TestCollapseSlashes(t *testing.T) {
+	tests := []struct {
+		path, result string
+	}{
+		{"", ""},
+		{"/", "/"},
+		{"//", "/"},
+		{"/a/b/", "/a/b/"},
+		{"//api//users", "/api/users"},
+		{"/a///b////", "/a/b/"},
+		{"/a//./../b", "/a/./../b"},
+		{"a//b", "a/b"},
+	}
+	for _, test := range tests {
+		if result := collapseSlashes(test.path); result != test.result {
+			t.Errorf("collapseSlashes(%q) = %q, want %q", test.path, result, test.result)
+		}
+	}
+}
+
 func TestPathCleanMallocs(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping malloc count in short mode")
@@ -0,0 +1,145 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HandleQuery registers a new request handle with the given path and method,
+// like Handle, which only handles requests whose query contains the given
+// key. Only the presence of the key is matched, not its value, e.g. a handle
+// registered for the key "q" handles /search?q=, /search?q=go and /search?q
+// alike.
+// Several handles with different keys can be registered for the same method
+// and path, the first one in registration order whose key is present handles
+// the request. A handle registered for the method and path with Handle (or
+// any other way, e.g. through a Group) handles the requests without any of
+// the keys. It must be registered after the first HandleQuery call for the
+// path, otherwise HandleQuery panics since the path is already registered.
+// Requests matching neither are treated like requests for a path without any
+// route, e.g. answered by NotFound.
+// Routes registered with Handle only are not affected at all.
+func (r *Router) HandleQuery(method, path, key string, handle Handle) {
+	if key == "" {
+		panic("query key must not be empty in path '" + path + "'")
+	}
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+
+	id := method + " " + path
+	if qr := r.loadTrees().queries[id]; qr != nil {
+		for _, k := range qr.keys {
+			if k == key {
+				panic("a handle is already registered for query key '" + key +
+					"' in path '" + path + "'")
+			}
+		}
+		qr.keys = append(qr.keys, key)
+		qr.handles = append(qr.handles, handle)
+		return
+	}
+
+	qr := &queryRoute{r: r, id: id, keys: []string{key}, handles: []Handle{handle}}
+	r.Handle(method, path, qr.serve)
+	t := r.writableTrees()
+	if t.queries == nil {
+		t.queries = make(map[string]*queryRoute)
+	}
+	t.queries[id] = qr
+}
+
+// HandleQuery registers a new request handle with the given method and the
+// path prefixed by the group prefix, which only handles requests whose query
+// contains the given key. The handle is wrapped by the middleware of the
+// group. See Router.HandleQuery.
+func (g *Group) HandleQuery(method, path, key string, handle Handle) {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	g.r.HandleQuery(method, g.prefix+path, key, g.wrap(handle))
+}
+
+// The routes registered with HandleQuery for a method and path. The handle
+// in the tree is the serve method of the first queryRoute of the path, which
+// serves with the one in the current trees, see methodTrees.setFallback.
+type queryRoute struct {
+	r       *Router
+	id      string // method and path
+	keys    []string
+	handles []Handle
+
+	// Handle of the route registered without query key, if any
+	fallback Handle
+}
+
+func (qr *queryRoute) serve(w http.ResponseWriter, req *http.Request, ps Params) {
+	if current := qr.r.loadTrees().queries[qr.id]; current != nil {
+		qr = current
+	}
+	for i, key := range qr.keys {
+		if hasQueryKey(req.URL.RawQuery, key) {
+			qr.handles[i](w, req, ps)
+			return
+		}
+	}
+	if qr.fallback != nil {
+		qr.fallback(w, req, ps)
+		return
+	}
+	path, _ := qr.r.requestPath(req)
+	qr.r.notFound(w, req, path, nil)
+}
+
+// Sets the handle of the route without query key or media type (see
+// HandleAccept) of the method and path, if the path has query or accept
+// routes and the handle is not set yet. Reports whether it was set.
+// The query or accept route is replaced by a copy with the handle, so that
+// the handle is published atomically along with a copy of the trees, see
+// methodTrees.copy.
+func (t *methodTrees) setFallback(method, path string, handle Handle) bool {
+	id := method + " " + path
+	if qr := t.queries[id]; qr != nil && qr.fallback == nil {
+		c := *qr
+		c.fallback = handle
+		t.queries[id] = &c
+		return true
+	}
+	if ar := t.accepts[id]; ar != nil && ar.fallback == nil {
+		c := *ar
+		c.fallback = handle
+		t.accepts[id] = &c
+		return true
+	}
+	return false
+}
+
+// Reports whether the raw query contains the key, without parsing the whole
+// query like url.URL.Query does.
+func hasQueryKey(query, key string) bool {
+	for query != "" {
+		var pair string
+		if i := strings.IndexByte(query, '&'); i >= 0 {
+			pair, query = query[:i], query[i+1:]
+		} else {
+			pair, query = query, ""
+		}
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			pair = pair[:i]
+		}
+		if pair == key {
+			return true
+		}
+		if strings.IndexByte(pair, '%') >= 0 || strings.IndexByte(pair, '+') >= 0 {
+			if k, err := url.QueryUnescape(pair); err == nil && k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
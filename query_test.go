@@ -0,0 +1,178 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterHandleQuery(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("id")
+		}
+	}
+
+	router := New()
+	router.HandleQuery(http.MethodGet, "/search", "q", handle("query"))
+	router.HandleQuery(http.MethodGet, "/search", "tag", handle("tag"))
+	router.GET("/search", handle("plain"))
+	router.HandleQuery(http.MethodGet, "/users/:id", "full name", handle("full"))
+	router.Group("/api").HandleQuery(http.MethodGet, "/items", "q", handle("api"))
+
+	tests := []struct {
+		url    string
+		routed string
+		code   int
+	}{
+		{"/search?q=go", "query", http.StatusOK},
+		{"/search?q=", "query", http.StatusOK},
+		{"/search?q", "query", http.StatusOK},
+		{"/search?page=2&q=go", "query", http.StatusOK},
+		{"/search?tag=x&q=go", "query", http.StatusOK},
+		{"/search?tag=x", "tag", http.StatusOK},
+		{"/search", "plain", http.StatusOK},
+		{"/search?qq=go&page=q", "plain", http.StatusOK},
+		{"/users/1?full+name", "full1", http.StatusOK},
+		{"/users/2?full%20name=1", "full2", http.StatusOK},
+		{"/users/3", "", http.StatusNotFound},
+		{"/api/items?q", "api", http.StatusOK},
+		{"/api/items", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		router.ServeHTTP(w, r)
+		if routed != test.routed || w.Code != test.code {
+			t.Errorf("%s: routed to %q with code %d, want %q with code %d",
+				test.url, routed, w.Code, test.routed, test.code)
+		}
+	}
+
+	// Requests matching no query route are handled like unknown paths
+	notFound := false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notFound = true
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/users/3", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !notFound {
+		t.Error("NotFound handler was not called")
+	}
+}
+
+func TestRouterHandleBatchQueryFallback(t *testing.T) {
+	handle := func(body string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Write([]byte(body))
+		}
+	}
+	router := New()
+	router.HandleQuery(http.MethodGet, "/search", "q", handle("query"))
+
+	// The route without query key is published along with the other routes
+	// of the batch
+	errs := make(chan string, 1)
+	go func() {
+		defer close(errs)
+		for {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, "/search", nil)
+			router.ServeHTTP(w, r)
+			if w.Body.String() != "fallback" {
+				continue
+			}
+			w = httptest.NewRecorder()
+			r, _ = http.NewRequest(http.MethodGet, "/new", nil)
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				errs <- "route without query key served before the batch was published"
+			}
+			return
+		}
+	}()
+	err := router.HandleBatch([]RouteInfo{
+		{http.MethodGet, "/search", handle("fallback")},
+		{http.MethodGet, "/new", handle("new")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRouterHandleQueryInvalid(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.HandleQuery(http.MethodGet, "/search", "q", handle)
+	router.GET("/plain", handle)
+
+	for name, register := range map[string]func(){
+		"empty key":     func() { router.HandleQuery(http.MethodGet, "/search", "", handle) },
+		"nil handle":    func() { router.HandleQuery(http.MethodGet, "/search", "tag", nil) },
+		"duplicate key": func() { router.HandleQuery(http.MethodGet, "/search", "q", handle) },
+		"after plain":   func() { router.HandleQuery(http.MethodGet, "/plain", "q", handle) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Errorf("%s: no panic", name)
+		}
+	}
+
+	// A failed batch does not keep the route without query key
+	err := router.HandleBatch([]RouteInfo{
+		{http.MethodGet, "/search", handle},
+		{http.MethodGet, "/plain", handle},
+	})
+	if err == nil {
+		t.Fatal("HandleBatch registered a duplicate route")
+	}
+	if qr := router.loadTrees().queries["GET /search"]; qr.fallback != nil {
+		t.Error("HandleBatch kept the route of the failed batch")
+	}
+}
+
+func TestHasQueryKey(t *testing.T) {
+	tests := []struct {
+		query, key string
+		found      bool
+	}{
+		{"", "q", false},
+		{"q", "q", true},
+		{"q=", "q", true},
+		{"a=1&q=2", "q", true},
+		{"a=q", "q", false},
+		{"qq=1", "q", false},
+		{"a%20b=1", "a b", true},
+		{"a+b", "a b", true},
+		{"%zz=1", "%zz", true},
+		{"&&q", "q", true},
+	}
+	for _, test := range tests {
+		if found := hasQueryKey(test.query, test.key); found != test.found {
+			t.Errorf("hasQueryKey(%q, %q) = %v, want %v", test.query, test.key, found, test.found)
+		}
+	}
+}
+
+func BenchmarkHandleQuery(b *testing.B) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.HandleQuery(http.MethodGet, "/search", "q", handle)
+	router.GET("/search", handle)
+
+	r, _ := http.NewRequest(http.MethodGet, "/search?page=2&q=go", nil)
+	w := new(mockResponseWriter)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
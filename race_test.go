@@ -0,0 +1,12 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build race
+// +build race
+
+package httprouter
+
+// The race detector makes sync.Pool drop items at random, so tests counting
+// the allocations of pooled Params are skipped.
+const raceEnabled = true
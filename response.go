@@ -0,0 +1,127 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// ResponseWriter is implemented by the http.ResponseWriter the router passes
+// to handles and panic handlers if a PanicHandler is set.
+// It reports whether the response was already written, e.g. to decide whether
+// an error response can still be sent.
+type ResponseWriter interface {
+	http.ResponseWriter
+
+	// Written reports whether the header of the response was written.
+	Written() bool
+
+	// Status returns the status code of the response, or 0 if the header
+	// was not written yet.
+	Status() int
+}
+
+// Pool of the responseWriters wrapping the http.ResponseWriter of requests
+// served with a panic handler
+var responseWriterPool = sync.Pool{
+	New: func() interface{} { return new(responseWriter) },
+}
+
+// responseWriter tracks the status of the wrapped http.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+
+	// If set, all further writes are discarded
+	discard bool
+
+	// Set once the connection was hijacked
+	hijacked bool
+}
+
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		// Informational responses may be followed by the final one
+		if !w.discard {
+			w.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	if w.status != 0 {
+		// Superfluous call
+		return
+	}
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.discard {
+		return len(b), nil
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ReadFrom implements io.ReaderFrom, so that the wrapped http.ResponseWriter
+// can still send files with sendfile, e.g. for ServeFiles.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.discard {
+		return io.Copy(ioutil.Discard, src)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, src)
+}
+
+// Flush implements http.Flusher, if the wrapped http.ResponseWriter does.
+func (w *responseWriter) Flush() {
+	if w.discard {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, if the wrapped http.ResponseWriter does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := h.Hijack()
+		if err == nil {
+			w.hijacked = true
+		}
+		return conn, rw, err
+	}
+	return nil, nil, errors.New("httprouter: ResponseWriter does not implement http.Hijacker")
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, see http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
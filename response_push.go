@@ -0,0 +1,23 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import "net/http"
+
+// Push implements http.Pusher, if the wrapped http.ResponseWriter does.
+// Pushes after the response was discarded are dropped as well. Unlike Write,
+// Push does not write the header of the response, so the status is not set.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.discard {
+		return nil
+	}
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
@@ -0,0 +1,49 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.8
+// +build go1.8
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pushRecorder records the targets passed to Push.
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	targets []string
+}
+
+func (w *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	w.targets = append(w.targets, target)
+	return nil
+}
+
+func TestResponseWriterPush(t *testing.T) {
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := &responseWriter{ResponseWriter: rec}
+	if err := w.Push("/app.js", nil); err != nil {
+		t.Errorf("Push failed: %v", err)
+	}
+	if len(rec.targets) != 1 || rec.targets[0] != "/app.js" {
+		t.Errorf("Push was not forwarded: %v", rec.targets)
+	}
+	if w.Written() {
+		t.Error("Push wrote the header")
+	}
+
+	w.discard = true
+	if err := w.Push("/app.css", nil); err != nil || len(rec.targets) != 1 {
+		t.Errorf("discarded Push: got %v, targets %v", err, rec.targets)
+	}
+
+	w = &responseWriter{ResponseWriter: httptest.NewRecorder()}
+	if err := w.Push("/app.js", nil); err != http.ErrNotSupported {
+		t.Errorf("Push of non-Pusher: got %v, want %v", err, http.ErrNotSupported)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouterPanicAfterWrite(t *testing.T) {
+	var written bool
+	var status int
+
+	router := New()
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		rw, ok := w.(ResponseWriter)
+		if !ok {
+			t.Fatal("panic handler did not get a ResponseWriter")
+		}
+		written, status = rw.Written(), rw.Status()
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+	router.GET("/stream", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		panic("oops!")
+	})
+	router.GET("/body", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("partial"))
+		panic("oops!")
+	})
+	router.GET("/early", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Early", "1")
+		panic("oops!")
+	})
+
+	tests := []struct {
+		path    string
+		code    int
+		body    string
+		written bool
+		status  int
+	}{
+		{"/stream", http.StatusAccepted, "partial", true, http.StatusAccepted},
+		{"/body", http.StatusOK, "partial", true, http.StatusOK},
+		{"/early", http.StatusInternalServerError, "internal error\n", false, 0},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: got %d %q, want %d %q", test.path, w.Code, w.Body.String(), test.code, test.body)
+		}
+		if written != test.written || status != test.status {
+			t.Errorf("%s: Written()=%v, Status()=%d, want %v, %d", test.path, written, status, test.written, test.status)
+		}
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &responseWriter{ResponseWriter: rec}
+	if w.Written() || w.Status() != 0 {
+		t.Fatalf("new ResponseWriter: Written()=%v, Status()=%d", w.Written(), w.Status())
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusInternalServerError)
+	if !w.Written() || w.Status() != http.StatusCreated {
+		t.Errorf("Written()=%v, Status()=%d, want true, %d", w.Written(), w.Status(), http.StatusCreated)
+	}
+	if rec.Code != http.StatusCreated {
+		t.Errorf("superfluous WriteHeader call was forwarded: %d", rec.Code)
+	}
+
+	// ReadFrom of the wrapped ResponseWriter is used
+	rf := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w = &responseWriter{ResponseWriter: rf}
+	if n, err := w.ReadFrom(strings.NewReader("body")); n != 4 || err != nil {
+		t.Errorf("ReadFrom: got %d, %v", n, err)
+	}
+	if len(rf.srcs) != 1 || rf.Body.String() != "body" || w.Status() != http.StatusOK {
+		t.Errorf("ReadFrom: got %d calls, body %q, Status()=%d", len(rf.srcs), rf.Body.String(), w.Status())
+	}
+	w.discard = true
+	if n, err := w.ReadFrom(strings.NewReader("more")); n != 4 || err != nil || rf.Body.String() != "body" {
+		t.Errorf("discarded ReadFrom: got %d, %v, body %q", n, err, rf.Body.String())
+	}
+	w = &responseWriter{ResponseWriter: rec}
+
+	if w.Unwrap() != rec {
+		t.Error("Unwrap did not return the wrapped ResponseWriter")
+	}
+	if _, _, err := w.Hijack(); err == nil {
+		t.Error("Hijack of non-Hijacker did not fail")
+	}
+}
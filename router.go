@@ -53,6 +53,24 @@
 //   /blog/go/                           no match
 //   /blog/go/request-routers/comments   no match
 //
+// Named and catch-all parameters can be restricted by a regular expression,
+// which is given in parentheses directly after the name. The expression must
+// match the whole value, otherwise the route does not match at all:
+//  Path: /user/:id(\d+)
+//
+//  Requests:
+//   /user/42                            match: id="42"
+//   /user/gopher                        no match
+//
+// A named parameter at the end of the path can be made optional by appending
+// a '?'. The path without the parameter then matches as well, the value of
+// the parameter is empty in this case:
+//  Path: /files/:name?
+//
+//  Requests:
+//   /files/LICENSE                      match: name="LICENSE"
+//   /files                              match: name=""
+//
 // Catch-all parameters match anything until the path end, including the
 // directory index (the '/' before the catch-all). Since they match anything
 // until the end, catch-all parameters must always be the final path element.
@@ -64,6 +82,14 @@
 //   /files/templates/article.html       match: filepath="/templates/article.html"
 //   /files                              no match, but the router would redirect
 //
+// The only exception is a static suffix, which must then match the end of the
+// path. The catch-all parameter matches everything before it:
+//  Path: /proxy/*target/info
+//
+//  Requests:
+//   /proxy/a/b/info                     match: target="/a/b"
+//   /proxy/info                         no match
+//
 // The value of parameters is saved as a slice of the Param struct, consisting
 // each of a key and a value. The slice is passed to the Handle func as a third
 // parameter.
@@ -78,9 +104,15 @@ package httprouter
 
 import (
 	"context"
+	"errors"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Handle is a function that can be registered to a route to handle HTTP
@@ -88,6 +120,10 @@ import (
 // wildcards (path variables).
 type Handle func(http.ResponseWriter, *http.Request, Params)
 
+// HandleC is a request handle which explicitly receives the context of the
+// request as its first parameter. See Router.HandleC.
+type HandleC func(context.Context, http.ResponseWriter, *http.Request, Params)
+
 // Param is a single URL parameter, consisting of a key and a value.
 type Param struct {
 	Key   string
@@ -110,6 +146,17 @@ func (ps Params) ByName(name string) string {
 	return ""
 }
 
+// MatchedRoutePathParam is the Param name under which the path of the matched
+// route is stored, if Router.SaveMatchedRoutePath is set.
+var MatchedRoutePathParam = "$matchedRoutePath"
+
+// MatchedRoutePath retrieves the path of the matched route, e.g. /user/:name.
+// Router.SaveMatchedRoutePath must be enabled, otherwise this function always
+// returns an empty string.
+func (ps Params) MatchedRoutePath() string {
+	return ps.ByName(MatchedRoutePathParam)
+}
+
 type paramsKey struct{}
 
 // ParamsKey is the request context key under which URL params are stored.
@@ -122,19 +169,120 @@ func ParamsFromContext(ctx context.Context) Params {
 	return p
 }
 
+type allowedKey struct{}
+
+// AllowedFromContext returns the methods which are allowed for the path of an
+// OPTIONS request handled by a registered OPTIONS route, in the order of the
+// Allow header of automatic OPTIONS replies, see Router.Allowed. OPTIONS is
+// always included. It returns nil for other requests.
+// Unlike with automatic replies, the router does not set the Allow header for
+// registered OPTIONS routes, nor does it call GlobalOPTIONS or answer CORS
+// preflight requests. The route can use the methods to do so itself, e.g.:
+//
+//	w.Header().Set("Allow", strings.Join(httprouter.AllowedFromContext(req.Context()), ", "))
+func AllowedFromContext(ctx context.Context) []string {
+	allowed, _ := ctx.Value(allowedKey{}).([]string)
+	return allowed
+}
+
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Router struct {
-	trees map[string]*node
+	// The trees of the methods, see methodTrees. A *methodTrees is stored.
+	trees atomic.Value
+
+	// Serializes HandleSafe
+	mu sync.Mutex
+
+	// Set to 1 by BeginDraining, accessed atomically
+	draining int32
+
+	// Custom methods, see RegisterMethod
+	methods map[string]bool
+
+	// NotFound handlers for path prefixes, longest prefix first, see
+	// NotFoundFor
+	notFoundFor []prefixHandler
+
+	// Handlers tried before NotFound, see AddNotFoundHandler
+	notFoundChain []http.Handler
+
+	// Routers for specific hosts, see Host
+	hosts        map[string]*Router
+	hostPatterns []hostPattern
+	parent       *Router
 
 	paramsPool sync.Pool
-	maxParams  uint16
+
+	// If enabled, the Params passed to the handles by ServeHTTP are taken from
+	// a pool and are reused for later requests after the handle returned.
+	// This avoids an allocation per request for routes with parameters, but
+	// the Params, including the values of single Param elements, must then not
+	// be retained or used after the handle returned, e.g. in a goroutine.
+	// Copy the values instead, or disable the pool if handles retain them.
+	// Params returned by Lookup are never reused.
+	// Enabled by New.
+	UseParamsPool bool
+
+	// If enabled, the path of the matched route (e.g. /user/:name) is added to
+	// the Params under the key MatchedRoutePathParam before the handle is
+	// called. It can be retrieved with Params.MatchedRoutePath.
+	// Routes should be registered after this option is enabled, so that the
+	// preallocated Params have room for the additional value.
+	SaveMatchedRoutePath bool
+
+	// If enabled, the Params of the matched route are stored in the request
+	// context under ParamsKey before the handle is called, like the Handler
+	// and HandlerFunc adapters do. This way they are accessible via
+	// ParamsFromContext for any code which only gets the *http.Request, e.g.
+	// http.Handler middleware wrapping the handle.
+	// Nothing is stored for routes without params, thus no additional
+	// allocations are made for them.
+	// The request passed to PanicHandler has the Params in its context as
+	// well, if the panic occurred in a handle. Together with
+	// SaveMatchedRoutePath, the panic handler can thus report the route via
+	// ParamsFromContext(req.Context()).MatchedRoutePath().
+	// Lookup is not affected, as it does not deal with requests.
+	UseContext bool
+
+	// If enabled, the escaped path of the request (see url.URL.EscapedPath)
+	// is routed instead of the decoded one, and the values of the params are
+	// unescaped afterwards. This way a param value may contain an escaped
+	// slash, e.g. /files/a%2Fb matches /files/:name, see DecodeSlashInParams.
+	// Catch-all values are unescaped as a whole, their slashes are preserved.
+	// The static parts of the routes must be registered in their escaped
+	// form and constraints are checked against the escaped values.
+	// Requests with an invalid escape in a param value are handled by
+	// InvalidPath.
+	UnescapePathParams bool
+
+	// Configurable http.Handler which is called if the value of a param or
+	// catch-all parameter of the matched route can not be unescaped, see
+	// UnescapePathParams. If it is not set, http.Error with
+	// http.StatusBadRequest is used.
+	// The escaped path of a request is always validly escaped, thus this only
+	// happens if the path is modified before routing, e.g. by a PathCleaner.
+	InvalidPath http.Handler
+
+	// If enabled together with UnescapePathParams, escaped slashes (%2F) in
+	// param values are decoded as well, e.g. /files/a%2Fb matches
+	// /files/:name with the value "a/b". Otherwise they are left as they are,
+	// i.e. the value is "a%2Fb".
+	// Decoded values may contain slashes and thus dot segments, e.g. the value
+	// of ..%2F..%2Fetc is "../../etc". Such values must not be used to build
+	// file system paths or URLs without cleaning or validating them first.
+	DecodeSlashInParams bool
 
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
 	// client is redirected to /foo with http status code 301 for GET requests
 	// and 308 for all other request methods.
+	// The redirect target is the request path with the trailing slash removed
+	// or added, and it is only recommended if a route matches the target. The
+	// root path / therefore is only redirected to (from an empty path) but never
+	// away from, and a path like // is not redirected to / unless a route for
+	// the latter exists and matches.
 	RedirectTrailingSlash bool
 
 	// If enabled, the router tries to fix the current request path, if no
@@ -145,9 +293,162 @@ type Router struct {
 	// to the corrected path with status code 301 for GET requests and 308 for
 	// all other request methods.
 	// For example /FOO and /..//Foo could be redirected to /foo.
+	// With UnescapePathParams, percent-encoded letters, digits and the
+	// characters '-', '.', '_' and '~' are decoded before, so /%61bout could be
+	// redirected to /about. Other escapes, like encoded slashes, are kept.
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// Configurable function which cleans the request path for
+	// RedirectFixedPath, e.g. to additionally strip a locale prefix. It is
+	// called instead of CleanPath (CleanPathDecoded with
+	// UnescapePathParams), and the router redirects to the route found for
+	// its result, i.e. to a path which may differ from the request path in
+	// more than the removed path elements and the case.
+	// If nil, CleanPath is used.
+	PathCleaner func(path string) string
+
+	// If enabled, the router checks before each redirect made because of
+	// RedirectTrailingSlash or RedirectFixedPath whether the request for the
+	// redirect target would be routed to a handle directly. The target is
+	// routed like any request path for this, e.g. rewritten by PathRewrite
+	// and cleaned by the PathCleaner with CleanPathBeforeRouting. If it would
+	// not be, e.g. because it would be redirected again by a misconfigured
+	// PathCleaner, the request is handled like one without a route instead,
+	// e.g. by NotFound, to prevent a redirect loop.
+	DetectRedirectLoop bool
+
+	// If enabled, the request path is cleaned like for RedirectFixedPath
+	// (see PathCleaner) before the routes are looked up, and the cleaned path
+	// is routed without a redirect. The URL of the request is not modified,
+	// so handles still see the original path.
+	// Since for example /a/../b then matches the route /b directly, the
+	// fixed path redirect only takes effect for requests whose cleaned path
+	// has no route, e.g. because of its case.
+	// Like all redirects, this does not apply to CONNECT requests.
+	// Lookup and LookupDetailed do not clean the path.
+	CleanPathBeforeRouting bool
+
+	// Configurable function which rewrites the request path before it is
+	// routed, e.g. to strip a prefix added by a proxy:
+	//
+	//	router.PathRewrite = func(path string) string {
+	//		return strings.TrimPrefix(path, "/service-a")
+	//	}
+	//
+	// It is called with the path of the request URL (the escaped path with
+	// UnescapePathParams) before it is cleaned (see CleanPathBeforeRouting)
+	// and looked up. Handles see the original request URL, unless
+	// RewriteURLPath is enabled.
+	// If the result differs from the path, no redirects are made for the
+	// request (see RedirectTrailingSlash and RedirectFixedPath), since the
+	// path the client would have to request can not be derived from the
+	// rewritten one.
+	PathRewrite func(path string) string
+
+	// If enabled, the path of the URL of requests rewritten by PathRewrite is
+	// replaced by the routed path, so handles see the rewritten path. The
+	// request is copied for this, the original one is not modified.
+	RewriteURLPath bool
+
+	// If enabled, the static parts of request paths are matched
+	// case-insensitively against the routes, e.g. /Users/Bob matches the route
+	// /users/:name, without a redirect. Values of wildcards keep their
+	// original case.
+	// Only ASCII letters are folded. The static parts of the routes are
+	// lowercased on registration, therefore this option must be enabled before
+	// routes are registered.
+	CaseInsensitive bool
+
+	// If enabled, routes can only be registered for the standard methods of
+	// net/http, MethodWildcard and the custom methods registered with
+	// RegisterMethod. This way typos like GTE are rejected instead of creating
+	// a tree no request is routed to. Registering a route for another method
+	// then panics, or fails with an error for TryHandle.
+	StrictMethods bool
+
+	// Overrides the status code of the redirects made because of
+	// RedirectTrailingSlash and RedirectFixedPath, e.g.
+	// http.StatusPermanentRedirect to preserve the method for all requests.
+	// Only 301, 302, 307 and 308 are valid, the router panics on the first
+	// redirect otherwise. If 0, the default codes are used.
+	RedirectStatusCode int
+
+	// Override the status code of the redirects made because of
+	// RedirectTrailingSlash for GET and HEAD requests, respectively for
+	// requests with all other methods, independently of each other, e.g. to
+	// answer GET requests with http.StatusFound while other methods keep
+	// http.StatusPermanentRedirect. They take precedence over
+	// RedirectStatusCode and are validated like it. If 0, the code is that of
+	// the other redirects, see RedirectStatusCode.
+	TrailingSlashRedirectCodeGET   int
+	TrailingSlashRedirectCodeWrite int
+
+	// If greater than 0, requests with a longer path are rejected with
+	// http.StatusRequestURITooLong before they are routed, and before
+	// RedirectFixedPath cleans the path.
+	MaxPathLength int
+
+	// If greater than 0, registering a route with more parameters (named and
+	// catch-all) panics, or fails with an error for TryHandle, e.g. to catch
+	// generated routes which would make every request of the method allocate
+	// large Params. Routes registered before it is set are not checked.
+	// Independently of it, a route may have at most 65534 parameters.
+	MaxParams int
+
+	// If enabled, requests whose decoded path contains a control character,
+	// i.e. a byte below 0x20 (including NUL and tab) or DEL (0x7F), are
+	// rejected with http.StatusBadRequest before they are routed.
+	// Enabled by New.
+	RejectControlChars bool
+
+	// If enabled, the context of the request is checked after a route was
+	// matched. If it is already done, e.g. because the client closed the
+	// connection, the handle is not called. Instead ContextCanceled is
+	// called, or the status code 499 (Client Closed Request) is written if it
+	// is not set.
+	CheckContextCanceled bool
+
+	// Configurable http.Handler which is called for matched requests whose
+	// context is done, see CheckContextCanceled.
+	ContextCanceled http.Handler
+
+	// Configurable http.Handler which is called after the handle of a matched
+	// route returned without writing anything, neither a header nor a body,
+	// e.g. to send http.StatusInternalServerError instead of the empty 200
+	// response net/http would send. Responses of hijacked connections are
+	// left alone. If nil, responses are not checked.
+	// The ResponseWriter passed to the handle then tracks whether it was
+	// written to, like the one passed with a PanicHandler.
+	EmptyResponseHandler http.Handler
+
+	// If enabled, a request for a path without a route is handled directly by
+	// the route for the path with (without) a trailing slash, if one exists,
+	// instead of being redirected. The request URL is not modified.
+	// It takes precedence over RedirectTrailingSlash. A route registered for
+	// the exact path always wins.
+	IgnoreTrailingSlash bool
+
+	// If enabled, a request for a path without a route, which contains
+	// multiple consecutive slashes, is handled directly by the route for the
+	// path with single slashes, if one exists, instead of being redirected by
+	// RedirectFixedPath. For example //api//users is then handled by the
+	// route /api/users. The request URL is not modified.
+	// Only the slashes are collapsed, . and .. elements are not eliminated like
+	// by CleanPath. A route registered for the exact path always wins.
+	// The value of a catch-all parameter keeps the slashes of the request
+	// path, e.g. //src//a//b yields /a//b for the route /src/*path.
+	CollapseSlashes bool
+
+	// If enabled, the values of catch-all parameters omit the leading slash,
+	// e.g. for the route /src/*filepath the request /src/css/main.css yields
+	// the value css/main.css instead of /css/main.css, and /src/ yields an
+	// empty value instead of /. This applies to ServeHTTP and Lookup.
+	// Constraints of catch-all parameters are still checked against the value
+	// with the leading slash.
+	// The file serving functions, e.g. ServeFiles, and Mount are not affected.
+	CatchAllNoLeadingSlash bool
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -157,59 +458,195 @@ type Router struct {
 	HandleMethodNotAllowed bool
 
 	// If enabled, the router automatically replies to OPTIONS requests.
-	// Custom OPTIONS handlers take priority over automatic replies.
+	// Custom OPTIONS handlers take priority over automatic replies. They can
+	// retrieve the allowed methods with AllowedFromContext.
 	HandleOPTIONS bool
 
+	// If enabled, HEAD requests are handled by the GET route of the path if
+	// no HEAD route matches it. Explicitly registered HEAD routes take
+	// priority. The http.Server discards the body written by the handle for
+	// HEAD requests. The Allow header of paths with a GET route includes HEAD.
+	// It must be set before the routes are registered.
+	AutoHEAD bool
+
 	// An optional http.Handler that is called on automatic OPTIONS requests.
 	// The handler is only called if HandleOPTIONS is true and no OPTIONS
 	// handler for the specific path was set.
 	// The "Allowed" header is set before calling the handler.
 	GlobalOPTIONS http.Handler
 
-	// Cached value of global (*) allowed methods
-	globalAllowed string
+	// An optional CORS configuration. If set, automatic replies to CORS
+	// preflight requests for paths with registered handles additionally
+	// contain the CORS headers, e.g. Access-Control-Allow-Methods.
+	// The headers are set before GlobalOPTIONS is called.
+	CORS *CORSConfig
+
+	// If set, the method of POST requests is overridden by the value of the
+	// request header with this name, e.g. "X-HTTP-Method-Override", before
+	// the request is routed.
+	// Only PUT, PATCH and DELETE are accepted as values, other values are
+	// ignored.
+	MethodOverrideHeader string
+
+	// Like MethodOverrideHeader, but the method is taken from the form field
+	// with this name in the request body, e.g. "_method". A value of the
+	// header takes precedence.
+	MethodOverrideField string
 
 	// Configurable http.Handler which is called when no matching route is
 	// found. If it is not set, http.NotFound is used.
+	// Handlers added with AddNotFoundHandler are tried first.
 	NotFound http.Handler
 
+	// Configurable http.Handler which is called for requests no route matches
+	// instead of the 404 handling, e.g. an http.ServeMux with the routes of
+	// an application which are not ported to the router yet:
+	//
+	//	router.Fallback = mux
+	//
+	// Unlike NotFound, the request is not considered unknown: OnNotFound and
+	// the handlers of NotFoundFor are not called. Registered routes take
+	// precedence over Fallback, which takes precedence over NotFound.
+	// Redirects (see RedirectTrailingSlash and RedirectFixedPath) and 405
+	// responses (see HandleMethodNotAllowed) are made before Fallback is
+	// called, they may have to be disabled while routes are ported.
+	// A host router (see Host) with a Fallback does not fall back to the
+	// host-agnostic routes.
+	Fallback http.Handler
+
 	// Configurable http.Handler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
 	// If it is not set, http.Error with http.StatusMethodNotAllowed is used.
-	// The "Allow" header with allowed request methods is set before the handler
-	// is called.
+	// The "Allow" header with allowed request methods is always set before the
+	// handler is called, so the handler only needs to write the status code
+	// and the body, e.g. a JSON error. Automatic OPTIONS responses (see
+	// HandleOPTIONS) are not affected by the handler.
 	MethodNotAllowed http.Handler
 
+	// Like MethodNotAllowed, but the function additionally receives the
+	// allowed request methods, e.g. to render them in the response body.
+	// It is only called if MethodNotAllowed is not set. The "Allow" header is
+	// set before the function is called.
+	MethodNotAllowedWithAllowed func(w http.ResponseWriter, req *http.Request, allowed []string)
+
+	// Configurable http.Handler which is called for requests with a method no
+	// route is registered for at all, e.g. to reply with 501 (Not Implemented).
+	// It is not called for automatic OPTIONS replies (see HandleOPTIONS) and
+	// if routes are registered with MethodWildcard. If it is not set, such
+	// requests are handled as 405 or 404.
+	// Host routers (see Host) only consider their own routes.
+	UnknownMethod http.Handler
+
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate a error page and return the http error code
 	// 500 (Internal Server Error).
 	// The handler can be used to keep your server from crashing because of
 	// unrecovered panics.
+	// If a panic handler is set, the http.ResponseWriter passed to handles and
+	// the panic handler implements ResponseWriter. If the response was already
+	// written when the panic occurred, all writes of the panic handler are
+	// discarded, since they would corrupt the response. The wrapper is reused
+	// after the request was served, so like any http.ResponseWriter it must
+	// not be used once the handle returned.
 	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+
+	// Like PanicHandler, but the handler additionally receives the Params of
+	// the matched route, if the panic occurred in a handle. It takes
+	// precedence over PanicHandler if both are set.
+	PanicHandlerWithParams func(http.ResponseWriter, *http.Request, Params, interface{})
+
+	// Function which is called for each request before it is routed, e.g. to
+	// add a request ID header to all responses, including redirects and 404
+	// responses. It sees the original request, before the path is cleaned or
+	// the method is overridden (see MethodOverrideHeader). If it returns
+	// false, the request is not routed any further, PreRoute must have
+	// responded to it then.
+	// Panics in PreRoute are recovered by PanicHandler. Host routers (see
+	// Host) do not call their own PreRoute function.
+	PreRoute func(http.ResponseWriter, *http.Request) bool
+
+	// Paths of requests which are still routed while the router is draining,
+	// e.g. health checks, see BeginDraining. The paths are compared with the
+	// request path exactly.
+	DrainingAllowlist []string
+
+	// The time after which clients may retry requests rejected while the
+	// router is draining. It is sent as the Retry-After header in whole
+	// seconds, at least 1.
+	DrainingRetryAfter time.Duration
+
+	// Function which is called for each request matching a route, before the
+	// handle is called, e.g. to record metrics or to start a trace span.
+	// It receives the registered path of the route, e.g. /user/:name, the
+	// request method and the Params, which must not be retained.
+	// Host routers (see Host) call their own OnMatch function.
+	OnMatch func(pattern, method string, ps Params)
+
+	// Function which is called for each request no route is found for, before
+	// the NotFound handler is called. It is not called for redirects and
+	// 405 responses, nor for requests handled by a handler added with
+	// AddNotFoundHandler.
+	// Host routers (see Host) call their own OnNotFound function, unless the
+	// request is handled by the host-agnostic routes.
+	OnNotFound func(method, path string)
+
+	// Function which is called like log.Printf for notable events while
+	// requests are served: panics recovered because of a PanicHandler, before
+	// the handler is called, and redirects to a fixed path (see
+	// RedirectFixedPath). If nil, nothing is logged.
+	// Host routers (see Host) log redirects with their own Logger.
+	Logger func(format string, args ...interface{})
+
+	// If enabled, the Logger is additionally called for each redirect because
+	// of RedirectTrailingSlash. These are usually too frequent to be logged
+	// outside of debugging.
+	LogTrailingSlashRedirects bool
 }
 
 // Make sure the Router conforms with the http.Handler interface
 var _ http.Handler = New()
 
 // New returns a new initialized Router.
-// Path auto-correction, including trailing slashes, is enabled by default.
+// Path auto-correction, including trailing slashes, and the pooling of Params
+// are enabled by default.
 func New() *Router {
 	return &Router{
 		RedirectTrailingSlash:  true,
 		RedirectFixedPath:      true,
 		HandleMethodNotAllowed: true,
 		HandleOPTIONS:          true,
+		RejectControlChars:     true,
+		UseParamsPool:          true,
 	}
 }
 
 func (r *Router) getParams() *Params {
-	ps := r.paramsPool.Get().(*Params)
-	*ps = (*ps)[0:0] // reset slice
-	return ps
+	maxParams := r.loadTrees().maxParams
+	if r.UseParamsPool {
+		// Params from before a route with more params was added are dropped
+		if ps, _ := r.paramsPool.Get().(*Params); ps != nil && cap(*ps) >= int(maxParams) {
+			*ps = (*ps)[0:0] // reset slice
+			return ps
+		}
+	}
+	ps := make(Params, 0, maxParams)
+	return &ps
+}
+
+// Returns Params for a route of the tree with the given maximum number of
+// params. Without UseParamsPool they have exactly this capacity, which avoids
+// allocating room for the params of the routes of other methods. Pooled
+// Params are sized for all trees, so that they can be reused for any route.
+func (r *Router) newParams(maxParams uint16) *Params {
+	if r.UseParamsPool {
+		return r.getParams()
+	}
+	ps := make(Params, 0, maxParams)
+	return &ps
 }
 
 func (r *Router) putParams(ps *Params) {
-	if ps != nil {
+	if ps != nil && r.UseParamsPool {
 		r.paramsPool.Put(ps)
 	}
 }
@@ -249,6 +686,88 @@ func (r *Router) DELETE(path string, handle Handle) {
 	r.Handle(http.MethodDelete, path, handle)
 }
 
+// CONNECT is a shortcut for router.Handle(http.MethodConnect, path, handle)
+//
+// CONNECT requests are never redirected and their path is not cleaned. Note
+// that CONNECT requests in authority form, e.g. CONNECT example.com:443, have
+// an empty path and thus match no route.
+func (r *Router) CONNECT(path string, handle Handle) {
+	r.Handle(http.MethodConnect, path, handle)
+}
+
+// TRACE is a shortcut for router.Handle(http.MethodTrace, path, handle)
+func (r *Router) TRACE(path string, handle Handle) {
+	r.Handle(http.MethodTrace, path, handle)
+}
+
+// MethodWildcard is the method under which a handle is registered for requests
+// with any method, e.g. for a proxy:
+//
+//	router.Handle(httprouter.MethodWildcard, "/proxy/*path", Proxy)
+//
+// If the route of the request method does not match the path, the routes
+// registered with MethodWildcard are tried. A route registered for a specific
+// method thus wins over a wildcard route for the same path. Only if neither
+// matches, the path is redirected (see RedirectTrailingSlash and
+// RedirectFixedPath) or the request is handled as 405 or 404.
+// Paths matched by a wildcard route allow all methods. The Allow header then
+// lists the standard methods and all methods routes are registered for.
+const MethodWildcard = "*"
+
+// Returns the trees which are searched for requests with the given method,
+// in precedence order.
+func (r *Router) roots(method string) [3]*node {
+	trees := r.loadTrees().trees
+	switch {
+	case method == MethodWildcard:
+		return [3]*node{trees[method]}
+	case method == http.MethodHead && r.AutoHEAD:
+		return [3]*node{trees[method], trees[http.MethodGet], trees[MethodWildcard]}
+	}
+	return [3]*node{trees[method], trees[MethodWildcard]}
+}
+
+// anyMethods are the request methods Any registers a handle for.
+var anyMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost,
+	http.MethodPut, http.MethodPatch, http.MethodDelete,
+}
+
+// Any registers the handle for the path with the GET, HEAD, POST, PUT, PATCH
+// and DELETE methods. OPTIONS requests are still handled automatically, see
+// HandleOPTIONS. To register a handle for all methods, see MethodWildcard.
+func (r *Router) Any(path string, handle Handle) {
+	r.Handles(anyMethods, path, handle)
+}
+
+// Handles registers the same request handle with the given path for each of
+// the given methods. See Handle.
+func (r *Router) Handles(methods []string, path string, handle Handle) {
+	if len(methods) == 0 {
+		panic("methods must not be empty in path '" + path + "'")
+	}
+	for _, method := range methods {
+		r.Handle(method, path, handle)
+	}
+}
+
+// HandleBothSlash registers the handle for the path both with and without a
+// trailing slash, e.g. for /x and /x/, so both are handled directly instead
+// of one being redirected, see RedirectTrailingSlash. Unlike
+// IgnoreTrailingSlash this only applies to this route. Registering a route
+// for either variant afterwards panics like any duplicate registration.
+// The path / is only registered once. Paths ending with a catch-all
+// parameter are rejected, since it already matches paths of both forms.
+func (r *Router) HandleBothSlash(method, path string, handle Handle) {
+	if strings.IndexByte(path, '*') >= 0 {
+		panic("catch-all routes are not supported by HandleBothSlash in path '" + path + "'")
+	}
+	r.Handle(method, path, handle)
+	if path != "/" {
+		r.Handle(method, toggleTrailingSlash(path), handle)
+	}
+}
+
 // Handle registers a new request handle with the given path and method.
 //
 // For GET, POST, PUT, PATCH and DELETE requests the respective shortcut
@@ -257,74 +776,377 @@ func (r *Router) DELETE(path string, handle Handle) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
+//
+// A handle registered with the method MethodWildcard handles requests with any
+// method, see MethodWildcard.
+//
+// Routes of a method never overlap, a request path matches at most one of
+// them. A route which could match the same paths as an existing one, e.g.
+// /files/special next to /files/*path, is rejected. There is thus no
+// precedence between routes to configure. Overlaps must be resolved by the
+// handle of the wildcard route.
+//
+// Handle panics if the route can not be registered, see TryHandle.
 func (r *Router) Handle(method, path string, handle Handle) {
+	if err := r.TryHandle(method, path, handle); err != nil {
+		panic(err.Error())
+	}
+}
+
+// HandleSafe registers a new request handle with the given path and method,
+// like Handle, but it may be called while the router serves requests, e.g.
+// to add the routes of a plugin at runtime.
+// The route is inserted into a copy of the tree of the method, which then
+// replaces the tree atomically. Requests are thus never blocked and are
+// routed either with or without the new route, while calls of HandleSafe are
+// serialized. Since the whole tree is copied, registering many routes this
+// way is slow, see HandleBatch for adding them at once.
+// All other ways to register routes and to change the options of the router
+// are still not safe while requests are served. Query routes (see
+// HandleQuery) and accept routes (see HandleAccept) can not be added this
+// way.
+// HandleSafe panics if the route can not be registered, see TryHandle.
+func (r *Router) HandleSafe(method, path string, handle Handle) {
+	if err := r.TryHandleSafe(method, path, handle); err != nil {
+		panic(err.Error())
+	}
+}
+
+// TryHandleSafe registers a new request handle like HandleSafe, but returns
+// an error instead of panicking, see TryHandle.
+func (r *Router) TryHandleSafe(method, path string, handle Handle) error {
+	if err := r.checkRoute(method, path, handle); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.loadTrees().copy()
+	if root := t.trees[method]; root != nil {
+		t.trees[method] = root.clone()
+	}
+	if err := r.tryHandle(t, method, path, handle); err != nil {
+		return err
+	}
+	r.trees.Store(t)
+	return nil
+}
+
+// Reset removes all routes registered for the given method, e.g. to register
+// them anew when the configuration is reloaded. The options of the router,
+// e.g. NotFound and PanicHandler, and the routes of all other methods are
+// kept. Query and accept routes (see HandleQuery and HandleAccept) of the
+// method and the names of its routes (see HandleNamed) are removed as well,
+// routes of host routers (see Host) are not affected.
+// Like HandleSafe, Reset replaces the trees atomically, along with the query
+// and accept routes and the route names, so that requests served and URLs
+// built meanwhile see either all or none of the routes of the method.
+func (r *Router) Reset(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := r.loadTrees()
+	if t.trees[method] == nil {
+		return
+	}
+	t = t.copy()
+	delete(t.trees, method)
+	t.globalAllowed = r.allowedIn(t, "*", "")
+
+	prefix := method + " "
+	for id := range t.queries {
+		if strings.HasPrefix(id, prefix) {
+			delete(t.queries, id)
+		}
+	}
+	for id := range t.accepts {
+		if strings.HasPrefix(id, prefix) {
+			delete(t.accepts, id)
+		}
+	}
+	for name, route := range t.names {
+		if route.method == method {
+			delete(t.names, name)
+		}
+	}
+	r.trees.Store(t)
+}
+
+// ResetAll removes the routes of all methods, like Reset for each of them.
+// The options of the router are kept.
+func (r *Router) ResetAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.trees.Store(new(methodTrees))
+}
+
+// RouteConflictError is returned by TryHandle if a route can not be inserted
+// into the tree, e.g. because a handle is already registered for the path or
+// because its wildcards conflict with those of existing routes.
+type RouteConflictError struct {
+	Method string // method of the rejected route
+	Path   string // path of the rejected route
+	Msg    string // description of the conflict
+}
+
+func (e *RouteConflictError) Error() string {
+	return e.Msg
+}
+
+// TryHandle registers a new request handle with the given path and method,
+// just like Handle, but returns an error instead of panicking if the route
+// can not be registered. Conflicts with existing routes are reported as
+// *RouteConflictError. In case of an error the route is not registered.
+// This is useful if the routes are built from configuration data.
+func (r *Router) TryHandle(method, path string, handle Handle) error {
+	if err := r.checkRoute(method, path, handle); err != nil {
+		return err
+	}
+	t := r.writableTrees()
+	if t.setFallback(method, path, handle) {
+		return nil
+	}
+	return r.tryHandle(t, method, path, handle)
+}
+
+// Checks the arguments of a route to register.
+func (r *Router) checkRoute(method, path string, handle Handle) error {
 	if method == "" {
-		panic("method must not be empty")
+		return errors.New("method must not be empty")
+	}
+	if r.StrictMethods && !r.knownMethod(method) {
+		return errors.New("unknown method '" + method + "' in path '" + path +
+			"', see RegisterMethod")
 	}
 	if len(path) < 1 || path[0] != '/' {
-		panic("path must begin with '/' in path '" + path + "'")
+		return errors.New("path must begin with '/' in path '" + path + "'")
 	}
 	if handle == nil {
-		panic("handle must not be nil")
+		return errors.New("handle must not be nil")
 	}
-
-	if r.trees == nil {
-		r.trees = make(map[string]*node)
+	if n := countParams(path); n > maxRouteParams {
+		return errors.New("too many params (" + strconv.Itoa(n) + ") in path '" + path + "'")
+	} else if r.MaxParams > 0 && n > r.MaxParams {
+		return errors.New("path '" + path + "' has " + strconv.Itoa(n) +
+			" params, more than MaxParams (" + strconv.Itoa(r.MaxParams) + ")")
 	}
+	return nil
+}
+
+// The maximum number of params of a route, so that the count of the params
+// of a tree, including the one added by SaveMatchedRoutePath, fits into the
+// uint16 of node.maxParams.
+const maxRouteParams = math.MaxUint16 - 1
 
-	root := r.trees[method]
-	if root == nil {
+// Registers the route in the given trees, like TryHandle. The arguments must
+// be valid.
+func (r *Router) tryHandle(t *methodTrees, method, path string, handle Handle) error {
+	root := t.trees[method]
+	newRoot := root == nil
+	if newRoot {
 		root = new(node)
-		r.trees[method] = root
+	}
+
+	// The static parts of the keys are lowercased for CaseInsensitive, the
+	// routes keep the registered path
+	key := func(path string) string {
+		if r.CaseInsensitive {
+			return lowerStatic(path)
+		}
+		return path
+	}
+
+	msg, ok := "", false
+	full, short, optional := splitOptional(path)
+	if optional != "" {
+		// Insert both paths into a copy of the tree, so that the tree is not
+		// modified if one of them conflicts
+		if !newRoot {
+			root = root.clone()
+		}
+		if msg, ok = root.tryAddRoute(key(full), full, handle); ok {
+			msg, ok = root.tryAddRoute(key(short), short, optionalParamHandle(optional, handle))
+		}
+	} else {
+		msg, ok = root.tryAddRoute(key(path), path, handle)
+	}
+	if !ok {
+		return &RouteConflictError{Method: method, Path: path, Msg: msg}
+	}
 
-		r.globalAllowed = r.allowed("*", "")
+	if newRoot || optional != "" {
+		if t.trees == nil {
+			t.trees = make(map[string]*node)
+		}
+		t.trees[method] = root
+	}
+	if newRoot {
+		t.globalAllowed = r.allowedIn(t, "*", "")
 	}
 
-	root.addRoute(path, handle)
+	r.updateMaxParams(t, root, path)
+	return nil
+}
 
-	// Update maxParams
-	if pc := countParams(path); pc > r.maxParams {
-		r.maxParams = pc
+// Updates maxParams of the trees and of the tree root for a newly registered
+// path. Since getValue saves at most one Param per wildcard of the matched
+// route, Params of this capacity never grow while the route is matched.
+func (r *Router) updateMaxParams(t *methodTrees, root *node, path string) {
+	varsCount := uint16(countParams(path))
+	if r.SaveMatchedRoutePath {
+		varsCount++
+	}
+	if varsCount > t.maxParams {
+		t.maxParams = varsCount
+	}
+	if varsCount > root.maxParams {
+		root.maxParams = varsCount
 	}
+}
+
+// methodTrees holds the trees of the methods, the state derived from them and
+// the tables of the routes registered with HandleQuery, HandleAccept and
+// HandleNamed.
+// The Router stores a pointer to it atomically, so that HandleSafe can
+// replace the trees by a modified copy while requests are served.
+type methodTrees struct {
+	trees map[string]*node
+
+	// Cached value of global (*) allowed methods
+	globalAllowed string
+
+	// Maximum number of params of a route
+	maxParams uint16
 
-	// Lazy-init paramsPool alloc func
-	if r.paramsPool.New == nil && r.maxParams > 0 {
-		r.paramsPool.New = func() interface{} {
-			ps := make(Params, 0, r.maxParams)
-			return &ps
+	// Query routes by method and path, see HandleQuery
+	queries map[string]*queryRoute
+
+	// Accept routes by method and path, see HandleAccept
+	accepts map[string]*acceptRoute
+
+	// Named routes, see HandleNamed
+	names map[string]namedRoute
+}
+
+// Routers without routes share this value, it must not be modified.
+var emptyTrees = new(methodTrees)
+
+// Returns the current trees of the router.
+func (r *Router) loadTrees() *methodTrees {
+	if t, _ := r.trees.Load().(*methodTrees); t != nil {
+		return t
+	}
+	return emptyTrees
+}
+
+// Returns the current trees of the router for modification in place, which
+// is not safe while requests are served.
+func (r *Router) writableTrees() *methodTrees {
+	t, _ := r.trees.Load().(*methodTrees)
+	if t == nil {
+		t = new(methodTrees)
+		r.trees.Store(t)
+	}
+	return t
+}
+
+// Returns a copy of the trees, which shares the nodes with t. The tables of
+// query and accept routes and of route names are copied as well, but share
+// the routes with t.
+func (t *methodTrees) copy() *methodTrees {
+	c := *t
+	c.trees = make(map[string]*node, len(t.trees)+1)
+	for method, root := range t.trees {
+		c.trees[method] = root
+	}
+	if t.queries != nil {
+		c.queries = make(map[string]*queryRoute, len(t.queries))
+		for id, qr := range t.queries {
+			c.queries[id] = qr
+		}
+	}
+	if t.accepts != nil {
+		c.accepts = make(map[string]*acceptRoute, len(t.accepts))
+		for id, ar := range t.accepts {
+			c.accepts[id] = ar
 		}
 	}
+	if t.names != nil {
+		c.names = make(map[string]namedRoute, len(t.names))
+		for name, route := range t.names {
+			c.names[name] = route
+		}
+	}
+	return &c
 }
 
 // Handler is an adapter which allows the usage of an http.Handler as a
 // request handle.
 // The Params are available in the request context under ParamsKey.
 func (r *Router) Handler(method, path string, handler http.Handler) {
-	r.Handle(method, path,
-		func(w http.ResponseWriter, req *http.Request, p Params) {
-			if len(p) > 0 {
-				ctx := req.Context()
-				ctx = context.WithValue(ctx, ParamsKey, p)
-				req = req.WithContext(ctx)
-			}
-			handler.ServeHTTP(w, req)
-		},
-	)
+	r.Handle(method, path, handlerHandle(handler))
+}
+
+// Adapts the given http.Handler to a request handle, which stores the Params
+// in the request context.
+func handlerHandle(handler http.Handler) Handle {
+	return func(w http.ResponseWriter, req *http.Request, p Params) {
+		if len(p) > 0 {
+			ctx := req.Context()
+			ctx = context.WithValue(ctx, ParamsKey, p)
+			req = req.WithContext(ctx)
+		}
+		handler.ServeHTTP(w, req)
+	}
 }
 
 // HandlerFunc is an adapter which allows the usage of an http.HandlerFunc as a
 // request handle.
+// Like with Handler, the Params can be retrieved with ParamsFromContext. They
+// are only stored in the context if the route has parameters.
 func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
 	r.Handler(method, path, handler)
 }
 
+// HandleC is an adapter which allows the usage of a HandleC as a request
+// handle. The handle receives the context of the request, i.e. req.Context().
+// The route is registered like with Handle, thus Lookup returns the adapter.
+func (r *Router) HandleC(method, path string, handle HandleC) {
+	r.Handle(method, path, contextHandle(handle))
+}
+
+// GETC is a shortcut for router.HandleC(http.MethodGet, path, handle)
+func (r *Router) GETC(path string, handle HandleC) {
+	r.HandleC(http.MethodGet, path, handle)
+}
+
+// POSTC is a shortcut for router.HandleC(http.MethodPost, path, handle)
+func (r *Router) POSTC(path string, handle HandleC) {
+	r.HandleC(http.MethodPost, path, handle)
+}
+
+func contextHandle(handle HandleC) Handle {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		handle(req.Context(), w, req, ps)
+	}
+}
+
 // ServeFiles serves files from the given file system root.
 // The path must end with "/*filepath", files are then served from the local
 // path /defined/root/dir/*filepath.
 // For example if root is "/etc" and *filepath is "passwd", the local file
 // "/etc/passwd" would be served.
 // Internally a http.FileServer is used, therefore http.NotFound is used instead
-// of the Router's NotFound handler.
+// of the Router's NotFound handler. See ServeFilesWithFallback.
+// If the context of the request is canceled, e.g. because the client
+// disconnected, further writes of the response fail, so that the file is not
+// copied any further. Files are still sent with sendfile where the
+// http.ResponseWriter supports it.
 // To use the operating system's file system implementation,
 // use http.Dir:
 //     router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
@@ -333,18 +1155,85 @@ func (r *Router) ServeFiles(path string, root http.FileSystem) {
 		panic("path must end with /*filepath in path '" + path + "'")
 	}
 
+	r.GET(path, fileServerHandle(root))
+}
+
+// Returns a request handle serving files from the given file system root.
+// The file path is taken from the catch-all parameter "filepath".
+// Writing the response fails as soon as the context of the request is done.
+func fileServerHandle(root http.FileSystem) Handle {
 	fileServer := http.FileServer(root)
 
-	r.GET(path, func(w http.ResponseWriter, req *http.Request, ps Params) {
-		req.URL.Path = ps.ByName("filepath")
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		req.URL.Path = withLeadingSlash(ps.ByName("filepath"))
+		if ctx := req.Context(); ctx.Done() != nil {
+			w = contextWriter{w, ctx}
+		}
 		fileServer.ServeHTTP(w, req)
-	})
+	}
+}
+
+// Returns a request handle calling the given handle with an additional empty
+// parameter with the given key, for the path without an optional parameter.
+func optionalParamHandle(key string, handle Handle) Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		handle(w, req, append(ps, Param{Key: key}))
+	}
+}
+
+// Appends the path of the matched route to the params.
+func (r *Router) saveMatchedRoutePath(ps *Params, fullPath string) *Params {
+	if ps == nil {
+		ps = r.getParams()
+	}
+	*ps = append(*ps, Param{Key: MatchedRoutePathParam, Value: fullPath})
+	return ps
+}
+
+// Returns the code if it is a valid redirect status code, see
+// RedirectStatusCode. Otherwise it panics.
+func validRedirectCode(code int) int {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return code
+	default:
+		panic("invalid redirect status code " + strconv.Itoa(code))
+	}
 }
 
-func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
+// Returns the status code of a trailing slash redirect for the method, or
+// the given code of the other redirects if no specific code is configured.
+func (r *Router) trailingSlashRedirectCode(method string, code int) int {
+	tsrCode := r.TrailingSlashRedirectCodeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		tsrCode = r.TrailingSlashRedirectCodeGET
+	}
+	if tsrCode == 0 {
+		return code
+	}
+	return validRedirectCode(tsrCode)
+}
+
+func (r *Router) recv(w *responseWriter, req *http.Request, ps *Params) {
 	if rcv := recover(); rcv != nil {
-		r.PanicHandler(w, req, rcv)
+		if r.Logger != nil {
+			r.Logger("httprouter: recovered panic serving %s %s: %v", req.Method, req.URL.Path, rcv)
+		}
+		if w.Written() {
+			w.discard = true
+		}
+		if r.UseContext && len(*ps) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), ParamsKey, *ps))
+		}
+		if r.PanicHandlerWithParams != nil {
+			r.PanicHandlerWithParams(w, req, *ps, rcv)
+		} else {
+			r.PanicHandler(w, req, rcv)
+		}
 	}
+	*w = responseWriter{}
+	responseWriterPool.Put(w)
 }
 
 // Lookup allows the manual lookup of a method + path combo.
@@ -353,60 +1242,233 @@ func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 // values. Otherwise the third return value indicates whether a redirection to
 // the same path with an extra / without the trailing slash should be performed.
 func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
-	if root := r.trees[method]; root != nil {
-		handle, ps, tsr := root.getValue(path, r.getParams)
+	handle, ps, tsr, _ := r.lookup(method, path)
+	return handle, ps, tsr
+}
+
+// Looks up the path like Lookup and additionally returns the registered path
+// of the route found.
+func (r *Router) lookup(method, path string) (Handle, Params, bool, string) {
+	handle, ps, tsr, fullPath := r.matchRoute(r.roots(method), path, "")
+	if ps == nil {
+		return handle, nil, tsr, fullPath
+	}
+	return handle, *ps, tsr, fullPath
+}
+
+// Match looks up the route for a method + path combo in the trees of the
+// router and returns its handle and the path parameter values, like Lookup.
+// The third return value reports whether a route was found.
+// Only the routes are matched, none of the request policies of ServeHTTP are
+// applied: RedirectTrailingSlash, RedirectFixedPath, IgnoreTrailingSlash,
+// CollapseSlashes, HandleOPTIONS and HandleMethodNotAllowed are ignored, as
+// are host routers (see LookupHost). Routes registered with MethodWildcard
+// and the GET routes for HEAD requests with AutoHEAD are matched like by
+// ServeHTTP.
+func (r *Router) Match(method, path string) (Handle, Params, bool) {
+	handle, ps, _ := r.Lookup(method, path)
+	return handle, ps, handle != nil
+}
+
+// LookupResult is the result of LookupDetailed.
+type LookupResult struct {
+	// The handle and the parameter values of the route, if one was found
+	Handle Handle
+	Params Params
+	Found  bool
+
+	// The path the route was registered with, e.g. /users/:id for the path
+	// /users/42, if one was found. The keys of Params follow the order of
+	// its parameters.
+	Route string
+
+	// Whether ServeHTTP would redirect to the path with (without) the
+	// trailing slash, see RedirectTrailingSlash
+	TrailingSlashRedirect bool
+
+	// The corrected path ServeHTTP would redirect to, if any, see
+	// RedirectFixedPath
+	FixedPath string
+}
+
+// LookupDetailed allows the manual lookup of a method + path combo like
+// Lookup, but decides like ServeHTTP: the path is the escaped path of a
+// request, e.g. /files/a%2Fb, and it is rewritten, cleaned and unescaped
+// according to the options of the router, e.g. PathRewrite,
+// CleanPathBeforeRouting and UnescapePathParams. Routes found only with
+// IgnoreTrailingSlash or CollapseSlashes are reported as found. Otherwise
+// the redirect ServeHTTP would perform is reported, according to the
+// RedirectTrailingSlash, RedirectFixedPath and DetectRedirectLoop options.
+// Paths which are invalid, e.g. because of invalid escapes, are reported as
+// not found. Host routers (see LookupHost) and the request policies applied
+// before the routing, e.g. MaxPathLength, are not considered.
+func (r *Router) LookupDetailed(method, path string) LookupResult {
+	var res LookupResult
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return res
+	}
+	req := &http.Request{Method: method, URL: u}
+	path, rewritten := r.requestPath(req)
+
+	roots := r.roots(method)
+	tsr, found := r.tryPaths(path, func(path, uncollapsed string) (bool, bool) {
+		handle, ps, tsr, fullPath := r.matchRoute(roots, path, uncollapsed)
 		if handle == nil {
+			return tsr, false
+		}
+		if r.UnescapePathParams && ps != nil && !unescapeParams(*ps, !r.DecodeSlashInParams) {
+			// Served by InvalidPath
 			r.putParams(ps)
-			return nil, nil, tsr
+			return false, true
 		}
-		if ps == nil {
-			return handle, nil, tsr
+		res.Handle, res.Route, res.Found = handle, fullPath, true
+		if ps != nil {
+			res.Params = *ps
+		}
+		return false, true
+	})
+	if found {
+		return res
+	}
+
+	if target, trailingSlash, loop := r.redirectPath(req, roots, path, tsr, rewritten); target != "" && !loop {
+		if trailingSlash {
+			res.TrailingSlashRedirect = true
+		} else {
+			res.FixedPath = target
 		}
-		return handle, *ps, tsr
 	}
-	return nil, nil, false
+	return res
+}
+
+// canonicalMethods is the order of the methods in the Allow header.
+var canonicalMethods = [...]string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodConnect,
+	http.MethodOptions, http.MethodTrace,
+}
+
+// RegisterMethod registers a custom method, e.g. PURGE, which may be used
+// for routes if StrictMethods is enabled.
+func (r *Router) RegisterMethod(method string) {
+	if method == "" {
+		panic("method must not be empty")
+	}
+	if r.methods == nil {
+		r.methods = make(map[string]bool)
+	}
+	r.methods[method] = true
+}
+
+// Reports whether the method is a standard method, MethodWildcard or was
+// registered with RegisterMethod.
+func (r *Router) knownMethod(method string) bool {
+	if method == MethodWildcard || methodRank(method) < len(canonicalMethods) {
+		return true
+	}
+	return r.methods[method]
+}
+
+// Reports whether method a is sorted before method b in the Allow header.
+// The standard methods are sorted in canonical order, other methods follow in
+// lexical order.
+func methodLess(a, b string) bool {
+	ra, rb := methodRank(a), methodRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
+
+func methodRank(method string) int {
+	for i, m := range canonicalMethods {
+		if m == method {
+			return i
+		}
+	}
+	return len(canonicalMethods)
 }
 
 func (r *Router) allowed(path, reqMethod string) (allow string) {
+	return r.allowedIn(r.loadTrees(), path, reqMethod)
+}
+
+// Like allowed, but for the given trees.
+func (r *Router) allowedIn(t *methodTrees, path, reqMethod string) (allow string) {
 	allowed := make([]string, 0, 9)
+	anyMethod := false
 
 	if path == "*" { // server-wide
 		// empty method is used for internal calls to refresh the cache
 		if reqMethod == "" {
-			for method := range r.trees {
+			for method := range t.trees {
 				if method == http.MethodOptions {
 					continue
 				}
+				if method == MethodWildcard {
+					anyMethod = true
+					continue
+				}
 				// Add request method to list of allowed methods
 				allowed = append(allowed, method)
 			}
 		} else {
-			return r.globalAllowed
+			return t.globalAllowed
 		}
 	} else { // specific path
-		for method := range r.trees {
+		for method, root := range t.trees {
 			// Skip the requested method - we already tried this one
 			if method == reqMethod || method == http.MethodOptions {
 				continue
 			}
 
-			handle, _, _ := r.trees[method].getValue(path, nil)
+			handle, _, _, _ := root.getValue(path, nil, r.CaseInsensitive)
 			if handle != nil {
+				if method == MethodWildcard {
+					anyMethod = true
+					break
+				}
 				// Add request method to list of allowed methods
 				allowed = append(allowed, method)
 			}
 		}
 	}
 
+	if anyMethod {
+		// All methods are allowed: the standard ones and those of the trees
+		allowed = allowed[:0]
+		for _, method := range canonicalMethods {
+			if method != http.MethodOptions {
+				allowed = append(allowed, method)
+			}
+		}
+		for method := range t.trees {
+			if methodRank(method) == len(canonicalMethods) && method != MethodWildcard {
+				allowed = append(allowed, method)
+			}
+		}
+	} else if r.AutoHEAD {
+		// GET routes handle HEAD requests as well
+		get, head := false, false
+		for _, method := range allowed {
+			get = get || method == http.MethodGet
+			head = head || method == http.MethodHead
+		}
+		if get && !head {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+
 	if len(allowed) > 0 {
 		// Add request method to list of allowed methods
 		allowed = append(allowed, http.MethodOptions)
 
-		// Sort allowed methods.
+		// Sort allowed methods in canonical order, see methodLess.
 		// sort.Strings(allowed) unfortunately causes unnecessary allocations
 		// due to allowed being moved to the heap and interface conversion
 		for i, l := 1, len(allowed); i < l; i++ {
-			for j := i; j > 0 && allowed[j] < allowed[j-1]; j-- {
+			for j := i; j > 0 && methodLess(allowed[j], allowed[j-1]); j-- {
 				allowed[j], allowed[j-1] = allowed[j-1], allowed[j]
 			}
 		}
@@ -417,60 +1479,614 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 	return
 }
 
+// Allowed returns the methods which are allowed for the path, in the order of
+// the Allow header of automatic OPTIONS and 405 responses, i.e. the methods
+// routes matching the path are registered for. The given method is skipped,
+// e.g. the one Lookup returned no handle for, which allows to tell 405
+// (Method Not Allowed) and 404 (Not Found) apart:
+//
+//	if handle, _, _ := router.Lookup(method, path); handle == nil {
+//		if allowed := router.Allowed(path, method); allowed != nil {
+//			// 405
+//		}
+//	}
+//
+// OPTIONS is included if any other method is allowed. For the path "*" the
+// methods of all routes are returned. If no method is allowed, nil is
+// returned.
+func (r *Router) Allowed(path, method string) []string {
+	allow := r.allowed(path, method)
+	if allow == "" {
+		return nil
+	}
+	return strings.Split(allow, ", ")
+}
+
+// AllowedMethods returns the methods which are allowed for the path, e.g. to
+// describe the routes of an API in an index endpoint. It returns the methods
+// of the Allow header an automatic OPTIONS response for the path would have,
+// see Allowed, including HEAD if AutoHEAD is enabled and all methods for
+// paths matched by a route registered with MethodWildcard. If no method is
+// allowed, nil is returned.
+func (r *Router) AllowedMethods(path string) []string {
+	return r.Allowed(path, "")
+}
+
 // ServeHTTP makes the router implement the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if r.PanicHandler != nil {
-		defer r.recv(w, req)
+	// The Params of the matched route, for the panic handler
+	var matched *Params
+	if r.PanicHandler != nil || r.PanicHandlerWithParams != nil {
+		// Kept on the stack, the Params are only passed down
+		var ps Params
+		matched = &ps
+		// Returned to the pool by recv
+		rw := responseWriterPool.Get().(*responseWriter)
+		*rw = responseWriter{ResponseWriter: w}
+		w = rw
+		defer r.recv(rw, req, matched)
 	}
 
-	path := req.URL.Path
+	if r.PreRoute != nil && !r.PreRoute(w, req) {
+		return
+	}
 
-	if root := r.trees[req.Method]; root != nil {
-		if handle, ps, tsr := root.getValue(path, r.getParams); handle != nil {
-			if ps != nil {
-				handle(w, req, *ps)
-				r.putParams(ps)
-			} else {
-				handle(w, req, nil)
-			}
+	if atomic.LoadInt32(&r.draining) != 0 && !r.drainingAllowed(req.URL.Path) {
+		w.Header().Set("Retry-After", retryAfter(r.DrainingRetryAfter))
+		http.Error(w,
+			http.StatusText(http.StatusServiceUnavailable),
+			http.StatusServiceUnavailable,
+		)
+		return
+	}
+
+	if r.MaxPathLength > 0 && len(req.URL.Path) > r.MaxPathLength {
+		http.Error(w,
+			http.StatusText(http.StatusRequestURITooLong),
+			http.StatusRequestURITooLong,
+		)
+		return
+	}
+	if r.RejectControlChars && hasControlChar(req.URL.Path) {
+		http.Error(w,
+			http.StatusText(http.StatusBadRequest),
+			http.StatusBadRequest,
+		)
+		return
+	}
+
+	if req.Method == http.MethodPost && (r.MethodOverrideHeader != "" || r.MethodOverrideField != "") {
+		r.overrideMethod(req)
+	}
+
+	if r.hosts != nil || r.hostPatterns != nil {
+		if hr, hostParams := r.matchHost(req.Host); hr != nil {
+			hr.serve(w, req, hostParams, matched)
+			return
+		}
+	}
+
+	r.serve(w, req, nil, matched)
+}
+
+// ServeHTTPStatus handles the request like ServeHTTP and returns the status
+// code of the written response, e.g. for access logging. If no header was
+// written explicitly, http.StatusOK is returned, like it is sent by net/http.
+// The router still implements http.Handler by ServeHTTP.
+func (r *Router) ServeHTTPStatus(w http.ResponseWriter, req *http.Request) int {
+	rw := &responseWriter{ResponseWriter: w}
+	r.ServeHTTP(rw, req)
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// BeginDraining makes the router reject new requests with 503 (Service
+// Unavailable) and a Retry-After header, e.g. during a graceful shutdown,
+// while requests which are already served are completed. Requests for the
+// paths of DrainingAllowlist are still routed. Draining can not be ended.
+// It is safe to call BeginDraining while requests are served.
+func (r *Router) BeginDraining() {
+	atomic.StoreInt32(&r.draining, 1)
+}
+
+// IsDraining reports whether BeginDraining was called.
+func (r *Router) IsDraining() bool {
+	return atomic.LoadInt32(&r.draining) != 0
+}
+
+// Reports whether the path may be routed while the router is draining.
+func (r *Router) drainingAllowed(path string) bool {
+	for _, p := range r.DrainingAllowlist {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the value of a Retry-After header for the duration, in whole
+// seconds rounded up and at least 1.
+func retryAfter(d time.Duration) string {
+	secs := int64((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
+type prefixHandler struct {
+	prefix  string
+	handler http.Handler
+}
+
+// NotFoundFor registers a handler which is called instead of NotFound for
+// requests which can not be routed and have a path below the given prefix.
+// The prefix is cleaned like the prefix of a Group and matches whole path
+// segments only, e.g. /api matches /api and /api/users but not /apis. If
+// several prefixes match, the longest one is used.
+func (r *Router) NotFoundFor(prefix string, handler http.Handler) {
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+	prefix = cleanPrefix(prefix)
+
+	// Keep the handlers sorted by descending prefix length
+	i := 0
+	for i < len(r.notFoundFor) && len(r.notFoundFor[i].prefix) >= len(prefix) {
+		if r.notFoundFor[i].prefix == prefix {
+			r.notFoundFor[i].handler = handler
+			return
+		}
+		i++
+	}
+	r.notFoundFor = append(r.notFoundFor, prefixHandler{})
+	copy(r.notFoundFor[i+1:], r.notFoundFor[i:])
+	r.notFoundFor[i] = prefixHandler{prefix: prefix, handler: handler}
+}
+
+// AddNotFoundHandler appends a handler to the chain of handlers which are
+// tried in the order they were added when no matching route is found, e.g.
+// a plugin router followed by a static file server. A handler declines a
+// request by neither writing the header nor the body of the response; the
+// writes are detected like by ResponseWriter.Written. The next handler is
+// tried then, and if no handler of the chain responds, the request is
+// handled by the NotFoundFor handler of its path or by NotFound as usual.
+// A declining handler must not modify the header either, since it is shared
+// with the next handlers.
+// Fallback takes precedence over the chain. A host router (see Host) with a
+// chain does not fall back to the host-agnostic routes, like a host router
+// with NotFound.
+func (r *Router) AddNotFoundHandler(h http.Handler) {
+	if h == nil {
+		panic("handler must not be nil")
+	}
+	r.notFoundChain = append(r.notFoundChain, h)
+}
+
+// Returns the NotFoundFor handler with the longest prefix matching the path.
+func (r *Router) notFoundHandler(path string) http.Handler {
+	for _, ph := range r.notFoundFor {
+		if strings.HasPrefix(path, ph.prefix) &&
+			(len(path) == len(ph.prefix) || path[len(ph.prefix)] == '/') {
+			return ph.handler
+		}
+	}
+	return nil
+}
+
+// Replaces the method of the request by the override method, if any.
+func (r *Router) overrideMethod(req *http.Request) {
+	var method string
+	if r.MethodOverrideHeader != "" {
+		method = req.Header.Get(r.MethodOverrideHeader)
+	}
+	if method == "" && r.MethodOverrideField != "" {
+		method = req.PostFormValue(r.MethodOverrideField)
+	}
+
+	switch method = strings.ToUpper(method); method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		req.Method = method
+	}
+}
+
+// Sets the path of the URL to the routed path, which is escaped if
+// UnescapePathParams is enabled. The URL is then safe to use as Location of
+// a redirect, since URL.String escapes characters like ' ', '?' and '#' in
+// the path, unless they are already escaped in RawPath.
+func (r *Router) setURLPath(u *url.URL, path string) {
+	if r.UnescapePathParams {
+		if p, ok := unescape(path, false); ok {
+			u.Path, u.RawPath = p, path
 			return
-		} else if req.Method != http.MethodConnect && path != "/" {
-			// Moved Permanently, request with GET method
-			code := http.StatusMovedPermanently
-			if req.Method != http.MethodGet {
-				// Permanent Redirect, request with same method
-				code = http.StatusPermanentRedirect
+		}
+	}
+	u.Path = path
+}
+
+// Returns a copy of the request with the given path, see setURLPath.
+func (r *Router) withURLPath(req *http.Request, path string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *req
+	r2.URL = new(url.URL)
+	*r2.URL = *req.URL
+	r2.URL.RawPath = ""
+	r.setURLPath(r2.URL, path)
+	return r2
+}
+
+// Removes the leading slash of the value of a catch-all parameter in params
+// returned by getValue. The catch-all is always the last parameter, and only
+// its value can begin with a slash.
+func trimCatchAll(ps Params) {
+	if i := len(ps) - 1; i >= 0 && len(ps[i].Value) > 0 && ps[i].Value[0] == '/' {
+		ps[i].Value = ps[i].Value[1:]
+	}
+}
+
+// Replaces the value of a catch-all parameter in params returned by getValue
+// for the collapsed path of the route fullPath by the corresponding part of
+// the uncollapsed path, so it keeps its multiple slashes. Like the value, the
+// part begins with a single slash. The value is located by its offset in the
+// collapsed path, since a static suffix of the route may follow it.
+func uncollapseCatchAll(ps Params, path, uncollapsed, fullPath string) {
+	i := len(ps) - 1
+	if i < 0 || len(ps[i].Value) == 0 || ps[i].Value[0] != '/' {
+		return
+	}
+	end := len(path) - len(catchAllSuffix(fullPath))
+	start := end - len(ps[i].Value)
+	if start < 0 {
+		return
+	}
+
+	// k is the index in the collapsed path of the byte at j
+	from, to := -1, len(uncollapsed)
+	k := 0
+	for j := 0; j < len(uncollapsed); j++ {
+		if uncollapsed[j] == '/' && j > 0 && uncollapsed[j-1] == '/' {
+			// Of multiple slashes only one remains in the collapsed path, the
+			// value begins after the last one
+			if k-1 == start {
+				from = j
 			}
+			continue
+		}
+		if k == start {
+			from = j
+		}
+		if k == end {
+			to = j
+			break
+		}
+		k++
+	}
+	if from >= 0 {
+		ps[i].Value = uncollapsed[from:to]
+	}
+}
 
-			if tsr && r.RedirectTrailingSlash {
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					req.URL.Path = path[:len(path)-1]
-				} else {
-					req.URL.Path = path + "/"
-				}
-				http.Redirect(w, req, req.URL.String(), code)
-				return
+// Returns the static suffix following the catch-all parameter of the route
+// path, e.g. /info for /proxy/*target/info.
+func catchAllSuffix(fullPath string) string {
+	i := strings.Index(fullPath, "/*")
+	if i < 0 {
+		return ""
+	}
+	if j := strings.IndexByte(fullPath[i+2:], '/'); j >= 0 {
+		return fullPath[i+2+j:]
+	}
+	return ""
+}
+
+// Returns the value of a catch-all parameter with the leading slash, which is
+// omitted if CatchAllNoLeadingSlash is enabled.
+func withLeadingSlash(value string) string {
+	if len(value) == 0 || value[0] != '/' {
+		return "/" + value
+	}
+	return value
+}
+
+// Unescapes the values of the params in place. Escaped slashes are kept if
+// keepSlash is true. Reports false if a value contains an invalid escape.
+func unescapeParams(ps Params, keepSlash bool) bool {
+	for i := range ps {
+		value, ok := unescape(ps[i].Value, keepSlash)
+		if !ok {
+			return false
+		}
+		ps[i].Value = value
+	}
+	return true
+}
+
+// Non-standard status code for requests canceled by the client, as used by
+// nginx.
+const statusClientClosedRequest = 499
+
+// Returns the handle of the first route in the trees matching the path, the
+// values of its params and its registered path. If no route matches, tsr
+// reports whether a route exists for the path with (without) a trailing
+// slash. If the path has collapsed slashes, uncollapsed is the request path
+// it was collapsed from, otherwise empty.
+func (r *Router) matchRoute(roots [3]*node, path, uncollapsed string) (handle Handle, ps *Params, tsr bool, fullPath string) {
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		maxParams := root.maxParams
+		var rootTsr bool
+		handle, ps, rootTsr, fullPath = root.getValue(path, func() *Params {
+			return r.newParams(maxParams)
+		}, r.CaseInsensitive)
+		if handle == nil {
+			r.putParams(ps)
+			tsr = tsr || rootTsr
+			continue
+		}
+		if uncollapsed != "" && ps != nil {
+			uncollapseCatchAll(*ps, path, uncollapsed, fullPath)
+		}
+		if r.CatchAllNoLeadingSlash && ps != nil {
+			trimCatchAll(*ps)
+		}
+		return handle, ps, false, fullPath
+	}
+	return nil, nil, tsr, ""
+}
+
+// Calls try with the request path and, as long as it reports that no route
+// was found, with the paths ServeHTTP routes instead of redirecting: the path
+// with (without) the trailing slash for IgnoreTrailingSlash and the path with
+// collapsed slashes for CollapseSlashes, along with the uncollapsed path.
+// Returns the tsr reported for the request path and whether a route was found.
+func (r *Router) tryPaths(path string, try func(path, uncollapsed string) (tsr, ok bool)) (tsr, ok bool) {
+	if tsr, ok = try(path, ""); ok {
+		return false, true
+	}
+	if tsr && r.IgnoreTrailingSlash && path != "/" {
+		if _, ok = try(toggleTrailingSlash(path), ""); ok {
+			return false, true
+		}
+	}
+	if r.CollapseSlashes {
+		if collapsed := collapseSlashes(path); collapsed != path {
+			if _, ok = try(collapsed, path); ok {
+				return false, true
+			}
+		}
+	}
+	return tsr, false
+}
+
+// Returns the path ServeHTTP redirects a request for the path without a
+// route to, or an empty string if it is not redirected. trailingSlash reports
+// whether it is a redirect of RedirectTrailingSlash rather than of
+// RedirectFixedPath. If loop is true, the redirect is suppressed by
+// DetectRedirectLoop.
+func (r *Router) redirectPath(req *http.Request, roots [3]*node, path string, tsr, rewritten bool) (target string, trailingSlash, loop bool) {
+	if roots == [3]*node{} || req.Method == http.MethodConnect || path == "/" || rewritten {
+		return "", false, false
+	}
+
+	if tsr && r.RedirectTrailingSlash {
+		target, trailingSlash = toggleTrailingSlash(path), true
+	} else if r.RedirectFixedPath {
+		// Try to fix the request path
+		fixed := path
+		if r.UnescapePathParams {
+			fixed = normalizeEscapes(path)
+		}
+		for _, root := range roots {
+			if root == nil {
+				continue
 			}
+			fixedPath, found := root.findCaseInsensitivePath(
+				r.cleanPath(fixed, r.UnescapePathParams),
+				r.RedirectTrailingSlash,
+			)
+			if found {
+				target = fixedPath
+				break
+			}
+		}
+	}
+	if target == "" {
+		return "", false, false
+	}
+	return target, trailingSlash, r.DetectRedirectLoop && !r.routesDirectly(req, roots, target)
+}
 
-			// Try to fix the request path
-			if r.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
-					CleanPath(path),
-					r.RedirectTrailingSlash,
-				)
-				if found {
-					req.URL.Path = fixedPath
-					http.Redirect(w, req, req.URL.String(), code)
-					return
-				}
+// Calls the handle of the first route in the trees matching the path.
+// Reports whether a route was found, otherwise whether a route exists for the
+// path with (without) a trailing slash. If the path has collapsed slashes,
+// uncollapsed is the request path it was collapsed from, otherwise empty.
+func (r *Router) serveRoute(w http.ResponseWriter, req *http.Request, roots [3]*node, path, uncollapsed string, hostParams Params, matched *Params) (tsr, ok bool) {
+	handle, ps, tsr, fullPath := r.matchRoute(roots, path, uncollapsed)
+	if handle == nil {
+		return tsr, false
+	}
+	if r.CheckContextCanceled && req.Context().Err() != nil {
+		r.putParams(ps)
+		if r.ContextCanceled != nil {
+			r.ContextCanceled.ServeHTTP(w, req)
+		} else {
+			http.Error(w, "Client Closed Request", statusClientClosedRequest)
+		}
+		return false, true
+	}
+	if r.UnescapePathParams && ps != nil && !unescapeParams(*ps, !r.DecodeSlashInParams) {
+		r.putParams(ps)
+		if r.InvalidPath != nil {
+			r.InvalidPath.ServeHTTP(w, req)
+		} else {
+			http.Error(w,
+				http.StatusText(http.StatusBadRequest),
+				http.StatusBadRequest,
+			)
+		}
+		return false, true
+	}
+	if len(hostParams) > 0 {
+		ps = r.withHostParams(hostParams, ps)
+	}
+	if r.SaveMatchedRoutePath {
+		ps = r.saveMatchedRoutePath(ps, fullPath)
+	}
+	if r.UseContext && ps != nil && len(*ps) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), ParamsKey, *ps))
+	}
+	if req.Method == http.MethodOptions {
+		allowed := r.Allowed(path, http.MethodOptions)
+		if allowed == nil {
+			allowed = []string{http.MethodOptions}
+		}
+		req = req.WithContext(context.WithValue(req.Context(), allowedKey{}, allowed))
+	}
+	if matched != nil && ps != nil {
+		*matched = *ps
+	}
+	if r.OnMatch != nil {
+		var params Params
+		if ps != nil {
+			params = *ps
+		}
+		r.OnMatch(fullPath, req.Method, params)
+	}
+	var rw *responseWriter
+	if r.EmptyResponseHandler != nil {
+		rw = &responseWriter{ResponseWriter: w}
+		w = rw
+	}
+	if ps != nil {
+		handle(w, req, *ps)
+	} else {
+		handle(w, req, nil)
+	}
+	if rw != nil && !rw.Written() && !rw.hijacked {
+		r.EmptyResponseHandler.ServeHTTP(w, req)
+	}
+	r.putParams(ps)
+	return false, true
+}
+
+// Adds a trailing slash to the path or removes it.
+func toggleTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// Reports whether the path contains a C0 control character or DEL.
+func hasControlChar(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if c := path[i]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the path of the request which is routed, and whether it was changed
+// by PathRewrite.
+func (r *Router) requestPath(req *http.Request) (path string, rewritten bool) {
+	path = req.URL.Path
+	if r.UnescapePathParams {
+		path = req.URL.EscapedPath()
+	}
+	if r.PathRewrite != nil {
+		p := r.PathRewrite(path)
+		path, rewritten = p, p != path
+	}
+	if r.CleanPathBeforeRouting && req.Method != http.MethodConnect {
+		path = r.cleanPath(path, r.UnescapePathParams)
+	}
+	return path, rewritten
+}
+
+// Cleans the path with the PathCleaner, or CleanPath if it is nil. If escaped
+// is true, CleanPathDecoded is used instead of CleanPath.
+func (r *Router) cleanPath(path string, escaped bool) string {
+	if r.PathCleaner != nil {
+		return r.PathCleaner(path)
+	}
+	if escaped {
+		return CleanPathDecoded(path)
+	}
+	return CleanPath(path)
+}
+
+// Dispatches the request to the routes of the router. The given host params
+// are prepended to the params of the matched route. If matched is not nil, the
+// params of the matched route are stored in it before the handle is called.
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, hostParams Params, matched *Params) {
+	orig := req
+	path, rewritten := r.requestPath(req)
+	if rewritten && r.RewriteURLPath {
+		req = r.withURLPath(req, path)
+	}
+
+	// A route of the request method wins over a wildcard method route
+	roots := r.roots(req.Method)
+	tsr, ok := r.tryPaths(path, func(path, uncollapsed string) (bool, bool) {
+		return r.serveRoute(w, req, roots, path, uncollapsed, hostParams, matched)
+	})
+	if ok {
+		return
+	}
+
+	// A route of a following host Router or of the host-agnostic routes wins
+	// over the redirects and 405 responses of a host Router
+	if r.fallsBack(path) {
+		if next, nextParams := r.parent.routingAfterHost(orig, r); next != nil {
+			next.serve(w, orig, nextParams, matched)
+			return
+		}
+	}
+
+	if target, trailingSlash, loop := r.redirectPath(req, roots, path, tsr, rewritten); loop {
+		r.redirectLoop(w, req, path, target, matched)
+		return
+	} else if target != "" {
+		// Moved Permanently, request with GET method
+		code := http.StatusMovedPermanently
+		if r.RedirectStatusCode != 0 {
+			code = validRedirectCode(r.RedirectStatusCode)
+		} else if req.Method != http.MethodGet {
+			// Permanent Redirect, request with same method
+			code = http.StatusPermanentRedirect
+		}
+
+		if trailingSlash {
+			if r.LogTrailingSlashRedirects && r.Logger != nil {
+				r.Logger("httprouter: redirecting %s %s to %s (trailing slash)", req.Method, path, target)
 			}
+			code = r.trailingSlashRedirectCode(req.Method, code)
+		} else if r.Logger != nil {
+			r.Logger("httprouter: redirecting %s %s to fixed path %s", req.Method, path, target)
 		}
+		r.setURLPath(req.URL, target)
+		http.Redirect(w, req, req.URL.String(), code)
+		return
+	}
+
+	if r.UnknownMethod != nil && roots == [3]*node{} &&
+		!(req.Method == http.MethodOptions && r.HandleOPTIONS) {
+		r.UnknownMethod.ServeHTTP(w, req)
+		return
 	}
 
 	if req.Method == http.MethodOptions && r.HandleOPTIONS {
 		// Handle OPTIONS requests
 		if allow := r.allowed(path, http.MethodOptions); allow != "" {
 			w.Header().Set("Allow", allow)
+			if r.CORS != nil && path != "*" {
+				r.CORS.setPreflightHeaders(w.Header(), req, allow)
+			}
 			if r.GlobalOPTIONS != nil {
 				r.GlobalOPTIONS.ServeHTTP(w, req)
 			}
@@ -481,6 +2097,8 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			w.Header().Set("Allow", allow)
 			if r.MethodNotAllowed != nil {
 				r.MethodNotAllowed.ServeHTTP(w, req)
+			} else if r.MethodNotAllowedWithAllowed != nil {
+				r.MethodNotAllowedWithAllowed(w, req, strings.Split(allow, ", "))
 			} else {
 				http.Error(w,
 					http.StatusText(http.StatusMethodNotAllowed),
@@ -492,7 +2110,71 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Handle 404
-	if r.NotFound != nil {
+	r.notFound(w, req, path, matched)
+}
+
+// Reports whether a request like req, but for the redirect target, would be
+// handled by a route of the trees without another redirect. The target is
+// routed like the path of a request, e.g. rewritten by PathRewrite and
+// cleaned with CleanPathBeforeRouting.
+func (r *Router) routesDirectly(req *http.Request, roots [3]*node, target string) bool {
+	path, _ := r.requestPath(r.withURLPath(req, target))
+	return r.routesPath(roots, path)
+}
+
+// Reports whether a route of the trees matches the routed path of a request
+// directly or with IgnoreTrailingSlash or CollapseSlashes.
+func (r *Router) routesPath(roots [3]*node, path string) bool {
+	_, ok := r.tryPaths(path, func(path, _ string) (tsr, ok bool) {
+		for _, root := range roots {
+			if root == nil {
+				continue
+			}
+			handle, _, rootTsr, _ := root.getValue(path, nil, r.CaseInsensitive)
+			if handle != nil {
+				return false, true
+			}
+			tsr = tsr || rootTsr
+		}
+		return tsr, false
+	})
+	return ok
+}
+
+// Handles a request whose redirect to target would be followed by another
+// redirect as not found, see DetectRedirectLoop.
+func (r *Router) redirectLoop(w http.ResponseWriter, req *http.Request, path, target string, matched *Params) {
+	if r.Logger != nil {
+		r.Logger("httprouter: not redirecting %s %s to %s, which would not be routed directly", req.Method, path, target)
+	}
+	r.notFound(w, req, path, matched)
+}
+
+// Handles a request for which no route matches the path.
+func (r *Router) notFound(w http.ResponseWriter, req *http.Request, path string, matched *Params) {
+	if r.Fallback != nil {
+		r.Fallback.ServeHTTP(w, req)
+		return
+	}
+	if r.fallsBack(path) {
+		// Fall back to the next host or the host-agnostic routes
+		r.parent.serveAfterHost(w, req, r, matched)
+		return
+	}
+	h := r.notFoundHandler(path)
+	for _, handler := range r.notFoundChain {
+		rw := &responseWriter{ResponseWriter: w}
+		handler.ServeHTTP(rw, req)
+		if rw.Written() {
+			return
+		}
+	}
+	if r.OnNotFound != nil {
+		r.OnNotFound(req.Method, path)
+	}
+	if h != nil {
+		h.ServeHTTP(w, req)
+	} else if r.NotFound != nil {
 		r.NotFound.ServeHTTP(w, req)
 	} else {
 		http.NotFound(w, req)
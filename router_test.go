@@ -5,12 +5,23 @@
 package httprouter
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type mockResponseWriter struct{}
@@ -76,7 +87,7 @@ func (h handlerStruct) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func TestRouterAPI(t *testing.T) {
-	var get, head, options, post, put, patch, delete, handler, handlerFunc bool
+	var get, head, options, post, put, patch, delete, connect, trace, handler, handlerFunc bool
 
 	httpHandler := handlerStruct{&handler}
 
@@ -102,6 +113,12 @@ func TestRouterAPI(t *testing.T) {
 	router.DELETE("/DELETE", func(w http.ResponseWriter, r *http.Request, _ Params) {
 		delete = true
 	})
+	router.CONNECT("/CONNECT", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		connect = true
+	})
+	router.TRACE("/TRACE", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		trace = true
+	})
 	router.Handler(http.MethodGet, "/Handler", httpHandler)
 	router.HandlerFunc(http.MethodGet, "/HandlerFunc", func(w http.ResponseWriter, r *http.Request) {
 		handlerFunc = true
@@ -151,6 +168,18 @@ func TestRouterAPI(t *testing.T) {
 		t.Error("routing DELETE failed")
 	}
 
+	r, _ = http.NewRequest(http.MethodConnect, "/CONNECT", nil)
+	router.ServeHTTP(w, r)
+	if !connect {
+		t.Error("routing CONNECT failed")
+	}
+
+	r, _ = http.NewRequest(http.MethodTrace, "/TRACE", nil)
+	router.ServeHTTP(w, r)
+	if !trace {
+		t.Error("routing TRACE failed")
+	}
+
 	r, _ = http.NewRequest(http.MethodGet, "/Handler", nil)
 	router.ServeHTTP(w, r)
 	if !handler {
@@ -164,310 +193,2650 @@ func TestRouterAPI(t *testing.T) {
 	}
 }
 
-func TestRouterInvalidInput(t *testing.T) {
+func TestRouterCONNECT(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
 	router := New()
+	router.CleanPathBeforeRouting = true
+	router.GET("/tunnel", handle("get"))
+	router.CONNECT("/tunnel", handle("connect"))
+	router.TRACE("/tunnel", handle("trace"))
+	router.Group("/api").CONNECT("/tunnel", handle("api connect"))
+	router.Group("/api").TRACE("/tunnel", handle("api trace"))
+
+	tests := []struct {
+		method, path string
+		code         int
+		routed       string
+	}{
+		{http.MethodConnect, "/tunnel", http.StatusOK, "connect"},
+		{http.MethodTrace, "/tunnel", http.StatusOK, "trace"},
+		{http.MethodConnect, "/api/tunnel", http.StatusOK, "api connect"},
+		{http.MethodTrace, "/api/tunnel", http.StatusOK, "api trace"},
+		{http.MethodConnect, "/tunnel/", http.StatusNotFound, ""},
+		{http.MethodConnect, "/x/../tunnel", http.StatusNotFound, ""},
+		{http.MethodTrace, "/x/../tunnel", http.StatusOK, "trace"},
+		{http.MethodConnect, "", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, "/", nil)
+		r.URL.Path = test.path
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s %s: got Code %d and %q, want %d and %q",
+				test.method, test.path, w.Code, routed, test.code, test.routed)
+		}
+	}
 
-	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	// The Allow header lists the methods in canonical order
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodOptions, "/tunnel", nil)
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, CONNECT, OPTIONS, TRACE" {
+		t.Errorf("unexpected Allow header: %q", allow)
+	}
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/tunnel", nil)
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "GET, CONNECT, OPTIONS, TRACE" {
+		t.Errorf("unexpected 405 response: Code=%d, Allow=%q", w.Code, allow)
+	}
+}
 
-	recv := catchPanic(func() {
-		router.Handle("", "/", handle)
-	})
-	if recv == nil {
-		t.Fatal("registering empty method did not panic")
+func TestRouterHandles(t *testing.T) {
+	var methods []string
+	handle := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		methods = append(methods, r.Method)
 	}
 
-	recv = catchPanic(func() {
-		router.GET("", handle)
-	})
-	if recv == nil {
-		t.Fatal("registering empty path did not panic")
+	router := New()
+	router.Handles([]string{http.MethodGet, http.MethodHead}, "/both", handle)
+	router.Any("/any", handle)
+	router.Group("/api").Any("/any", handle)
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		if h, _, _ := router.Lookup(method, "/both"); h == nil {
+			t.Errorf("Handles: got no handle for %s", method)
+		}
+	}
+	if h, _, _ := router.Lookup(http.MethodPost, "/both"); h != nil {
+		t.Error("Handles: got handle for unregistered method")
 	}
 
-	recv = catchPanic(func() {
-		router.GET("noSlashRoot", handle)
+	methods = nil
+	for _, path := range []string{"/any", "/api/any"} {
+		for _, method := range anyMethods {
+			r, _ := http.NewRequest(method, path, nil)
+			router.ServeHTTP(new(mockResponseWriter), r)
+		}
+	}
+	if want := append(append([]string(nil), anyMethods...), anyMethods...); !reflect.DeepEqual(methods, want) {
+		t.Errorf("Any: routed methods %v, want %v", methods, want)
+	}
+
+	// OPTIONS is still handled automatically
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodOptions, "/any", nil)
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS" {
+		t.Errorf("unexpected Allow header for Any route: %q", allow)
+	}
+
+	// Duplicate routes still panic per method
+	recv := catchPanic(func() {
+		router.Handles([]string{http.MethodPost, http.MethodGet}, "/both", handle)
 	})
 	if recv == nil {
-		t.Fatal("registering path not beginning with '/' did not panic")
+		t.Error("registering duplicate route with Handles did not panic")
+	}
+	if h, _, _ := router.Lookup(http.MethodPost, "/both"); h == nil {
+		t.Error("Handles did not register the methods before the conflict")
 	}
 
 	recv = catchPanic(func() {
-		router.GET("/", nil)
+		router.Handles(nil, "/none", handle)
 	})
 	if recv == nil {
-		t.Fatal("registering nil handler did not panic")
+		t.Error("Handles without methods did not panic")
 	}
 }
 
-func TestRouterChaining(t *testing.T) {
-	router1 := New()
-	router2 := New()
-	router1.NotFound = router2
-
-	fooHit := false
-	router1.POST("/foo", func(w http.ResponseWriter, req *http.Request, _ Params) {
-		fooHit = true
-		w.WriteHeader(http.StatusOK)
+func TestRouterAutoHEAD(t *testing.T) {
+	router := New()
+	router.AutoHEAD = true
+	router.GET("/get", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Route", "get")
+		io.WriteString(w, "body")
 	})
-
-	barHit := false
-	router2.POST("/bar", func(w http.ResponseWriter, req *http.Request, _ Params) {
-		barHit = true
-		w.WriteHeader(http.StatusOK)
+	router.GET("/both", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Route", "get")
+	})
+	router.HEAD("/both", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Route", "head")
 	})
 
-	r, _ := http.NewRequest(http.MethodPost, "/foo", nil)
-	w := httptest.NewRecorder()
-	router1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK && fooHit) {
-		t.Errorf("Regular routing failed with router chaining.")
-		t.FailNow()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	res, err := http.Head(server.URL + "/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("X-Route") != "get" {
+		t.Errorf("HEAD /get: Code=%d, Header=%v", res.StatusCode, res.Header)
+	}
+	if res.ContentLength != 4 || len(body) != 0 {
+		t.Errorf("HEAD /get: got Content-Length %d and body %q", res.ContentLength, body)
 	}
 
-	r, _ = http.NewRequest(http.MethodPost, "/bar", nil)
-	w = httptest.NewRecorder()
-	router1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK && barHit) {
-		t.Errorf("Chained routing failed with router chaining.")
-		t.FailNow()
+	// Explicit HEAD routes take priority
+	res, err = http.Head(server.URL + "/both")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Header.Get("X-Route") != "head" {
+		t.Errorf("HEAD /both: routed to %q, want head", res.Header.Get("X-Route"))
 	}
 
-	r, _ = http.NewRequest(http.MethodPost, "/qax", nil)
-	w = httptest.NewRecorder()
-	router1.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("NotFound behavior failed with router chaining.")
-		t.FailNow()
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/get", nil)
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("POST /get: Code=%d, Allow=%q", w.Code, allow)
+	}
+	if allow := router.allowed("/both", http.MethodOptions); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("unexpected Allow for /both: %q", allow)
+	}
+	if allow := router.allowed("*", ""); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("unexpected server-wide Allow: %q", allow)
+	}
+
+	// Disabled
+	router.AutoHEAD = false
+	if h, _, _ := router.Lookup(http.MethodHead, "/get"); h != nil {
+		t.Error("HEAD handled by GET route with AutoHEAD disabled")
 	}
 }
 
-func BenchmarkAllowed(b *testing.B) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+func TestRouterUnescapePathParams(t *testing.T) {
+	var routed string
+	handle := func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = ps.ByName("name") + ps.ByName("filepath")
+		w.WriteHeader(http.StatusOK)
+	}
 
 	router := New()
-	router.POST("/path", handlerFunc)
-	router.GET("/path", handlerFunc)
-
-	b.Run("Global", func(b *testing.B) {
-		b.ReportAllocs()
-		for i := 0; i < b.N; i++ {
-			_ = router.allowed("*", http.MethodOptions)
+	router.UnescapePathParams = true
+	router.GET("/files/:name", handle)
+	router.GET("/src/*filepath", handle)
+	router.GET("/caf%C3%A9", handle)
+	router.GET("/dir/:name/", handle)
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+	}{
+		{"/files/john%20doe", http.StatusOK, "john doe"},
+		{"/files/a%2Fb", http.StatusOK, "a%2Fb"},
+		{"/files/a/b", http.StatusNotFound, ""},
+		{"/src/a%2Fb/c%20d", http.StatusOK, "/a%2Fb/c d"},
+		{"/caf%C3%A9", http.StatusOK, ""},
+	}
+	check := func() {
+		for _, test := range tests {
+			routed = ""
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != test.code || routed != test.routed {
+				t.Errorf("%s: got Code %d and value %q, want %d and %q", test.path, w.Code, routed, test.code, test.routed)
+			}
 		}
-	})
-	b.Run("Path", func(b *testing.B) {
-		b.ReportAllocs()
-		for i := 0; i < b.N; i++ {
-			_ = router.allowed("/path", http.MethodOptions)
+	}
+	check()
+
+	// Decode escaped slashes in values
+	router.DecodeSlashInParams = true
+	tests[1].routed = "a/b"
+	tests[3].routed = "/a/b/c d"
+	check()
+	router.DecodeSlashInParams = false
+
+	// Redirects keep the escaping
+	redirects := []struct {
+		path     string
+		location string
+	}{
+		{"/dir/a%2Fb", "/dir/a%2Fb/"},
+		{"/CAF%C3%A9", "/caf%C3%A9"},
+		{"/x/%2e%2e/caf%C3%A9", "/caf%C3%A9"},
+		{"/caf%c3%a9", "/caf%C3%A9"},
+		{"/%64ir/%61/", "/dir/a/"},
+		{"/%46ILES/john%20doe", "/files/john%20doe"},
+	}
+	for _, test := range redirects {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: Code=%d, Location=%q, want %q", test.path, w.Code, w.Header().Get("Location"), test.location)
 		}
-	})
-}
-
-func TestRouterOPTIONS(t *testing.T) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
-
-	router := New()
-	router.POST("/path", handlerFunc)
+	}
 
-	// test not allowed
-	// * (server)
-	r, _ := http.NewRequest(http.MethodOptions, "*", nil)
+	// Encoded slashes are not decoded to find a route
 	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/%66iles%2Fa", nil)
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/%%66iles%%2Fa: Code=%d, want %d", w.Code, http.StatusNotFound)
 	}
 
-	// path
-	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	// Invalid escapes in values are rejected
+	ps := Params{{"name", "a%zz"}}
+	if unescapeParams(ps, false) {
+		t.Error("unescapeParams accepted invalid escape")
 	}
 
-	r, _ = http.NewRequest(http.MethodOptions, "/doesnotexist", nil)
+	// Disabled, the decoded path is routed
+	router.UnescapePathParams = false
+	routed = ""
+	r, _ = http.NewRequest(http.MethodGet, "/files/a%2Fb", nil)
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	if w.Code != http.StatusNotFound {
+		t.Errorf("disabled: got Code %d for escaped slash, want 404", w.Code)
 	}
+}
 
-	// add another method
-	router.GET("/path", handlerFunc)
-
-	// set a global OPTIONS handler
-	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Adjust status code to 204
-		w.WriteHeader(http.StatusNoContent)
-	})
-
-	// test again
-	// * (server)
-	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNoContent) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+func TestRouterInvalidPath(t *testing.T) {
+	var routed string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = ps.ByName("name") + ps.ByName("path")
 	}
 
-	// path
-	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNoContent) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	router := New()
+	router.UnescapePathParams = true
+	router.CleanPathBeforeRouting = true
+	// Decodes a double escaping, which may produce invalid escapes
+	router.PathCleaner = func(path string) string {
+		return strings.Replace(path, "%25", "%", -1)
 	}
+	router.GET("/files/:name", handle)
+	router.GET("/src/*path", handle)
 
-	// custom handler
-	var custom bool
-	router.OPTIONS("/path", func(w http.ResponseWriter, r *http.Request, _ Params) {
-		custom = true
-	})
-
-	// test again
-	// * (server)
-	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNoContent) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+	}{
+		{"/files/a%25zz", http.StatusBadRequest, ""},
+		{"/files/a%252", http.StatusBadRequest, ""},
+		{"/src/a/%25", http.StatusBadRequest, ""},
+		{"/files/a%2520b", http.StatusOK, "a b"},
+		{"/src/a/%25C3%25A9", http.StatusOK, "/a/\u00e9"},
 	}
-	if custom {
-		t.Error("custom handler called on *")
+	check := func() {
+		for _, test := range tests {
+			routed = ""
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != test.code || routed != test.routed {
+				t.Errorf("%s: got Code %d and %q, want %d and %q", test.path, w.Code, routed, test.code, test.routed)
+			}
+		}
 	}
+	check()
 
-	// path
-	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
-	w = httptest.NewRecorder()
-	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusOK) {
-		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	}
-	if !custom {
-		t.Error("custom handler not called")
+	router.InvalidPath = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	})
+	for i := range tests {
+		if tests[i].code == http.StatusBadRequest {
+			tests[i].code = http.StatusUnprocessableEntity
+		}
 	}
+	check()
 }
 
-func TestRouterNotAllowed(t *testing.T) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+func TestRouterMethodWildcard(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, r *http.Request, ps Params) {
+			routed = name + " " + r.Method + " " + ps.ByName("path")
+		}
+	}
 
 	router := New()
-	router.POST("/path", handlerFunc)
+	router.Handle(MethodWildcard, "/proxy/*path", handle("proxy"))
+	router.GET("/proxy/*path", handle("get"))
+	router.Handle(MethodWildcard, "/static/", handle("static"))
+	router.GET("/other", handle("other"))
+	router.Handle("PROPFIND", "/dav", handle("dav"))
+
+	tests := []struct {
+		method string
+		path   string
+		routed string
+	}{
+		{http.MethodGet, "/proxy/a", "get GET /a"}, // the specific method wins
+		{http.MethodPost, "/proxy/b", "proxy POST /b"},
+		{http.MethodOptions, "/proxy/c", "proxy OPTIONS /c"},
+		{"PURGE", "/proxy/d", "proxy PURGE /d"},
+		{http.MethodDelete, "/static/", "static DELETE "},
+		{http.MethodGet, "/static/", "static GET "},
+	}
+	for _, test := range tests {
+		routed = ""
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if routed != test.routed {
+			t.Errorf("%s %s: routed to %q, want %q", test.method, test.path, routed, test.routed)
+		}
+	}
 
-	// test not allowed
-	r, _ := http.NewRequest(http.MethodGet, "/path", nil)
+	// Redirects consider the wildcard routes
 	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPut, "/static", nil)
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusMethodNotAllowed) {
-		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "/static/" {
+		t.Errorf("trailing slash redirect failed: Code=%d, Header=%v", w.Code, w.Header())
 	}
 
-	// add another method
-	router.DELETE("/path", handlerFunc)
-	router.OPTIONS("/path", handlerFunc) // must be ignored
-
-	// test again
-	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	// 405 for the specific routes
 	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodPost, "/other", nil)
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusMethodNotAllowed) {
-		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
-	} else if allow := w.Header().Get("Allow"); allow != "DELETE, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("method not allowed failed: Code=%d, Header=%v", w.Code, w.Header())
 	}
 
-	// test custom handler
+	// Paths of wildcard routes allow all methods
+	const all = "GET, HEAD, POST, PUT, PATCH, DELETE, CONNECT, OPTIONS, TRACE, PROPFIND"
+	if allow := router.allowed("/proxy/a", http.MethodOptions); allow != all {
+		t.Errorf("unexpected Allow for wildcard route: %q", allow)
+	}
 	w = httptest.NewRecorder()
-	responseText := "custom method"
-	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		w.WriteHeader(http.StatusTeapot)
-		w.Write([]byte(responseText))
-	})
+	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
 	router.ServeHTTP(w, r)
-	if got := w.Body.String(); !(got == responseText) {
-		t.Errorf("unexpected response got %q want %q", got, responseText)
+	if allow := w.Header().Get("Allow"); allow != all {
+		t.Errorf("unexpected server-wide Allow: %q", allow)
 	}
-	if w.Code != http.StatusTeapot {
-		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusTeapot)
+
+	if h, ps, _ := router.Lookup(http.MethodPatch, "/proxy/x"); h == nil || ps.ByName("path") != "/x" {
+		t.Error("Lookup did not fall back to the wildcard route")
 	}
-	if allow := w.Header().Get("Allow"); allow != "DELETE, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+	if res := router.LookupDetailed(http.MethodPatch, "/static"); !res.TrailingSlashRedirect {
+		t.Errorf("LookupDetailed: unexpected result %+v", res)
 	}
 }
 
-func TestRouterNotFound(t *testing.T) {
-	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+func TestRouterMethodOverride(t *testing.T) {
+	var method string
+	handle := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		method = r.Method
+	}
 
 	router := New()
-	router.GET("/path", handlerFunc)
-	router.GET("/dir/", handlerFunc)
-	router.GET("/", handlerFunc)
-
-	testRoutes := []struct {
-		route    string
-		code     int
-		location string
+	router.Handles([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, "/path", handle)
+	router.MethodOverrideHeader = "X-HTTP-Method-Override"
+	router.MethodOverrideField = "_method"
+
+	tests := []struct {
+		method string
+		header string
+		field  string
+		want   string
 	}{
-		{"/path/", http.StatusMovedPermanently, "/path"},   // TSR -/
-		{"/dir", http.StatusMovedPermanently, "/dir/"},     // TSR +/
-		{"", http.StatusMovedPermanently, "/"},             // TSR +/
-		{"/PATH", http.StatusMovedPermanently, "/path"},    // Fixed Case
-		{"/DIR/", http.StatusMovedPermanently, "/dir/"},    // Fixed Case
+		{http.MethodPost, "", "", http.MethodPost},
+		{http.MethodPost, "PUT", "", http.MethodPut},
+		{http.MethodPost, "delete", "", http.MethodDelete},
+		{http.MethodPost, "", "DELETE", http.MethodDelete},
+		{http.MethodPost, "PUT", "DELETE", http.MethodPut},
+		{http.MethodPost, "GET", "", http.MethodPost},
+		{http.MethodPost, "CONNECT", "PUT", http.MethodPost},
+		{http.MethodGet, "DELETE", "", http.MethodGet},
+	}
+	for _, test := range tests {
+		method = ""
+		var body io.Reader
+		if test.field != "" {
+			body = strings.NewReader(url.Values{"_method": {test.field}}.Encode())
+		}
+		r, _ := http.NewRequest(test.method, "/path", body)
+		if test.header != "" {
+			r.Header.Set("X-HTTP-Method-Override", test.header)
+		}
+		if body != nil {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if method != test.want {
+			t.Errorf("%s with header %q and field %q: routed as %q, want %q",
+				test.method, test.header, test.field, method, test.want)
+		}
+	}
+
+	// The overridden method is used for 405 responses
+	r, _ := http.NewRequest(http.MethodPost, "/path", nil)
+	r.Header.Set("X-HTTP-Method-Override", "PATCH")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("overridden method without handle: want 405, got %d", w.Code)
+	}
+}
+
+func TestRouterInvalidInput(t *testing.T) {
+	router := New()
+
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	recv := catchPanic(func() {
+		router.Handle("", "/", handle)
+	})
+	if recv == nil {
+		t.Fatal("registering empty method did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.GET("", handle)
+	})
+	if recv == nil {
+		t.Fatal("registering empty path did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.GET("noSlashRoot", handle)
+	})
+	if recv == nil {
+		t.Fatal("registering path not beginning with '/' did not panic")
+	}
+
+	recv = catchPanic(func() {
+		router.GET("/", nil)
+	})
+	if recv == nil {
+		t.Fatal("registering nil handler did not panic")
+	}
+}
+
+func TestRouterTryHandle(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	if err := router.TryHandle(http.MethodGet, "/user/:name", handle); err != nil {
+		t.Fatalf("TryHandle failed: %v", err)
+	}
+
+	conflicts := []string{
+		"/user/:name",    // duplicate
+		"/user/:id",      // wildcard conflict
+		"/user/*path",    // wildcard conflict
+		"/other/:a/:b:c", // invalid wildcard
+		"/other/:a/:a",   // duplicate wildcard name
+	}
+	for _, path := range conflicts {
+		err := router.TryHandle(http.MethodGet, path, handle)
+		rce, ok := err.(*RouteConflictError)
+		if !ok {
+			t.Errorf("TryHandle(%q): got %v, want *RouteConflictError", path, err)
+			continue
+		}
+		if rce.Method != http.MethodGet || rce.Path != path || rce.Msg == "" {
+			t.Errorf("TryHandle(%q): unexpected error %#v", path, rce)
+		}
+	}
+
+	// The tree is not affected by the rejected routes
+	for _, path := range []string{"/user/:name/:id", "/other/:x"} {
+		if err := router.TryHandle(http.MethodGet, path, handle); err != nil {
+			t.Errorf("TryHandle(%q) failed after rejected routes: %v", path, err)
+		}
+	}
+
+	if err := router.TryHandle(http.MethodGet, "user", handle); err == nil {
+		t.Error("TryHandle accepted path not beginning with '/'")
+	}
+	if err := router.TryHandle("", "/", handle); err == nil {
+		t.Error("TryHandle accepted empty method")
+	}
+	if err := router.TryHandle(http.MethodGet, "/nil", nil); err == nil {
+		t.Error("TryHandle accepted nil handle")
+	}
+
+	// A rejected route does not create a tree for its method
+	if err := router.TryHandle("CUSTOM", "/:", handle); err == nil {
+		t.Error("TryHandle accepted unnamed wildcard")
+	}
+	if _, ok := router.loadTrees().trees["CUSTOM"]; ok {
+		t.Error("rejected route created a tree")
+	}
+
+	// Handle still panics with the message
+	recv := catchPanic(func() {
+		router.GET("/user/:id", handle)
+	})
+	if rs, ok := recv.(string); !ok || !strings.Contains(rs, "conflicts with existing wildcard") {
+		t.Errorf("unexpected panic: %v", recv)
+	}
+
+	// The error names the route it conflicts with
+	err := router.TryHandle(http.MethodGet, "/other/new", handle)
+	if err == nil || !strings.Contains(err.Error(), "'/other/new'") ||
+		!strings.Contains(err.Error(), "existing route '/other/:x'") {
+		t.Errorf("error does not name both routes: %v", err)
+	}
+}
+
+func TestRouterStrictMethods(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.StrictMethods = true
+	router.RegisterMethod("PURGE")
+
+	for _, method := range []string{"GET", "TRACE", "OPTIONS", MethodWildcard, "PURGE"} {
+		if err := router.TryHandle(method, "/path", handle); err != nil {
+			t.Errorf("%s: %v", method, err)
+		}
+	}
+	for _, method := range []string{"GTE", "get", "PURGED"} {
+		if err := router.TryHandle(method, "/path", handle); err == nil {
+			t.Errorf("%s: unknown method was accepted", method)
+		}
+	}
+	if recv := catchPanic(func() { router.Handle("GTE", "/path", handle) }); recv == nil {
+		t.Error("Handle did not panic for unknown method")
+	}
+	if err := router.TryHandleSafe("GTE", "/safe", handle); err == nil {
+		t.Error("TryHandleSafe accepted unknown method")
+	}
+	if err := router.HandleBatch([]RouteInfo{{"GTE", "/batch", handle}}); err == nil {
+		t.Error("HandleBatch accepted unknown method")
+	}
+	if router.loadTrees().trees["GTE"] != nil {
+		t.Error("tree for unknown method was created")
+	}
+
+	// Disabled by default
+	if err := New().TryHandle("GTE", "/path", handle); err != nil {
+		t.Errorf("unknown method rejected without StrictMethods: %v", err)
+	}
+
+	if recv := catchPanic(func() { router.RegisterMethod("") }); recv == nil {
+		t.Error("registering empty method did not panic")
+	}
+}
+
+func TestRouterHandleSafe(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Write([]byte(ps.ByName("c")))
+	}
+
+	router := New()
+	router.GET("/static", handle)
+
+	const routes = 200
+	done := make(chan struct{})
+	errs := make(chan string, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				r, _ := http.NewRequest(http.MethodGet, "/static", nil)
+				router.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					errs <- fmt.Sprintf("GET /static: code %d", w.Code)
+					return
+				}
+				w = httptest.NewRecorder()
+				r, _ = http.NewRequest(http.MethodGet, "/plugin/0/a/b/c", nil)
+				router.ServeHTTP(w, r)
+				if w.Code == http.StatusOK && w.Body.String() != "c" {
+					errs <- fmt.Sprintf("GET /plugin/0/a/b/c: body %q", w.Body.String())
+					return
+				}
+				router.Lookup(http.MethodPost, "/plugin/1")
+				router.Allowed("/plugin/2", http.MethodGet)
+			}
+		}()
+	}
+
+	for i := 0; i < routes; i++ {
+		path := "/plugin/" + strconv.Itoa(i)
+		if i == 0 {
+			// More params than any route before
+			path += "/:a/:b/:c"
+		}
+		router.HandleSafe(http.MethodGet, path, handle)
+		if i%2 == 0 {
+			router.HandleSafe(http.MethodPost, path, handle)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n := len(router.Routes()); n != 1+routes+routes/2 {
+		t.Errorf("got %d routes, want %d", n, 1+routes+routes/2)
+	}
+	if errs := router.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+
+	recv := catchPanic(func() {
+		router.HandleSafe(http.MethodGet, "/plugin/:id", handle)
+	})
+	if recv == nil {
+		t.Error("conflicting route did not panic")
+	}
+	if err := router.TryHandleSafe(http.MethodGet, "", handle); err == nil {
+		t.Error("TryHandleSafe accepted path not beginning with '/'")
+	}
+	if h, _, _ := router.Lookup(http.MethodGet, "/plugin/:id"); h != nil {
+		t.Error("rejected route was registered")
+	}
+}
+
+func TestRouterHandleBothSlash(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+			routed = name + ps.ByName("id")
+		}
+	}
+
+	router := New()
+	router.HandleBothSlash(http.MethodGet, "/x", handle("x"))
+	router.HandleBothSlash(http.MethodGet, "/users/:id/", handle("user"))
+	router.HandleBothSlash(http.MethodGet, "/", handle("root"))
+	router.Group("/api").HandleBothSlash(http.MethodGet, "/", handle("api"))
+
+	tests := []struct {
+		path   string
+		routed string
+	}{
+		{"/x", "x"},
+		{"/x/", "x"},
+		{"/users/1", "user1"},
+		{"/users/1/", "user1"},
+		{"/", "root"},
+		{"/api", "api"},
+		{"/api/", "api"},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || routed != test.routed {
+			t.Errorf("%s: got Code %d and %q, want 200 and %q", test.path, w.Code, routed, test.routed)
+		}
+	}
+
+	for _, register := range []func(){
+		func() { router.GET("/x/", handle("other")) },
+		func() { router.GET("/users/:id", handle("other")) },
+		func() { router.HandleBothSlash(http.MethodGet, "/src/*path", handle("src")) },
+	} {
+		if recv := catchPanic(register); recv == nil {
+			t.Error("no panic")
+		}
+	}
+}
+
+func TestRouterReset(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	notFound := false
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		notFound = true
+	})
+	router.GET("/a", handle)
+	router.GET("/b/:id", handle)
+	router.POST("/a", handle)
+	router.HandleQuery(http.MethodGet, "/search", "q", handle)
+
+	router.Reset(http.MethodGet)
+	router.Reset(http.MethodPut) // no routes
+
+	if h, _, _ := router.Lookup(http.MethodGet, "/a"); h != nil {
+		t.Error("GET route was not removed")
+	}
+	if h, _, _ := router.Lookup(http.MethodPost, "/a"); h == nil {
+		t.Error("POST route was removed")
+	}
+	if allow := router.allowed("*", ""); allow != "POST, OPTIONS" {
+		t.Errorf("unexpected allowed methods after reset: %q", allow)
+	}
+	if len(router.loadTrees().queries) != 0 {
+		t.Error("query routes were not removed")
+	}
+
+	// Options survive the reset
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/b/1/", nil)
+	router.ServeHTTP(w, r)
+	if !notFound || router.RedirectTrailingSlash {
+		t.Error("options were not kept")
+	}
+
+	// Routes can be registered anew, also for query routes
+	router.GET("/a", handle)
+	router.HandleQuery(http.MethodGet, "/search", "q", handle)
+	if h, _, _ := router.Lookup(http.MethodGet, "/a"); h == nil {
+		t.Error("route was not registered after reset")
+	}
+
+	router.ResetAll()
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if h, _, _ := router.Lookup(method, "/a"); h != nil {
+			t.Errorf("%s route was not removed", method)
+		}
+	}
+	if n := len(router.Routes()); n != 0 {
+		t.Errorf("got %d routes after ResetAll, want 0", n)
+	}
+	if router.NotFound == nil {
+		t.Error("NotFound was not kept")
+	}
+}
+
+func TestRouterResetNamed(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	mustHandleNamed := func(method, path, name string) {
+		if err := router.HandleNamed(method, path, name, handle); err != nil {
+			t.Fatalf("HandleNamed(%s %s, %s) failed: %v", method, path, name, err)
+		}
+	}
+	mustHandleNamed(http.MethodGet, "/users/:id", "user")
+	mustHandleNamed(http.MethodPost, "/users", "users.create")
+
+	// Only the names of the routes of the method are removed
+	router.Reset(http.MethodGet)
+	if _, err := router.URL("user", "id", "1"); err == nil {
+		t.Error("URL built for removed route")
+	}
+	if url, err := router.URL("users.create"); err != nil || url != "/users" {
+		t.Errorf("URL of kept route: got %q, %v", url, err)
+	}
+
+	// The name can be used again
+	mustHandleNamed(http.MethodGet, "/u/:id", "user")
+	if url, err := router.URL("user", "id", "1"); err != nil || url != "/u/1" {
+		t.Errorf("URL of re-registered route: got %q, %v", url, err)
+	}
+
+	router.ResetAll()
+	for _, name := range []string{"user", "users.create"} {
+		if _, err := router.URL(name); err == nil {
+			t.Errorf("URL built for route %s after ResetAll", name)
+		}
+	}
+	mustHandleNamed(http.MethodPost, "/users", "users.create")
+
+	// URLs may be built while the routes are reset
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			router.URL("users.create")
+		}
+	}()
+	router.Reset(http.MethodPost)
+	for i := 0; i < 100; i++ {
+		router.ResetAll()
+	}
+	<-done
+}
+
+func TestRouterOverlappingRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	overlaps := [][2]string{
+		{"/files/*path", "/files/special"},
+		{"/files/special", "/files/*path"},
+		{"/files/:name", "/files/special"},
+		{"/files/:name", "/files/:id"},
+	}
+	for _, paths := range overlaps {
+		router := New()
+		router.GET(paths[0], handle)
+		err := router.TryHandle(http.MethodGet, paths[1], handle)
+		if _, ok := err.(*RouteConflictError); !ok {
+			t.Errorf("%s next to %s: got error %v, want *RouteConflictError", paths[1], paths[0], err)
+		}
+
+		// Other methods are independent
+		if err := router.TryHandle(http.MethodPost, paths[1], handle); err != nil {
+			t.Errorf("%s for POST: %v", paths[1], err)
+		}
+	}
+}
+
+func TestRouterChaining(t *testing.T) {
+	router1 := New()
+	router2 := New()
+	router1.NotFound = router2
+
+	fooHit := false
+	router1.POST("/foo", func(w http.ResponseWriter, req *http.Request, _ Params) {
+		fooHit = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	barHit := false
+	router2.POST("/bar", func(w http.ResponseWriter, req *http.Request, _ Params) {
+		barHit = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	r, _ := http.NewRequest(http.MethodPost, "/foo", nil)
+	w := httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && fooHit) {
+		t.Errorf("Regular routing failed with router chaining.")
+		t.FailNow()
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/bar", nil)
+	w = httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK && barHit) {
+		t.Errorf("Chained routing failed with router chaining.")
+		t.FailNow()
+	}
+
+	r, _ = http.NewRequest(http.MethodPost, "/qax", nil)
+	w = httptest.NewRecorder()
+	router1.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("NotFound behavior failed with router chaining.")
+		t.FailNow()
+	}
+}
+
+func BenchmarkAllowed(b *testing.B) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.GET("/path", handlerFunc)
+
+	b.Run("Global", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = router.allowed("*", http.MethodOptions)
+		}
+	})
+	b.Run("Path", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = router.allowed("/path", http.MethodOptions)
+		}
+	})
+}
+
+func TestRouterParamsRetained(t *testing.T) {
+	var retained []Params
+	router := New()
+	router.UseParamsPool = false // enabled by New
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		retained = append(retained, ps)
+	})
+
+	for _, name := range []string{"gopher", "bob", "alice"} {
+		r, _ := http.NewRequest(http.MethodGet, "/user/"+name, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+	}
+
+	want := []Params{
+		{Param{"name", "gopher"}},
+		{Param{"name", "bob"}},
+		{Param{"name", "alice"}},
+	}
+	if !reflect.DeepEqual(retained, want) {
+		t.Errorf("retained Params were modified: want %v, got %v", want, retained)
+	}
+}
+
+func BenchmarkParamsPool(b *testing.B) {
+	router := New()
+	router.GET("/user/:name/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher/42", nil)
+
+	for _, pool := range []bool{false, true} {
+		name := "NoPool"
+		if pool {
+			name = "Pool"
+		}
+		b.Run(name, func(b *testing.B) {
+			router.UseParamsPool = pool
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				router.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func TestRouterParamsCapacity(t *testing.T) {
+	var capacity int
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		capacity = cap(ps)
+	}
+
+	router := New()
+	router.UseParamsPool = false
+	router.GET("/user/:name", handle)
+	router.POST("/a/:b/:c/:d/:e/:f", handle)
+
+	tests := []struct {
+		method, path string
+		capacity     int
+	}{
+		{http.MethodGet, "/user/gopher", 1},
+		{http.MethodPost, "/a/b/c/d/e/f", 5},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if capacity != test.capacity {
+			t.Errorf("%s %s: got Params with capacity %d, want %d", test.method, test.path, capacity, test.capacity)
+		}
+		if _, ps, _ := router.Lookup(test.method, test.path); cap(ps) != test.capacity {
+			t.Errorf("Lookup(%s, %s): got Params with capacity %d, want %d", test.method, test.path, cap(ps), test.capacity)
+		}
+	}
+
+	// Pooled Params are sized for all routes
+	router.UseParamsPool = true
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if capacity != 5 {
+		t.Errorf("got pooled Params with capacity %d, want 5", capacity)
+	}
+}
+
+func TestRouterMaxParams(t *testing.T) {
+	// Routes with n params and a static segment between them
+	deepPath := func(n int) string {
+		var path string
+		for i := 0; i < n; i++ {
+			path += "/s/:p" + strconv.Itoa(i)
+		}
+		return path
+	}
+
+	var ps Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, params Params) {
+		ps = params
+	}
+
+	router := New()
+	router.GET(deepPath(300), handle)
+	router.GET("/short/:p0/*rest", handle)
+
+	// The Params of the deepest route fit exactly
+	r, _ := http.NewRequest(http.MethodGet, strings.Replace(deepPath(300), ":", "v", -1), nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if len(ps) != 300 || cap(ps) != 300 || ps.ByName("p299") != "vp299" {
+		t.Errorf("got %d Params with capacity %d, want 300", len(ps), cap(ps))
+	}
+	r, _ = http.NewRequest(http.MethodGet, "/short/a/b/c", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if len(ps) != 2 || cap(ps) != 300 {
+		t.Errorf("got %d Params with capacity %d, want 2 with capacity 300", len(ps), cap(ps))
+	}
+
+	router.MaxParams = 3
+	router.POST(deepPath(3), handle)
+	if err := router.TryHandle(http.MethodPost, deepPath(4), handle); err == nil {
+		t.Error("route with more than MaxParams params was registered")
+	}
+	if recv := catchPanic(func() { router.PUT("/:a/:b/:c/*d", handle) }); recv == nil {
+		t.Error("registering a route with more than MaxParams params did not panic")
+	}
+	if err := router.HandleBatch([]RouteInfo{{http.MethodPut, deepPath(4), handle}}); err == nil {
+		t.Error("HandleBatch registered a route with more than MaxParams params")
+	}
+
+	// The params count of a tree must fit into a uint16
+	router.MaxParams = 0
+	if err := router.TryHandle(http.MethodGet, strings.Repeat("/:p", math.MaxUint16), handle); err == nil {
+		t.Error("route with too many params was registered")
+	}
+}
+
+func BenchmarkParamsMixedRoutes(b *testing.B) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.GET("/repos/:owner/:repo", handlerFunc)
+	router.POST("/import/:a/:b/:c/:d/:e/:f/:g/:h", handlerFunc)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func TestRouterStaticRouteAllocs(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/users/new", handlerFunc)
+	router.GET("/user/:name/:id", handlerFunc)
+
+	// The Params of static routes are never requested
+	root := router.loadTrees().trees[http.MethodGet]
+	params := func() *Params {
+		t.Error("Params requested for static route")
+		return new(Params)
+	}
+	if handle, ps, _, _ := root.getValue("/users/new", params, false); handle == nil || ps != nil {
+		t.Errorf("unexpected result for static route: handle %v, Params %v", handle != nil, ps)
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/users/new", nil)
+	for _, pool := range []bool{false, true} {
+		router.UseParamsPool = pool
+		if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("UseParamsPool=%v: static route allocates %v times", pool, allocs)
+		}
+	}
+}
+
+func TestRouterParamsAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random with the race detector")
+	}
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	// The Params are pooled by default
+	router := New()
+	router.GET("/user/:name/:id", handlerFunc)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher/42", nil)
+	if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+		t.Errorf("route with params allocates %v times", allocs)
+	}
+
+	router.UseParamsPool = false
+	if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs == 0 {
+		t.Error("route with params without pool does not allocate")
+	}
+}
+
+func TestRouterPanicHandlerAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random with the race detector")
+	}
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/users/new", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+
+	w := new(mockResponseWriter)
+	for _, path := range []string{"/users/new", "/user/gopher"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.PanicHandler, router.PanicHandlerWithParams = func(http.ResponseWriter, *http.Request, interface{}) {}, nil
+		if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("%s: PanicHandler allocates %v times", path, allocs)
+		}
+		router.PanicHandler, router.PanicHandlerWithParams = nil, func(http.ResponseWriter, *http.Request, Params, interface{}) {}
+		if allocs := testing.AllocsPerRun(100, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("%s: PanicHandlerWithParams allocates %v times", path, allocs)
+		}
+	}
+}
+
+func TestRouterCatchAllAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random with the race detector")
+	}
+	var value string
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		value = ps.ByName("path")
+	}
+
+	router := New()
+	router.GET("/proxy/*path", handlerFunc)
+
+	// The value of the catch-all is a substring of the request path, its
+	// length does not affect the allocations
+	w := new(mockResponseWriter)
+	for _, n := range []int{1, 1 << 10, 1 << 20} {
+		path := "/proxy/" + strings.Repeat("a/", n)
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = path
+		router.CatchAllNoLeadingSlash = false
+		if allocs := testing.AllocsPerRun(10, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("%d bytes: catch-all route allocates %v times", len(path), allocs)
+		}
+		if value != path[len("/proxy"):] {
+			t.Errorf("%d bytes: wrong catch-all value", len(path))
+		}
+		router.CatchAllNoLeadingSlash = true
+		if allocs := testing.AllocsPerRun(10, func() { router.ServeHTTP(w, r) }); allocs > 0 {
+			t.Errorf("%d bytes: catch-all route without leading slash allocates %v times", len(path), allocs)
+		}
+	}
+}
+
+func BenchmarkCatchAllLongPath(b *testing.B) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/proxy/*path", handlerFunc)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.URL.Path = "/proxy/" + strings.Repeat("segment/", 1<<13)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkStaticRoutes(b *testing.B) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, path := range []string{"/", "/about", "/contact", "/users", "/users/new", "/users/edit"} {
+		router.GET(path, handlerFunc)
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/users/new", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func TestRouterAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.PUT("/user/:name", handlerFunc)
+	router.POST("/other", handlerFunc)
+
+	tests := []struct {
+		path    string
+		method  string
+		allowed []string
+	}{
+		{"/user/gopher", http.MethodDelete, []string{"GET", "PUT", "OPTIONS"}},
+		{"/user/gopher", http.MethodGet, []string{"PUT", "OPTIONS"}},
+		{"/other", http.MethodPost, nil},
+		{"/missing", http.MethodGet, nil},
+		{"*", http.MethodOptions, []string{"GET", "POST", "PUT", "OPTIONS"}},
+	}
+	for _, test := range tests {
+		allowed := router.Allowed(test.path, test.method)
+		if !reflect.DeepEqual(allowed, test.allowed) {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", test.path, test.method, allowed, test.allowed)
+		}
+
+		// 405 vs 404 for custom dispatch
+		if h, _, _ := router.Lookup(test.method, test.path); h == nil && test.path != "*" {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(test.method, test.path, nil)
+			router.ServeHTTP(w, r)
+			want := http.StatusNotFound
+			if allowed != nil {
+				want = http.StatusMethodNotAllowed
+			}
+			if w.Code != want {
+				t.Errorf("%s %s: got Code %d, want %d", test.method, test.path, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestRouterAllowedMethods(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/user/:name", handlerFunc)
+	router.DELETE("/user/:name", handlerFunc)
+	router.POST("/other", handlerFunc)
+	router.Handle(MethodWildcard, "/proxy/*path", handlerFunc)
+	router.Handle("PURGE", "/cache", handlerFunc)
+
+	for _, path := range []string{"/user/gopher", "/other", "/cache", "/missing", "*"} {
+		allowed := router.AllowedMethods(path)
+
+		// Same methods as advertised by automatic OPTIONS responses
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodOptions, path, nil)
+		router.ServeHTTP(w, r)
+		var want []string
+		if allow := w.Header().Get("Allow"); allow != "" {
+			want = strings.Split(allow, ", ")
+		}
+		if !reflect.DeepEqual(allowed, want) {
+			t.Errorf("AllowedMethods(%q) = %v, want %v", path, allowed, want)
+		}
+	}
+
+	want := []string{"GET", "DELETE", "OPTIONS"}
+	if allowed := router.AllowedMethods("/user/gopher"); !reflect.DeepEqual(allowed, want) {
+		t.Errorf("AllowedMethods without AutoHEAD = %v, want %v", allowed, want)
+	}
+	router.AutoHEAD = true
+	want = []string{"GET", "HEAD", "DELETE", "OPTIONS"}
+	if allowed := router.AllowedMethods("/user/gopher"); !reflect.DeepEqual(allowed, want) {
+		t.Errorf("AllowedMethods with AutoHEAD = %v, want %v", allowed, want)
+	}
+
+	// Wildcard method routes allow all methods
+	want = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PURGE"}
+	if allowed := router.AllowedMethods("/proxy/x"); !reflect.DeepEqual(allowed, want) {
+		t.Errorf("AllowedMethods for wildcard method route = %v, want %v", allowed, want)
+	}
+}
+
+func TestRouterAllowedOrder(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, method := range []string{
+		"PURGE", http.MethodTrace, http.MethodDelete, http.MethodOptions,
+		http.MethodPatch, "LINK", http.MethodPost, http.MethodHead,
+		http.MethodGet, http.MethodPut,
+	} {
+		router.Handle(method, "/path", handlerFunc)
+	}
+
+	const want = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, TRACE, LINK, PURGE"
+	for i := 0; i < 10; i++ {
+		if allow := router.allowed("/path", http.MethodOptions); allow != want {
+			t.Fatalf("unexpected Allow header value: %q, want %q", allow, want)
+		}
+		if allow := router.allowed("*", http.MethodOptions); allow != want {
+			t.Fatalf("unexpected global Allow header value: %q, want %q", allow, want)
+		}
+	}
+
+	// 405 response for a method without a handle
+	router = New()
+	router.PUT("/path", handlerFunc)
+	router.GET("/path", handlerFunc)
+	router.OPTIONS("/path", handlerFunc)
+	r, _ := http.NewRequest(http.MethodPost, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT, OPTIONS" {
+		t.Errorf("unexpected Allow header value: %q", allow)
+	}
+}
+
+func TestRouterOPTIONSAllowed(t *testing.T) {
+	var allowed []string
+	handlerFunc := func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		allowed = AllowedFromContext(r.Context())
+	}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.POST("/path", handlerFunc)
+	router.OPTIONS("/path", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		allowed = AllowedFromContext(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"methods":"`+strings.Join(allowed, ",")+`"}`)
+	})
+	router.OPTIONS("/only", handlerFunc)
+	router.GET("/auto", handlerFunc)
+
+	// Registered OPTIONS route
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodOptions, "/path", nil)
+	router.ServeHTTP(w, r)
+	if want := []string{"GET", "POST", "OPTIONS"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("got allowed %v, want %v", allowed, want)
+	}
+	if body := w.Body.String(); body != `{"methods":"GET,POST,OPTIONS"}` {
+		t.Errorf("unexpected body %q", body)
+	}
+	if allow := w.Header().Get("Allow"); allow != "" {
+		t.Errorf("Allow header set for registered OPTIONS route: %q", allow)
+	}
+
+	r, _ = http.NewRequest(http.MethodOptions, "/only", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := []string{"OPTIONS"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("got allowed %v, want %v", allowed, want)
+	}
+
+	// Other requests
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if allowed != nil {
+		t.Errorf("got allowed %v for GET request", allowed)
+	}
+
+	// Automatic replies elsewhere
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodOptions, "/auto", nil)
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf("unexpected automatic Allow header %q", allow)
+	}
+}
+
+func TestRouterOPTIONS(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+
+	// test not allowed
+	// * (server)
+	r, _ := http.NewRequest(http.MethodOptions, "*", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// path
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	r, _ = http.NewRequest(http.MethodOptions, "/doesnotexist", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// add another method
+	router.GET("/path", handlerFunc)
+
+	// set a global OPTIONS handler
+	router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Adjust status code to 204
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// test again
+	// * (server)
+	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNoContent) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "GET, POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// path
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNoContent) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "GET, POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// custom handler
+	var custom bool
+	router.OPTIONS("/path", func(w http.ResponseWriter, r *http.Request, _ Params) {
+		custom = true
+	})
+
+	// test again
+	// * (server)
+	r, _ = http.NewRequest(http.MethodOptions, "*", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNoContent) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "GET, POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+	if custom {
+		t.Error("custom handler called on *")
+	}
+
+	// path
+	r, _ = http.NewRequest(http.MethodOptions, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusOK) {
+		t.Errorf("OPTIONS handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	if !custom {
+		t.Error("custom handler not called")
+	}
+}
+
+func TestRouterNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+
+	// test not allowed
+	r, _ := http.NewRequest(http.MethodGet, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// add another method
+	router.DELETE("/path", handlerFunc)
+	router.OPTIONS("/path", handlerFunc) // must be ignored
+
+	// test again
+	r, _ = http.NewRequest(http.MethodGet, "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusMethodNotAllowed) {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "POST, DELETE, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// test custom handler
+	w = httptest.NewRecorder()
+	responseText := "custom method"
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(responseText))
+	})
+	router.ServeHTTP(w, r)
+	if got := w.Body.String(); !(got == responseText) {
+		t.Errorf("unexpected response got %q want %q", got, responseText)
+	}
+	if w.Code != http.StatusTeapot {
+		t.Errorf("unexpected response code %d want %d", w.Code, http.StatusTeapot)
+	}
+	if allow := w.Header().Get("Allow"); allow != "POST, DELETE, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+}
+
+func TestRouterMethodNotAllowedAllowHeader(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var allowInHandler string
+	router := New()
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		allowInHandler = w.Header().Get("Allow")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte(`{"error":"method not allowed"}`))
+	})
+	router.PUT("/path", handlerFunc)
+	router.Host("api.example.com").MethodNotAllowed = router.MethodNotAllowed
+	router.Host("api.example.com").DELETE("/path", handlerFunc)
+
+	tests := []struct {
+		host, method, allow string
+		code                int
+	}{
+		{"example.com", http.MethodGet, "PUT, OPTIONS", http.StatusMethodNotAllowed},
+		{"api.example.com", http.MethodGet, "DELETE, OPTIONS", http.StatusMethodNotAllowed},
+		{"example.com", http.MethodOptions, "PUT, OPTIONS", http.StatusOK},
+	}
+	for _, test := range tests {
+		allowInHandler = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, "/path", nil)
+		r.Host = test.host
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s: got Code %d and Allow %q, want %d and %q",
+				test.method, test.host, w.Code, w.Header().Get("Allow"), test.code, test.allow)
+		}
+		if test.method != http.MethodOptions && allowInHandler != test.allow {
+			t.Errorf("%s %s: Allow header %q was not set before the handler", test.method, test.host, allowInHandler)
+		}
+	}
+}
+
+func TestRouterUnknownMethod(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.UnknownMethod = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"PROPFIND", "/path", http.StatusNotImplemented},
+		{"PROPFIND", "/missing", http.StatusNotImplemented},
+		{http.MethodPost, "/path", http.StatusNotImplemented},
+		{http.MethodGet, "/missing", http.StatusNotFound},
+		{http.MethodGet, "/path", http.StatusOK},
+		{http.MethodOptions, "/path", http.StatusOK}, // automatic reply
+	}
+	check := func() {
+		for _, test := range tests {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(test.method, test.path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("%s %s: got Code %d, want %d", test.method, test.path, w.Code, test.code)
+			}
+		}
+	}
+	check()
+
+	// Known but wrong methods are still answered with 405
+	router.POST("/other", handlerFunc)
+	tests[2].code = http.StatusMethodNotAllowed
+	check()
+
+	// Routes for all methods
+	router.Handle(MethodWildcard, "/any", handlerFunc)
+	tests[0].code = http.StatusMethodNotAllowed
+	tests[1].code = http.StatusNotFound
+	check()
+}
+
+func TestRouterMethodNotAllowedWithAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	var allowed []string
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.DELETE("/path", handlerFunc)
+	router.MethodNotAllowedWithAllowed = func(w http.ResponseWriter, _ *http.Request, a []string) {
+		allowed = a
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, `{"allowed":%q}`, a)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/path", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Wrong status code: want 405, got %d", w.Code)
+	}
+	if want := []string{"POST", "DELETE", "OPTIONS"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("Wrong allowed methods: want %v, got %v", want, allowed)
+	}
+	if allow := w.Header().Get("Allow"); allow != "POST, DELETE, OPTIONS" {
+		t.Errorf("unexpected Allow header value: %q", allow)
+	}
+	if body := w.Body.String(); body != `{"allowed":["POST" "DELETE" "OPTIONS"]}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// MethodNotAllowed takes precedence
+	allowed = nil
+	router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot || allowed != nil {
+		t.Errorf("MethodNotAllowed not preferred: Code=%d, allowed=%v", w.Code, allowed)
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.GET("/dir/", handlerFunc)
+	router.GET("/", handlerFunc)
+
+	testRoutes := []struct {
+		route    string
+		code     int
+		location string
+	}{
+		{"/path/", http.StatusMovedPermanently, "/path"},   // TSR -/
+		{"/dir", http.StatusMovedPermanently, "/dir/"},     // TSR +/
+		{"", http.StatusMovedPermanently, "/"},             // TSR +/
+		{"/PATH", http.StatusMovedPermanently, "/path"},    // Fixed Case
+		{"/DIR/", http.StatusMovedPermanently, "/dir/"},    // Fixed Case
 		{"/PATH/", http.StatusMovedPermanently, "/path"},   // Fixed Case -/
 		{"/DIR", http.StatusMovedPermanently, "/dir/"},     // Fixed Case +/
 		{"/../path", http.StatusMovedPermanently, "/path"}, // CleanPath
 		{"/nope", http.StatusNotFound, ""},                 // NotFound
 	}
-	for _, tr := range testRoutes {
-		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(http.MethodGet, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if !(w.Code == tr.code && (w.Code == http.StatusNotFound || fmt.Sprint(w.Header().Get("Location")) == tr.location)) {
+			t.Errorf("NotFound handling route %s failed: Code=%d, Header=%v", tr.route, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// Test custom not found handler
+	var notFound bool
+	router.NotFound = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+		notFound = true
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound && notFound == true) {
+		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Test other method than GET (want 308 instead of 301)
+	router.PATCH("/path", handlerFunc)
+	r, _ = http.NewRequest(http.MethodPatch, "/path/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusPermanentRedirect && fmt.Sprint(w.Header()) == "map[Location:[/path]]") {
+		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Test special case where no node for the prefix "/" exists
+	router = New()
+	router.GET("/a", handlerFunc)
+	r, _ = http.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !(w.Code == http.StatusNotFound) {
+		t.Errorf("NotFound handling route / failed: Code=%d", w.Code)
+	}
+}
+
+func TestRouterRedirectLocationEscaping(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/dir/:name/", handle)
+	router.GET("/files/:name", handle)
+
+	tests := []struct {
+		path     string
+		escaped  bool
+		location string
+	}{
+		{"/dir/a b", false, "/dir/a%20b/?q=1"},
+		{"/dir/a?b", false, "/dir/a%3Fb/?q=1"},
+		{"/dir/a#b", false, "/dir/a%23b/?q=1"},
+		{"/dir/100%", false, "/dir/100%25/?q=1"},
+		{"/dir/a\"<>b", false, "/dir/a%22%3C%3Eb/?q=1"},
+		{"/dir/caf\u00e9", false, "/dir/caf%C3%A9/?q=1"},
+		{"/dir/a;b=c&d", false, "/dir/a;b=c&d/?q=1"},
+		{"/FILES/a b?c", false, "/files/a%20b%3Fc?q=1"},
+		{"/files/../files/x#y", false, "/files/x%23y?q=1"},
+
+		// The escaping of the request is kept with UnescapePathParams
+		{"/dir/a%2Fb%20c", true, "/dir/a%2Fb%20c/?q=1"},
+		{"/FILES/a%3Fb", true, "/files/a%3Fb?q=1"},
+	}
+	for _, test := range tests {
+		router.UnescapePathParams = test.escaped
+		u, _ := url.Parse("/")
+		if test.escaped {
+			u, _ = url.Parse(test.path)
+		} else {
+			u.Path = test.path
+		}
+		u.RawQuery = "q=1"
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL = u
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%q: Code=%d, Location=%q, want %q", test.path, w.Code, w.Header().Get("Location"), test.location)
+		}
+	}
+}
+
+func TestRouterTrailingSlashRedirect(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	tests := []struct {
+		routes   []string
+		path     string
+		code     int
+		location string
+	}{
+		{[]string{"/"}, "/", http.StatusOK, ""},
+		{[]string{"/x"}, "/", http.StatusNotFound, ""},
+		{[]string{"/x"}, "/x/", http.StatusMovedPermanently, "/x"},
+		{[]string{"/x/"}, "/x", http.StatusMovedPermanently, "/x/"},
+		{[]string{"/", "/x"}, "/x/", http.StatusMovedPermanently, "/x"},
+		{[]string{"/a/b/c"}, "/a/b/c/", http.StatusMovedPermanently, "/a/b/c"},
+		{[]string{"/a/:id/"}, "/a/1", http.StatusMovedPermanently, "/a/1/"},
+		{[]string{"/a/:id"}, "/a/1/", http.StatusMovedPermanently, "/a/1"},
+		{[]string{"/f/*path"}, "/f", http.StatusMovedPermanently, "/f/"},
+		{[]string{"/:id"}, "/", http.StatusNotFound, ""},
+		{[]string{"/:id"}, "//", http.StatusNotFound, ""},
+		{[]string{"/x/*path"}, "//", http.StatusNotFound, ""},
+		{[]string{"/xa", "/x/y"}, "/X/", http.StatusNotFound, ""},
+		{[]string{"/xa", "/x/y"}, "/x/", http.StatusNotFound, ""},
+		{[]string{"/a/:id", "/ab"}, "/a/", http.StatusNotFound, ""},
+		{[]string{"/a", "/a/:id"}, "/a/", http.StatusMovedPermanently, "/a"},
+		{[]string{"/a/:id/x"}, "/a/1/", http.StatusNotFound, ""},
+		{[]string{"/a/:id", "/a/:id/x"}, "/a/1/", http.StatusMovedPermanently, "/a/1"},
+	}
+	for _, test := range tests {
+		router := New()
+		for _, route := range test.routes {
+			router.GET(route, handlerFunc)
+		}
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = test.path
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%v %s: got Code %d and Location %q, want %d and %q",
+				test.routes, test.path, w.Code, w.Header().Get("Location"), test.code, test.location)
+		}
+	}
+}
+
+func TestRouterIgnoreTrailingSlash(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, r *http.Request, ps Params) {
+			routed = name + " " + r.URL.Path + " " + ps.ByName("name") + ps.ByName("path")
+		}
+	}
+
+	router := New()
+	router.IgnoreTrailingSlash = true
+	router.GET("/users", handle("users"))
+	router.GET("/dir/", handle("dir"))
+	router.GET("/user/:name", handle("user"))
+	router.GET("/both", handle("both"))
+	router.GET("/both/", handle("both/"))
+	router.GET("/src/*path", handle("src"))
+	router.GET("/proxy/*path/info", handle("proxy"))
+
+	tests := []struct {
+		path   string
+		routed string
+	}{
+		{"/users", "users /users "},
+		{"/users/", "users /users/ "},
+		{"/dir", "dir /dir "},
+		{"/dir/", "dir /dir/ "},
+		{"/user/gopher/", "user /user/gopher/ gopher"},
+		{"/both", "both /both "},
+		{"/both/", "both/ /both/ "},
+		{"/src", "src /src /"},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || routed != test.routed {
+			t.Errorf("%s: got Code %d and %q, want 200 and %q", test.path, w.Code, routed, test.routed)
+		}
+	}
+
+	// Other redirects are unaffected
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/USERS", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/users" {
+		t.Errorf("fixed path redirect failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
+
+func TestRouterCollapseSlashes(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, r *http.Request, ps Params) {
+			routed = name + " " + r.URL.Path + " " + ps.ByName("id") + ps.ByName("path")
+		}
+	}
+
+	router := New()
+	router.CollapseSlashes = true
+	router.GET("/api/users", handle("users"))
+	router.GET("/api/users/:id", handle("user"))
+	router.GET("/api//raw", handle("raw"))
+	router.GET("/src/*path", handle("src"))
+	router.GET("/proxy/*path/info", handle("proxy"))
+
+	tests := []struct {
+		path   string
+		code   int
+		routed string
+	}{
+		{"//api//users", http.StatusOK, "users //api//users "},
+		{"/api///users//42", http.StatusOK, "user /api///users//42 42"},
+		{"/api//raw", http.StatusOK, "raw /api//raw "},
+		{"/api/raw", http.StatusNotFound, ""},
+		{"/src//a//b", http.StatusOK, "src /src//a//b //a//b"}, // exact match
+		{"//src//a", http.StatusOK, "src //src//a /a"},
+		{"//src//a//b///", http.StatusOK, "src //src//a//b/// /a//b///"},
+		{"//proxy//a//b/info", http.StatusOK, "proxy //proxy//a//b/info /a//b"},
+		{"//proxy/a//b//info", http.StatusOK, "proxy //proxy/a//b//info /a//b"},
+		{"//proxy///info//info", http.StatusOK, "proxy //proxy///info//info /info"},
+		{"//api/../api/users", http.StatusMovedPermanently, ""},
+		{"//api//other", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		routed = ""
+		w := httptest.NewRecorder()
+		// A path beginning with // would be parsed as host
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Path = test.path
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: got Code %d and %q, want %d and %q", test.path, w.Code, routed, test.code, test.routed)
+		}
+	}
+}
+
+func TestRouterMaxPathLength(t *testing.T) {
+	routed := false
+	router := New()
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+	router.OnNotFound = func(_, _ string) {
+		t.Error("OnNotFound called for rejected path")
+	}
+
+	// Would be redirected to /path by RedirectFixedPath
+	const long = "/x/../PATH"
+
+	router.MaxPathLength = len(long) - 1
+	for _, path := range []string{long, long + "/"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestURITooLong {
+			t.Errorf("%s: got Code %d, want %d", path, w.Code, http.StatusRequestURITooLong)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/path", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed {
+		t.Error("request within the limit was not routed")
+	}
+
+	router.MaxPathLength = len(long)
+	w := httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, long, nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/path" {
+		t.Errorf("path at the limit: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
+
+func TestRouterCheckContextCanceled(t *testing.T) {
+	routed := false
+	router := New()
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		routed = true
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := func(path string) *http.Request {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		return r.WithContext(ctx)
+	}
+
+	// Disabled
+	router.ServeHTTP(httptest.NewRecorder(), canceled("/user/gopher"))
+	if !routed {
+		t.Fatal("handle not called with CheckContextCanceled disabled")
+	}
+
+	router.CheckContextCanceled = true
+	routed = false
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, canceled("/user/gopher"))
+	if routed || w.Code != 499 {
+		t.Errorf("canceled request: routed=%v, Code=%d, want 499", routed, w.Code)
+	}
+
+	// Unmatched requests are handled as usual
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, canceled("/missing"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("canceled unmatched request: got Code %d, want 404", w.Code)
+	}
+
+	router.ContextCanceled = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Err() != context.Canceled {
+			t.Errorf("unexpected context error %v", r.Context().Err())
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, canceled("/user/gopher"))
+	if routed || w.Code != http.StatusServiceUnavailable {
+		t.Errorf("ContextCanceled handler: routed=%v, Code=%d", routed, w.Code)
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if !routed {
+		t.Error("handle not called for active context")
+	}
+}
+
+func TestRouterRejectControlChars(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	if !router.RejectControlChars {
+		t.Fatal("RejectControlChars is not enabled by New")
+	}
+	router.GET("/files/:name", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/files/a%00b", http.StatusBadRequest},
+		{"/files/a%01", http.StatusBadRequest},
+		{"/files/a%09b", http.StatusBadRequest}, // tab
+		{"/files/a%0Ab", http.StatusBadRequest},
+		{"/files/a%0D", http.StatusBadRequest},
+		{"/files/a%1Fb", http.StatusBadRequest},
+		{"/files/a%7Fb", http.StatusBadRequest},
+		{"/src/a/%00/../b", http.StatusBadRequest},
+		{"/files/a%20b", http.StatusOK},
+		{"/files/a~b", http.StatusOK},
+		{"/files/a%C3%A9", http.StatusOK},
+		{"/files/a%80", http.StatusOK},
+	}
+	check := func(disabled bool) {
+		for _, test := range tests {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+			router.ServeHTTP(w, r)
+			want := test.code
+			if disabled {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("%s: got Code %d, want %d", test.path, w.Code, want)
+			}
+		}
+	}
+	check(false)
+
+	router.RejectControlChars = false
+	router.RedirectFixedPath = false
+	check(true)
+}
+
+func TestRouterRedirectStatusCode(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.POST("/path", handlerFunc)
+
+	for _, code := range []int{
+		http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect,
+	} {
+		router.RedirectStatusCode = code
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			for _, route := range []string{"/path/", "/PATH"} {
+				r, _ := http.NewRequest(method, route, nil)
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				if w.Code != code || w.Header().Get("Location") != "/path" {
+					t.Errorf("%s %s with RedirectStatusCode %d: Code=%d, Header=%v", method, route, code, w.Code, w.Header())
+				}
+			}
+		}
+	}
+
+	router.RedirectStatusCode = http.StatusOK
+	recv := catchPanic(func() {
+		r, _ := http.NewRequest(http.MethodGet, "/path/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	})
+	if recv == nil {
+		t.Error("invalid RedirectStatusCode did not panic")
+	}
+}
+
+func TestRouterTrailingSlashRedirectCode(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	methods := []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+	router := New()
+	for _, method := range methods {
+		router.Handle(method, "/path", handlerFunc)
+	}
+
+	tests := []struct {
+		codeGET, codeWrite, codeAll int
+		method, path                string
+		code                        int
+	}{
+		// Defaults
+		{0, 0, 0, http.MethodGet, "/path/", http.StatusMovedPermanently},
+		{0, 0, 0, http.MethodHead, "/path/", http.StatusPermanentRedirect},
+		{0, 0, 0, http.MethodPost, "/path/", http.StatusPermanentRedirect},
+		{0, 0, 0, http.MethodPut, "/path/", http.StatusPermanentRedirect},
+		{0, 0, 0, http.MethodDelete, "/path/", http.StatusPermanentRedirect},
+
+		// Only GET and HEAD
+		{http.StatusFound, 0, 0, http.MethodGet, "/path/", http.StatusFound},
+		{http.StatusFound, 0, 0, http.MethodHead, "/path/", http.StatusFound},
+		{http.StatusFound, 0, 0, http.MethodPost, "/path/", http.StatusPermanentRedirect},
+		{http.StatusFound, 0, 0, http.MethodGet, "/PATH", http.StatusMovedPermanently},
+
+		// Only the other methods
+		{0, http.StatusTemporaryRedirect, 0, http.MethodGet, "/path/", http.StatusMovedPermanently},
+		{0, http.StatusTemporaryRedirect, 0, http.MethodPut, "/path/", http.StatusTemporaryRedirect},
+		{0, http.StatusTemporaryRedirect, 0, http.MethodDelete, "/path/", http.StatusTemporaryRedirect},
+		{0, http.StatusTemporaryRedirect, 0, http.MethodPost, "/PATH", http.StatusPermanentRedirect},
+
+		// Precedence over RedirectStatusCode
+		{http.StatusFound, 0, http.StatusTemporaryRedirect, http.MethodGet, "/path/", http.StatusFound},
+		{http.StatusFound, 0, http.StatusTemporaryRedirect, http.MethodPost, "/path/", http.StatusTemporaryRedirect},
+		{http.StatusFound, 0, http.StatusTemporaryRedirect, http.MethodGet, "/PATH", http.StatusTemporaryRedirect},
+	}
+	for _, test := range tests {
+		router.TrailingSlashRedirectCodeGET = test.codeGET
+		router.TrailingSlashRedirectCodeWrite = test.codeWrite
+		router.RedirectStatusCode = test.codeAll
+		r, _ := http.NewRequest(test.method, test.path, nil)
 		w := httptest.NewRecorder()
 		router.ServeHTTP(w, r)
-		if !(w.Code == tr.code && (w.Code == http.StatusNotFound || fmt.Sprint(w.Header().Get("Location")) == tr.location)) {
-			t.Errorf("NotFound handling route %s failed: Code=%d, Header=%v", tr.route, w.Code, w.Header().Get("Location"))
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("%s %s with codes %d, %d and %d: Code=%d, Header=%v, want %d",
+				test.method, test.path, test.codeGET, test.codeWrite, test.codeAll, w.Code, w.Header(), test.code)
 		}
 	}
 
-	// Test custom not found handler
-	var notFound bool
-	router.NotFound = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		rw.WriteHeader(http.StatusNotFound)
-		notFound = true
+	router.RedirectStatusCode = 0
+	router.TrailingSlashRedirectCodeWrite = http.StatusOK
+	recv := catchPanic(func() {
+		r, _ := http.NewRequest(http.MethodPost, "/path/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
 	})
-	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
+	if recv == nil {
+		t.Error("invalid TrailingSlashRedirectCodeWrite did not panic")
+	}
+}
+
+func TestRouterAddNotFoundHandler(t *testing.T) {
+	var tried []string
+	module := func(name, prefix string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tried = append(tried, name)
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				w.Write([]byte(name))
+			}
+		})
+	}
+
+	var notFound []string
+	router := New()
+	router.GET("/route", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("route"))
+	})
+	router.OnNotFound = func(_, path string) {
+		notFound = append(notFound, path)
+	}
+	router.AddNotFoundHandler(module("plugin", "/plugin/"))
+	router.AddNotFoundHandler(module("static", "/static/"))
+	router.AddNotFoundHandler(module("declining", "/never/"))
+
+	tests := []struct {
+		path  string
+		code  int
+		body  string
+		tried []string
+	}{
+		{"/route", http.StatusOK, "route", nil},
+		{"/plugin/x", http.StatusOK, "plugin", []string{"plugin"}},
+		{"/static/app.js", http.StatusOK, "static", []string{"plugin", "static"}},
+		{"/nope", http.StatusNotFound, "404 page not found\n", []string{"plugin", "static", "declining"}},
+	}
+	for _, test := range tests {
+		tried = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body || !reflect.DeepEqual(tried, test.tried) {
+			t.Errorf("%s: got Code %d, body %q and chain %v, want %d, %q and %v",
+				test.path, w.Code, w.Body.String(), tried, test.code, test.body, test.tried)
+		}
+	}
+	if !reflect.DeepEqual(notFound, []string{"/nope"}) {
+		t.Errorf("OnNotFound called for %v, want [/nope]", notFound)
+	}
+
+	// NotFound is the final handler
+	router.NotFound = module("custom", "/")
+	tried = nil
 	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound && notFound == true) {
-		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	if w.Body.String() != "custom" || len(tried) != 4 {
+		t.Errorf("NotFound was not called last: body %q, chain %v", w.Body.String(), tried)
 	}
 
-	// Test other method than GET (want 308 instead of 301)
-	router.PATCH("/path", handlerFunc)
-	r, _ = http.NewRequest(http.MethodPatch, "/path/", nil)
+	// A host router with a chain does not fall back to the host routes
+	host := router.Host("api.example.com")
+	host.AddNotFoundHandler(module("api", "/"))
+	tried = nil
 	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/route", nil)
+	r.Host = "api.example.com"
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusPermanentRedirect && fmt.Sprint(w.Header()) == "map[Location:[/path]]") {
-		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", w.Code, w.Header())
+	if w.Body.String() != "api" {
+		t.Errorf("host router: got body %q, want api", w.Body.String())
 	}
 
-	// Test special case where no node for the prefix "/" exists
-	router = New()
-	router.GET("/a", handlerFunc)
-	r, _ = http.NewRequest(http.MethodGet, "/", nil)
-	w = httptest.NewRecorder()
+	recv := catchPanic(func() {
+		router.AddNotFoundHandler(nil)
+	})
+	if recv == nil {
+		t.Error("adding nil handler did not panic")
+	}
+}
+
+func TestRouterNotFoundFor(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	notFound := func(code int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+
+	router := New()
+	router.GET("/api/v1/users", handlerFunc)
+	router.NotFound = notFound(http.StatusTeapot)
+	router.NotFoundFor("/api", notFound(http.StatusGone))
+	router.NotFoundFor("/api/v2/", notFound(http.StatusNotImplemented))
+	router.NotFoundFor("/static", notFound(http.StatusForbidden))
+	router.NotFoundFor("/static", notFound(http.StatusNotAcceptable))
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/api/v1/users", http.StatusOK},
+		{"/api/v1/nope", http.StatusGone},
+		{"/api", http.StatusGone},
+		{"/api/v2", http.StatusNotImplemented},
+		{"/api/v2/users", http.StatusNotImplemented},
+		{"/api/v22", http.StatusGone},
+		{"/apis", http.StatusTeapot},
+		{"/static/app.js", http.StatusNotAcceptable},
+		{"/nope", http.StatusTeapot},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got code %d, want %d", test.path, w.Code, test.code)
+		}
+	}
+
+	// Handlers for the root prefix match all paths
+	router.NotFoundFor("/", notFound(http.StatusBadRequest))
+	r, _ := http.NewRequest(http.MethodGet, "/nope", nil)
+	w := httptest.NewRecorder()
 	router.ServeHTTP(w, r)
-	if !(w.Code == http.StatusNotFound) {
-		t.Errorf("NotFound handling route / failed: Code=%d", w.Code)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("root prefix: got code %d", w.Code)
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/legacy", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Handler", "mux")
+	})
+	mux.HandleFunc("/ported", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Handler", "mux")
+	})
+
+	router := New()
+	router.GET("/ported", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Handler", "router")
+	})
+	router.GET("/dir/", func(w http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.Fallback = mux
+	router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("NotFound called despite Fallback")
+	})
+	router.NotFoundFor("/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("NotFoundFor handler called despite Fallback")
+	}))
+	router.OnNotFound = func(_, _ string) {
+		t.Error("OnNotFound called despite Fallback")
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		code    int
+		handler string
+	}{
+		{http.MethodGet, "/ported", http.StatusOK, "router"},
+		{http.MethodGet, "/legacy", http.StatusOK, "mux"},
+		{http.MethodGet, "/missing", http.StatusNotFound, ""},         // 404 of the mux
+		{http.MethodGet, "/dir", http.StatusMovedPermanently, ""},     // redirect
+		{http.MethodPost, "/ported", http.StatusMethodNotAllowed, ""}, // 405
+		{http.MethodPost, "/legacy", http.StatusOK, "mux"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("X-Handler") != test.handler {
+			t.Errorf("%s %s: Code=%d, Handler=%q, want %d and %q",
+				test.method, test.path, w.Code, w.Header().Get("X-Handler"), test.code, test.handler)
+		}
+	}
+
+	// The mux handles the other methods once 405 responses are disabled
+	router.HandleMethodNotAllowed = false
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodPost, "/ported", nil)
+	router.ServeHTTP(w, r)
+	if w.Header().Get("X-Handler") != "mux" {
+		t.Errorf("POST /ported: got handler %q, want mux", w.Header().Get("X-Handler"))
+	}
+}
+
+func TestRouterOnMatch(t *testing.T) {
+	var events []string
+	var params Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		events = append(events, "handle")
+	}
+
+	router := New()
+	router.GET("/user/:name", handle)
+	router.GET("/static", handle)
+	router.OnMatch = func(pattern, method string, ps Params) {
+		events = append(events, "match "+method+" "+pattern)
+		params = ps
+	}
+	router.OnNotFound = func(method, path string) {
+		events = append(events, "notfound "+method+" "+path)
+	}
+	api := router.Host("api.example.com")
+	api.GET("/api", handle)
+
+	tests := []struct {
+		host   string
+		method string
+		path   string
+		events []string
+		params Params
+	}{
+		{"", http.MethodGet, "/user/gopher", []string{"match GET /user/:name", "handle"}, Params{{"name", "gopher"}}},
+		{"", http.MethodGet, "/static", []string{"match GET /static", "handle"}, nil},
+		{"", http.MethodGet, "/missing", []string{"notfound GET /missing"}, nil},
+		{"", http.MethodGet, "/static/", nil, nil},                           // redirect
+		{"", http.MethodPost, "/static", nil, nil},                           // 405
+		{"api.example.com", http.MethodGet, "/api", []string{"handle"}, nil}, // own OnMatch of the host router
+		{"api.example.com", http.MethodGet, "/static", []string{"match GET /static", "handle"}, nil},
+		{"api.example.com", http.MethodGet, "/missing", []string{"notfound GET /missing"}, nil},
+	}
+	for _, test := range tests {
+		events, params = nil, nil
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		r.Host = test.host
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(events, test.events) {
+			t.Errorf("%s %s%s: got events %v, want %v", test.method, test.host, test.path, events, test.events)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s %s%s: got params %v, want %v", test.method, test.host, test.path, params, test.params)
+		}
+	}
+
+	// The host router calls its own OnNotFound if it handles the request
+	var hostNotFound string
+	api.NotFound = http.NotFoundHandler()
+	api.OnNotFound = func(method, path string) {
+		hostNotFound = method + " " + path
+	}
+	events = nil
+	r, _ := http.NewRequest(http.MethodGet, "/missing", nil)
+	r.Host = "api.example.com"
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if hostNotFound != "GET /missing" || events != nil {
+		t.Errorf("host OnNotFound: got %q and events %v", hostNotFound, events)
+	}
+}
+
+func TestRouterPreRoute(t *testing.T) {
+	var paths []string
+	router := New()
+	router.PreRoute = func(w http.ResponseWriter, r *http.Request) bool {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("X-Request-Id", "42")
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	router.MaxPathLength = 20
+	router.GET("/path", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		path string
+		auth bool
+		code int
+	}{
+		{"/path", true, http.StatusNoContent},
+		{"/nope", true, http.StatusNotFound},
+		{"/path/", true, http.StatusMovedPermanently},
+		{"/a/../path", true, http.StatusMovedPermanently},
+		{"/a/very/very/long/path", true, http.StatusRequestURITooLong},
+		{"/path", false, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		paths = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		if test.auth {
+			r.Header.Set("Authorization", "token")
+		}
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got Code %d, want %d", test.path, w.Code, test.code)
+		}
+		if w.Header().Get("X-Request-Id") != "42" {
+			t.Errorf("%s: header set by PreRoute is missing", test.path)
+		}
+		if len(paths) != 1 || paths[0] != test.path {
+			t.Errorf("%s: PreRoute saw paths %v", test.path, paths)
+		}
+	}
+}
+
+func TestRouterPathRewrite(t *testing.T) {
+	var routed string
+	router := New()
+	router.GET("/users/:id", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		routed = r.URL.Path + " " + ps.ByName("id")
+	})
+	router.GET("/about/", func(_ http.ResponseWriter, r *http.Request, _ Params) {
+		routed = r.URL.Path
+	})
+
+	tests := []struct {
+		rewrite    func(string) string
+		rewriteURL bool
+		path       string
+		code       int
+		routed     string
+	}{
+		// Identity
+		{func(path string) string { return path }, false, "/users/1", http.StatusOK, "/users/1 1"},
+		{func(path string) string { return path }, false, "/about", http.StatusMovedPermanently, ""},
+
+		// Prefix stripping
+		{stripPrefix("/service-a"), false, "/service-a/users/1", http.StatusOK, "/service-a/users/1 1"},
+		{stripPrefix("/service-a"), false, "/users/2", http.StatusOK, "/users/2 2"},
+		{stripPrefix("/service-a"), false, "/service-a/about/", http.StatusOK, "/service-a/about/"},
+		{stripPrefix("/service-a"), true, "/service-a/users/1", http.StatusOK, "/users/1 1"},
+		{stripPrefix("/service-a"), true, "/service-a/about/", http.StatusOK, "/about/"},
+
+		// No redirects for rewritten paths
+		{stripPrefix("/service-a"), false, "/service-a/about", http.StatusNotFound, ""},
+		{stripPrefix("/service-a"), false, "/service-a/USERS/1", http.StatusNotFound, ""},
+		{stripPrefix("/service-a"), false, "/about", http.StatusMovedPermanently, ""},
+	}
+	for _, test := range tests {
+		router.PathRewrite = test.rewrite
+		router.RewriteURLPath = test.rewriteURL
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || routed != test.routed {
+			t.Errorf("%s: got Code %d and %q, want %d and %q", test.path, w.Code, routed, test.code, test.routed)
+		}
+		if test.code == http.StatusOK && r.URL.Path != test.path {
+			t.Errorf("%s: request URL was modified to %s", test.path, r.URL.Path)
+		}
+	}
+}
+
+func stripPrefix(prefix string) func(string) string {
+	return func(path string) string {
+		return strings.TrimPrefix(path, prefix)
+	}
+}
+
+// hijackRecorder is a ResponseRecorder implementing http.Hijacker.
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (w hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, nil
+}
+
+func TestRouterEmptyResponseHandler(t *testing.T) {
+	noop := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.UseContext = true
+	router.GET("/noop", noop)
+	router.GET("/users/:id", noop)
+	router.GET("/header", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Header().Set("X-Test", "1")
+	})
+	router.GET("/body", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("body"))
+	})
+	router.GET("/status", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.GET("/hijack", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.(http.Hijacker).Hijack()
+	})
+	emptyResponse := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "empty "+ParamsFromContext(r.Context()).ByName("id"), http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		path  string
+		empty bool
+		code  int
+		body  string
+	}{
+		{"/noop", false, http.StatusOK, ""},
+		{"/noop", true, http.StatusInternalServerError, "empty \n"},
+		{"/users/42", true, http.StatusInternalServerError, "empty 42\n"},
+		{"/header", true, http.StatusInternalServerError, "empty \n"},
+		{"/body", true, http.StatusOK, "body"},
+		{"/status", true, http.StatusNoContent, ""},
+		{"/hijack", true, http.StatusOK, ""},
+		{"/nope", true, http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		router.EmptyResponseHandler = nil
+		if test.empty {
+			router.EmptyResponseHandler = emptyResponse
+		}
+		w := hijackRecorder{httptest.NewRecorder()}
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s with EmptyResponseHandler %v: got %d %q, want %d %q",
+				test.path, test.empty, w.Code, w.Body.String(), test.code, test.body)
+		}
+	}
+}
+
+func TestRouterServeHTTPStatus(t *testing.T) {
+	router := New()
+	router.GET("/created", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	router.GET("/body", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.Write([]byte("body"))
+	})
+	router.GET("/empty", func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops")
+	})
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/created", http.StatusCreated},
+		{"/body", http.StatusOK},
+		{"/empty", http.StatusOK},
+		{"/panic", http.StatusServiceUnavailable},
+		{"/created/", http.StatusMovedPermanently},
+		{"/nope", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		code := router.ServeHTTPStatus(w, r)
+		if code != test.code || w.Code != test.code {
+			t.Errorf("%s: got status %d and Code %d, want %d", test.path, code, w.Code, test.code)
+		}
+	}
+}
+
+func TestRouterDraining(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	router := New()
+	router.DrainingAllowlist = []string{"/healthz"}
+	router.DrainingRetryAfter = 1500 * time.Millisecond
+	router.GET("/slow", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.GET("/fast", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	router.GET("/healthz", func(w http.ResponseWriter, _ *http.Request, _ Params) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if router.IsDraining() {
+		t.Fatal("new router is draining")
+	}
+
+	// A request in flight is completed
+	slow := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		r, _ := http.NewRequest(http.MethodGet, "/slow", nil)
+		router.ServeHTTP(slow, r)
+		close(done)
+	}()
+	<-started
+	router.BeginDraining()
+	close(release)
+	<-done
+	if slow.Code != http.StatusNoContent {
+		t.Errorf("request in flight: got Code %d, want 204", slow.Code)
+	}
+
+	if !router.IsDraining() {
+		t.Fatal("router is not draining")
+	}
+	tests := []struct {
+		path       string
+		code       int
+		retryAfter string
+	}{
+		{"/fast", http.StatusServiceUnavailable, "2"},
+		{"/nope", http.StatusServiceUnavailable, "2"},
+		{"/healthz", http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Retry-After") != test.retryAfter {
+			t.Errorf("%s: got Code %d and Retry-After %q, want %d and %q",
+				test.path, w.Code, w.Header().Get("Retry-After"), test.code, test.retryAfter)
+		}
+	}
+
+	for d, want := range map[time.Duration]string{0: "1", time.Second: "1", 10 * time.Second: "10"} {
+		if got := retryAfter(d); got != want {
+			t.Errorf("retryAfter(%v) = %q, want %q", d, got, want)
+		}
 	}
 }
 
@@ -483,19 +2852,224 @@ func TestRouterPanicHandler(t *testing.T) {
 		panic("oops!")
 	})
 
-	w := new(mockResponseWriter)
-	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	w := new(mockResponseWriter)
+	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			t.Fatal("handling panic failed")
+		}
+	}()
+
+	router.ServeHTTP(w, req)
+
+	if !panicHandled {
+		t.Fatal("simulating failed")
+	}
+}
+
+func TestRouterLogger(t *testing.T) {
+	var logged []string
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/dir/", handle)
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops")
+	})
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {
+		logged = append(logged, "handler")
+	}
+
+	// No Logger
+	for _, path := range []string{"/panic", "/DIR/", "/dir"} {
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	router.Logger = func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	tests := []struct {
+		path   string
+		logged []string
+	}{
+		{"/panic", []string{"httprouter: recovered panic serving GET /panic: oops", "handler"}},
+		{"/DIR/", []string{"httprouter: redirecting GET /DIR/ to fixed path /dir/"}},
+		{"/dir", nil},
+		{"/dir/", nil},
+	}
+	for _, test := range tests {
+		logged = nil
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if !reflect.DeepEqual(logged, test.logged) {
+			t.Errorf("%s: logged %q, want %q", test.path, logged, test.logged)
+		}
+	}
+
+	router.LogTrailingSlashRedirects = true
+	logged = nil
+	r, _ := http.NewRequest(http.MethodGet, "/dir", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if want := []string{"httprouter: redirecting GET /dir to /dir/ (trailing slash)"}; !reflect.DeepEqual(logged, want) {
+		t.Errorf("logged %q, want %q", logged, want)
+	}
+}
+
+func TestRouterPanicHandlerWithParams(t *testing.T) {
+	var handled string
+	var params Params
+	var value interface{}
+
+	router := New()
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {
+		handled = "plain"
+	}
+	router.PanicHandlerWithParams = func(w http.ResponseWriter, _ *http.Request, ps Params, rcv interface{}) {
+		handled = "params"
+		params = ps
+		value = rcv
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.PUT("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+	router.NotFound = http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("not found")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	router.ServeHTTP(w, req)
+	if handled != "params" || w.Code != http.StatusInternalServerError {
+		t.Fatalf("handling panic failed: handled by %q, Code=%d", handled, w.Code)
+	}
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong parameter values: want %v, got %v", want, params)
+	}
+	if value != "oops!" {
+		t.Errorf("Wrong recovered value: %v", value)
+	}
+
+	// Panic outside of a handle
+	req, _ = http.NewRequest(http.MethodGet, "/nope", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if params != nil || value != "not found" {
+		t.Errorf("unexpected Params %v and value %v for panic outside of handle", params, value)
+	}
+
+	// PanicHandler is used without PanicHandlerWithParams
+	router.PanicHandlerWithParams = nil
+	req, _ = http.NewRequest(http.MethodPut, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if handled != "plain" {
+		t.Errorf("handled by %q, want plain", handled)
+	}
+}
+
+func TestRouterPanicHandlerContext(t *testing.T) {
+	var pattern, name string
+	router := New()
+	router.UseContext = true
+	router.SaveMatchedRoutePath = true
+	router.PanicHandler = func(w http.ResponseWriter, req *http.Request, _ interface{}) {
+		ps := ParamsFromContext(req.Context())
+		pattern, name = ps.MatchedRoutePath(), ps.ByName("name")
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+	router.GET("/static", func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+		panic("oops!")
+	})
+
+	tests := []struct {
+		path, pattern, name string
+	}{
+		{"/user/gopher", "/user/:name", "gopher"},
+		{"/static", "/static", ""},
+	}
+	for _, test := range tests {
+		pattern, name = "", ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError || pattern != test.pattern || name != test.name {
+			t.Errorf("%s: got Code %d, pattern %q and name %q from context, want 500, %q and %q",
+				test.path, w.Code, pattern, name, test.pattern, test.name)
+		}
+	}
+
+	// Without UseContext nothing is stored
+	router.UseContext = false
+	req, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if pattern != "" || name != "" {
+		t.Errorf("Params stored in context without UseContext: %q %q", pattern, name)
+	}
+}
+
+func TestRouterCatchAllNoLeadingSlash(t *testing.T) {
+	var got Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		got = ps
+	}
 
-	defer func() {
-		if rcv := recover(); rcv != nil {
-			t.Fatal("handling panic failed")
+	router := New()
+	router.CatchAllNoLeadingSlash = true
+	router.GET("/repo/:owner/:name/*path", handle)
+	router.GET("/src/*path(/[a-z/]*)", handle)
+	router.Mount("/mount", http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = Params{{"url", r.URL.Path}}
+	}))
+
+	tests := []struct {
+		path   string
+		code   int
+		params Params
+	}{
+		{"/repo/a/b/c/d.go", http.StatusOK, Params{{"owner", "a"}, {"name", "b"}, {"path", "c/d.go"}}},
+		{"/repo/a/b/", http.StatusOK, Params{{"owner", "a"}, {"name", "b"}, {"path", ""}}},
+		{"/repo/a/b//", http.StatusOK, Params{{"owner", "a"}, {"name", "b"}, {"path", "/"}}},
+		{"/repo/a/b", http.StatusNotFound, nil},
+		{"/src/abc", http.StatusOK, Params{{"path", "abc"}}},
+		{"/mount/users", http.StatusOK, Params{{"url", "/users"}}},
+		{"/mount/", http.StatusOK, Params{{"url", "/"}}},
+	}
+	for _, test := range tests {
+		got = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || !reflect.DeepEqual(got, test.params) {
+			t.Errorf("%s: got %d with %v, want %d with %v", test.path, w.Code, got, test.code, test.params)
 		}
-	}()
+	}
 
-	router.ServeHTTP(w, req)
+	if _, ps, _ := router.Lookup(http.MethodGet, "/repo/a/b/c"); ps.ByName("path") != "c" {
+		t.Errorf("Lookup: got params %v", ps)
+	}
 
-	if !panicHandled {
-		t.Fatal("simulating failed")
+	// Catch-all at the root
+	root := New()
+	root.CatchAllNoLeadingSlash = true
+	root.GET("/*all", handle)
+	for path, want := range map[string]string{"/": "", "/x": "x", "/x/": "x/"} {
+		got = nil
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		root.ServeHTTP(httptest.NewRecorder(), r)
+		if v := got.ByName("all"); got == nil || v != want {
+			t.Errorf("%s: got value %q, want %q", path, v, want)
+		}
+	}
+
+	// Unchanged by default
+	router.CatchAllNoLeadingSlash = false
+	r, _ := http.NewRequest(http.MethodGet, "/repo/a/b/", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if v := got.ByName("path"); v != "/" {
+		t.Errorf("got value %q by default, want /", v)
 	}
 }
 
@@ -565,6 +3139,480 @@ func TestRouterLookup(t *testing.T) {
 	}
 }
 
+func TestRouterLookupDetailed(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	if res := router.LookupDetailed(http.MethodGet, "/"); res.Found || res.TrailingSlashRedirect || res.FixedPath != "" {
+		t.Fatalf("Got non-empty result for empty router: %+v", res)
+	}
+
+	router.GET("/user/:name", handle)
+	router.GET("/dir/", handle)
+	router.GET("/src/*filepath", handle)
+	router.Handle(MethodWildcard, "/any/:a/:b", handle)
+	router.Handle(http.MethodConnect, "/conn/", handle)
+
+	tests := []struct {
+		path      string
+		found     bool
+		params    Params
+		route     string
+		tsr       bool
+		fixedPath string
+	}{
+		{"/user/gopher", true, Params{Param{"name", "gopher"}}, "/user/:name", false, ""},
+		{"/dir/", true, nil, "/dir/", false, ""},
+		{"/src/a/b.go", true, Params{Param{"filepath", "/a/b.go"}}, "/src/*filepath", false, ""},
+		{"/any/1/2", true, Params{Param{"a", "1"}, Param{"b", "2"}}, "/any/:a/:b", false, ""},
+		{"/user/gopher/", false, nil, "", true, ""},
+		{"/dir", false, nil, "", true, ""},
+		{"/DIR/", false, nil, "", false, "/dir/"},
+		{"/DIR", false, nil, "", false, "/dir/"},
+		{"/../dir/", false, nil, "", false, "/dir/"},
+		{"/nope", false, nil, "", false, ""},
+	}
+	for _, test := range tests {
+		res := router.LookupDetailed(http.MethodGet, test.path)
+		if res.Found != test.found || (res.Handle != nil) != test.found {
+			t.Errorf("%s: Found=%v, Handle=%v, want found %v", test.path, res.Found, res.Handle != nil, test.found)
+		}
+		if !reflect.DeepEqual(res.Params, test.params) {
+			t.Errorf("%s: wrong parameter values: want %v, got %v", test.path, test.params, res.Params)
+		}
+		if res.Route != test.route {
+			t.Errorf("%s: Route=%q, want %q", test.path, res.Route, test.route)
+		}
+		if res.TrailingSlashRedirect != test.tsr || res.FixedPath != test.fixedPath {
+			t.Errorf("%s: TrailingSlashRedirect=%v, FixedPath=%q, want %v, %q",
+				test.path, res.TrailingSlashRedirect, res.FixedPath, test.tsr, test.fixedPath)
+		}
+	}
+
+	// No redirects for CONNECT requests
+	if res := router.LookupDetailed(http.MethodConnect, "/conn"); res.TrailingSlashRedirect {
+		t.Error("Got trailing slash redirect for CONNECT request")
+	}
+
+	// Disabled redirects
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+	if res := router.LookupDetailed(http.MethodGet, "/dir"); res.TrailingSlashRedirect {
+		t.Error("Got trailing slash redirect although disabled")
+	}
+	if res := router.LookupDetailed(http.MethodGet, "/DIR/"); res.FixedPath != "" {
+		t.Error("Got fixed path although disabled")
+	}
+}
+
+func TestRouterLookupDetailedLikeServeHTTP(t *testing.T) {
+	var routed Params
+	newRouter := func(configure func(*Router)) *Router {
+		router := New()
+		configure(router)
+		for _, path := range []string{"/user/:name", "/dir/", "/src/*filepath", "/x/"} {
+			route := path
+			router.GET(route, func(w http.ResponseWriter, _ *http.Request, ps Params) {
+				w.Header().Set("X-Route", route)
+				routed = ps
+			})
+		}
+		return router
+	}
+
+	tests := []struct {
+		name      string
+		configure func(*Router)
+		path      string
+		found     bool
+		params    Params
+		tsr       bool
+		fixedPath string
+	}{
+		{"IgnoreTrailingSlash", func(r *Router) { r.IgnoreTrailingSlash = true },
+			"/dir", true, nil, false, ""},
+		{"IgnoreTrailingSlash", func(r *Router) { r.IgnoreTrailingSlash = true },
+			"/user/gopher/", true, Params{Param{"name", "gopher"}}, false, ""},
+		{"IgnoreTrailingSlash", func(r *Router) { r.IgnoreTrailingSlash = true },
+			"/DIR", false, nil, false, "/dir/"},
+		{"escaped", func(r *Router) {},
+			"/user/a%20b", true, Params{Param{"name", "a b"}}, false, ""},
+		{"escaped", func(r *Router) {},
+			"/user/a%2Fb", false, nil, false, ""},
+		{"UnescapePathParams", func(r *Router) { r.UnescapePathParams = true },
+			"/user/a%2Fb", true, Params{Param{"name", "a%2Fb"}}, false, ""},
+		{"UnescapePathParams", func(r *Router) { r.UnescapePathParams = true; r.DecodeSlashInParams = true },
+			"/user/a%2Fb", true, Params{Param{"name", "a/b"}}, false, ""},
+		{"UnescapePathParams", func(r *Router) { r.UnescapePathParams = true },
+			"/user/a%zz", false, nil, false, ""},
+		{"UnescapePathParams", func(r *Router) { r.UnescapePathParams = true },
+			"/%64ir", false, nil, false, "/dir/"},
+		{"CollapseSlashes", func(r *Router) { r.CollapseSlashes = true },
+			"//user//gopher", true, Params{Param{"name", "gopher"}}, false, ""},
+		{"CleanPathBeforeRouting", func(r *Router) { r.CleanPathBeforeRouting = true },
+			"/src/../dir/", true, nil, false, ""},
+		{"PathRewrite", func(r *Router) { r.PathRewrite = stripPrefix("/v1") },
+			"/v1/dir", false, nil, false, ""},
+		{"DetectRedirectLoop", func(r *Router) {
+			r.CleanPathBeforeRouting = true
+			r.PathCleaner = func(path string) string { return strings.TrimSuffix(CleanPath(path), "/") }
+			r.DetectRedirectLoop = true
+		}, "/x", false, nil, false, ""},
+		{"DetectRedirectLoop", func(r *Router) { r.DetectRedirectLoop = true },
+			"/dir", false, nil, true, ""},
+	}
+	for _, test := range tests {
+		router := newRouter(test.configure)
+		res := router.LookupDetailed(http.MethodGet, test.path)
+		if res.Found != test.found || !reflect.DeepEqual(res.Params, test.params) ||
+			res.TrailingSlashRedirect != test.tsr || res.FixedPath != test.fixedPath {
+			t.Errorf("%s %s: got %+v, want found %v with %v, tsr %v, fixed path %q", test.name, test.path,
+				res, test.found, test.params, test.tsr, test.fixedPath)
+			continue
+		}
+
+		// ServeHTTP agrees. Requests with invalid escapes never reach it.
+		if _, err := url.ParseRequestURI(test.path); err != nil {
+			continue
+		}
+		routed = nil
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		switch {
+		case res.Found:
+			if w.Code != http.StatusOK || w.Header().Get("X-Route") != res.Route || !reflect.DeepEqual(routed, res.Params) {
+				t.Errorf("%s %s: ServeHTTP got %d for route %q with %v", test.name, test.path, w.Code, w.Header().Get("X-Route"), routed)
+			}
+		case res.TrailingSlashRedirect || res.FixedPath != "":
+			if w.Code != http.StatusMovedPermanently || res.FixedPath != "" && w.Header().Get("Location") != res.FixedPath {
+				t.Errorf("%s %s: ServeHTTP got %d to %q", test.name, test.path, w.Code, w.Header().Get("Location"))
+			}
+		default:
+			if w.Code/100 != 4 || w.Code == http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: ServeHTTP got %d, want not found", test.name, test.path, w.Code)
+			}
+		}
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.IgnoreTrailingSlash = true
+	router.GET("/user/:name", handle)
+	router.Handle(MethodWildcard, "/any", handle)
+
+	tests := []struct {
+		method, path string
+		found        bool
+		params       Params
+	}{
+		{http.MethodGet, "/user/gopher", true, Params{Param{"name", "gopher"}}},
+		{http.MethodGet, "/user/gopher/", false, nil}, // no trailing slash policy
+		{http.MethodGet, "/USER/gopher", false, nil},  // no fixed path
+		{http.MethodPost, "/user/gopher", false, nil},
+		{http.MethodPost, "/any", true, nil},
+		{http.MethodGet, "/nope", false, nil},
+	}
+	for _, test := range tests {
+		h, ps, found := router.Match(test.method, test.path)
+		if found != test.found || (h != nil) != test.found || !reflect.DeepEqual(ps, test.params) {
+			t.Errorf("Match(%s, %s) = %v, %v, %v, want found %v and %v",
+				test.method, test.path, h != nil, ps, found, test.found, test.params)
+		}
+	}
+}
+
+func TestRouterPathCleaner(t *testing.T) {
+	var routed string
+	router := New()
+	router.GET("/docs/:page", func(_ http.ResponseWriter, r *http.Request, ps Params) {
+		routed = r.URL.Path + " " + ps.ByName("page")
+	})
+	router.PathCleaner = func(path string) string {
+		path = CleanPath(path)
+		for _, locale := range []string{"/de/", "/en/"} {
+			if strings.HasPrefix(path, locale) {
+				return path[len(locale)-1:]
+			}
+		}
+		return path
+	}
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/en/docs/intro", http.StatusMovedPermanently, "/docs/intro"},
+		{"/DE/../en//DOCS/intro", http.StatusMovedPermanently, "/docs/intro"},
+		{"/fr/docs/intro", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: got %d to %q, want %d to %q",
+				test.path, w.Code, w.Header().Get("Location"), test.code, test.location)
+		}
+	}
+	if res := router.LookupDetailed(http.MethodGet, "/de/docs/intro"); res.FixedPath != "/docs/intro" {
+		t.Errorf("LookupDetailed: got fixed path %q", res.FixedPath)
+	}
+
+	// Cleaning before routing, without redirect
+	router.CleanPathBeforeRouting = true
+	for path, want := range map[string]string{
+		"/en/docs/intro":  "/en/docs/intro intro",
+		"/docs/../docs/a": "/docs/../docs/a a",
+		"/en/DOCS/intro":  "", // redirected because of the case
+	} {
+		routed = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(w, r)
+		if routed != want {
+			t.Errorf("%s: routed %q, want %q", path, routed, want)
+		}
+		if want == "" && w.Header().Get("Location") != "/docs/intro" {
+			t.Errorf("%s: got %d to %q, want redirect to /docs/intro", path, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// CleanPath is used before routing without a PathCleaner
+	router.PathCleaner = nil
+	routed = ""
+	r, _ := http.NewRequest(http.MethodGet, "/docs//a", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if routed != "/docs//a a" {
+		t.Errorf("routed %q, want the cleaned path", routed)
+	}
+}
+
+func TestRouterDetectRedirectLoop(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/x/", handle)
+	router.GET("/ok", handle)
+	router.CleanPathBeforeRouting = true
+	// Removes the trailing slash the route /x/ needs, so that each redirect
+	// to it is redirected again
+	router.PathCleaner = func(path string) string {
+		return strings.TrimSuffix(CleanPath(path), "/")
+	}
+
+	tests := []struct {
+		path     string
+		code     int
+		location string
+	}{
+		{"/x", http.StatusMovedPermanently, "/x/"},
+		{"/X/", http.StatusMovedPermanently, "/x/"},
+		{"/OK", http.StatusMovedPermanently, "/ok"},
+	}
+	for _, detect := range []bool{false, true} {
+		router.DetectRedirectLoop = detect
+		for _, test := range tests {
+			if detect && test.location == "/x/" {
+				test.code, test.location = http.StatusNotFound, ""
+			}
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+			router.ServeHTTP(w, r)
+			if w.Code != test.code || w.Header().Get("Location") != test.location {
+				t.Errorf("%s (detect %t): got %d to %q, want %d to %q",
+					test.path, detect, w.Code, w.Header().Get("Location"), test.code, test.location)
+			}
+		}
+	}
+}
+
+func TestRouterConstraint(t *testing.T) {
+	routed := false
+	router := New()
+	router.GET("/user/:id(\\d+)", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		routed = true
+		if id := ps.ByName("id"); id != "42" {
+			t.Fatalf("wrong param value: want 42, got %s", id)
+		}
+	})
+
+	handle, params, _ := router.Lookup(http.MethodGet, "/user/42")
+	if handle == nil {
+		t.Fatal("Got no handle!")
+	}
+	if want := (Params{Param{"id", "42"}}); !reflect.DeepEqual(params, want) {
+		t.Fatalf("Wrong parameter values: want %v, got %v", want, params)
+	}
+	if handle, _, _ = router.Lookup(http.MethodGet, "/user/gopher"); handle != nil {
+		t.Fatal("Got handle for constraint violating path")
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/user/42", nil)
+	router.ServeHTTP(w, r)
+	if !routed {
+		t.Fatal("routing failed")
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("constraint violating path: want 404, got %d", w.Code)
+	}
+}
+
+func TestRouterOptionalParam(t *testing.T) {
+	var params Params
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		params = ps
+	}
+
+	router := New()
+	router.GET("/files/:name?", handle)
+	router.GET("/user/:id(\\d+)?", handle)
+
+	langRouter := New()
+	langRouter.GET("/:lang?", handle)
+
+	tests := []struct {
+		router *Router
+		path   string
+		params Params
+	}{
+		{router, "/files/LICENSE", Params{Param{"name", "LICENSE"}}},
+		{router, "/files", Params{Param{"name", ""}}},
+		{router, "/user/42", Params{Param{"id", "42"}}},
+		{router, "/user", Params{Param{"id", ""}}},
+		{langRouter, "/de", Params{Param{"lang", "de"}}},
+		{langRouter, "/", Params{Param{"lang", ""}}},
+	}
+	for _, test := range tests {
+		params = nil
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		test.router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got code %d", test.path, w.Code)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("%s: wrong parameter values: want %v, got %v", test.path, test.params, params)
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("constraint violating path: want 404, got %d", w.Code)
+	}
+
+	// The path without the parameter must not be registered separately
+	router = New()
+	router.GET("/files", handle)
+	recv := catchPanic(func() {
+		router.GET("/files/:name?", handle)
+	})
+	if recv == nil {
+		t.Error("optional parameter conflicting with existing route did not panic")
+	}
+	if h, _, _ := router.Lookup(http.MethodGet, "/files/LICENSE"); h != nil {
+		t.Error("conflicting optional parameter route was registered partially")
+	}
+
+	recv = catchPanic(func() {
+		router.GET("/dir/:name?/info", handle)
+	})
+	if recv == nil {
+		t.Error("optional parameter not at the end of the path did not panic")
+	}
+}
+
+func TestRouterMatchedRoutePath(t *testing.T) {
+	var matched string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		matched = ps.MatchedRoutePath()
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.GET("/user/:name", handle)
+	router.GET("/static", handle)
+	router.GET("/files/*filepath", handle)
+	router.Group("/api").GET("/items/:id", handle)
+	router.HandlerFunc(http.MethodGet, "/handler/:id", func(_ http.ResponseWriter, req *http.Request) {
+		matched = ParamsFromContext(req.Context()).MatchedRoutePath()
+	})
+
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/user/gopher", "/user/:name"},
+		{"/static", "/static"},
+		{"/files/a/b.txt", "/files/*filepath"},
+		{"/api/items/42", "/api/items/:id"},
+		{"/handler/42", "/handler/:id"},
+		// the paths are first redirected to the registered routes
+		{"/user/gopher/", "/user/:name"},
+		{"/STATIC", "/static"},
+		{"/../user/gopher", "/user/:name"},
+	}
+	for _, test := range tests {
+		matched = ""
+		path := test.path
+		for i := 0; i < 2; i++ {
+			r, _ := http.NewRequest(http.MethodGet, path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusMovedPermanently {
+				break
+			}
+			// follow the redirect
+			path = w.Header().Get("Location")
+		}
+		if matched != test.pattern {
+			t.Errorf("wrong matched route path for %s: want %q, got %q", test.path, test.pattern, matched)
+		}
+	}
+
+	// The params of the route are not affected
+	router.GET("/check/:a/:b", func(_ http.ResponseWriter, _ *http.Request, ps Params) {
+		want := Params{Param{"a", "1"}, Param{"b", "2"}, Param{MatchedRoutePathParam, "/check/:a/:b"}}
+		if !reflect.DeepEqual(ps, want) {
+			t.Fatalf("wrong wildcard values: want %v, got %v", want, ps)
+		}
+		matched = ps.MatchedRoutePath()
+	})
+	r, _ := http.NewRequest(http.MethodGet, "/check/1/2", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if matched != "/check/:a/:b" {
+		t.Errorf("wrong matched route path: got %q", matched)
+	}
+
+	// Disabled
+	router.SaveMatchedRoutePath = false
+	matched = "unchanged"
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if matched != "" {
+		t.Errorf("matched route path saved although disabled: got %q", matched)
+	}
+
+	// Enabled after registration of purely static routes
+	router = New()
+	router.GET("/static", handle)
+	router.SaveMatchedRoutePath = true
+	r, _ = http.NewRequest(http.MethodGet, "/static", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if matched != "/static" {
+		t.Errorf("wrong matched route path: want %q, got %q", "/static", matched)
+	}
+}
+
 func TestRouterParamsFromContext(t *testing.T) {
 	routed := false
 
@@ -610,6 +3658,227 @@ func TestRouterParamsFromContext(t *testing.T) {
 	}
 }
 
+func TestRouterHandlerParamsFromContext(t *testing.T) {
+	var id string
+	handler := http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+		id = ParamsFromContext(req.Context()).ByName("id")
+	})
+
+	router := New()
+	router.Handler(http.MethodGet, "/x/:id", handler)
+	router.Group("/api").Handler(http.MethodGet, "/x/:id", handler)
+
+	for path, want := range map[string]string{"/x/42": "42", "/api/x/7": "7"} {
+		id = ""
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if id != want {
+			t.Errorf("%s: got id %q from context, want %q", path, id, want)
+		}
+	}
+}
+
+func TestRouterHandleC(t *testing.T) {
+	var routed []string
+	handle := func(name string) HandleC {
+		return func(ctx context.Context, _ http.ResponseWriter, r *http.Request, ps Params) {
+			if ctx != r.Context() {
+				t.Errorf("%s: handle did not receive the request context", name)
+			}
+			routed = append(routed, fmt.Sprintf("%s %v %s", name, ctx.Value(ctxKey{}), ps.ByName("name")))
+		}
+	}
+
+	router := New()
+	router.GETC("/get/:name", handle("get"))
+	router.POSTC("/post", handle("post"))
+	router.HandleC(http.MethodPut, "/put", handle("put"))
+	api := router.Group("/api")
+	api.GETC("/get", handle("api get"))
+	api.POSTC("/post", handle("api post"))
+	api.HandleC(http.MethodPut, "/put", handle("api put"))
+
+	requests := []struct{ method, path string }{
+		{http.MethodGet, "/get/gopher"},
+		{http.MethodPost, "/post"},
+		{http.MethodPut, "/put"},
+		{http.MethodGet, "/api/get"},
+		{http.MethodPost, "/api/post"},
+		{http.MethodPut, "/api/put"},
+	}
+	for _, req := range requests {
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, "value"))
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	want := []string{
+		"get value gopher", "post value ", "put value ",
+		"api get value ", "api post value ", "api put value ",
+	}
+	if !reflect.DeepEqual(routed, want) {
+		t.Errorf("got %v, want %v", routed, want)
+	}
+
+	// The routes share the trees
+	if h, ps, _ := router.Lookup(http.MethodGet, "/get/gopher"); h == nil || ps.ByName("name") != "gopher" {
+		t.Error("Lookup of a HandleC route failed")
+	}
+
+	recv := catchPanic(func() {
+		router.GETC("/nil", nil)
+	})
+	if recv == nil {
+		t.Error("registering nil HandleC did not panic")
+	}
+}
+
+type ctxKey struct{}
+
+func TestRouterParamsFromContextMiddleware(t *testing.T) {
+	var params Params
+	var value interface{}
+	handlerFunc := func(_ http.ResponseWriter, req *http.Request) {
+		params = ParamsFromContext(req.Context())
+		value = req.Context().Value(ctxKey{})
+	}
+
+	// stdlib middleware deriving new requests and wrapping the ResponseWriter
+	withValue := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), ctxKey{}, "value")
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+	withRecorder := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(httptest.NewRecorder(), req)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+
+	router := New()
+	router.Handler(http.MethodGet, "/user/:name", withRecorder(withValue(http.HandlerFunc(handlerFunc))))
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Routing failed: Code=%d", w.Code)
+	}
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Wrong parameter values: want %v, got %v", want, params)
+	}
+	if value != "value" {
+		t.Errorf("Wrong context value: %v", value)
+	}
+}
+
+func TestRouterUseContext(t *testing.T) {
+	var fromCtx, fromArg Params
+	handle := func(_ http.ResponseWriter, req *http.Request, ps Params) {
+		fromCtx = ParamsFromContext(req.Context())
+		fromArg = ps
+	}
+
+	router := New()
+	router.UseContext = true
+	router.GET("/user/:name", handle)
+	router.GET("/static", handle)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	want := Params{Param{"name", "gopher"}}
+	if !reflect.DeepEqual(fromCtx, want) {
+		t.Errorf("Wrong parameter values in context: want %v, got %v", want, fromCtx)
+	}
+	if !reflect.DeepEqual(fromArg, want) {
+		t.Errorf("Wrong parameter values: want %v, got %v", want, fromArg)
+	}
+
+	r, _ = http.NewRequest(http.MethodGet, "/static", nil)
+	router.ServeHTTP(w, r)
+	if fromCtx != nil {
+		t.Errorf("Params stored in context for static route: %v", fromCtx)
+	}
+
+	// disabled
+	router.UseContext = false
+	r, _ = http.NewRequest(http.MethodGet, "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if fromCtx != nil {
+		t.Errorf("Params stored in context although disabled: %v", fromCtx)
+	}
+}
+
+func TestRouterCaseInsensitive(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) {
+			routed = name
+		}
+	}
+
+	router := New()
+	router.CaseInsensitive = true
+	router.GET("/Users/:Name", handle("user"))
+	router.GET("/users/:Name/posts/*File", handle("files"))
+	router.GET("/search/", handle("search"))
+	router.GET("/src/:id(\\d+)", handle("src"))
+
+	tests := []struct {
+		path   string
+		routed string
+		params Params
+	}{
+		{"/users/Bob", "user", Params{Param{"Name", "Bob"}}},
+		{"/USERS/Bob", "user", Params{Param{"Name", "Bob"}}},
+		{"/uSeRs/BOB/Posts/A/b.TXT", "files", Params{Param{"Name", "BOB"}, Param{"File", "/A/b.TXT"}}},
+		{"/SEARCH/", "search", nil},
+		{"/Src/42", "src", Params{Param{"id", "42"}}},
+	}
+	for _, test := range tests {
+		handle, ps, _ := router.Lookup(http.MethodGet, test.path)
+		if handle == nil {
+			t.Errorf("Got no handle for %s", test.path)
+			continue
+		}
+		if !reflect.DeepEqual(ps, test.params) {
+			t.Errorf("Wrong parameter values for %s: want %v, got %v", test.path, test.params, ps)
+		}
+
+		routed = ""
+		r, _ := http.NewRequest(http.MethodGet, test.path, nil)
+		router.ServeHTTP(new(mockResponseWriter), r)
+		if routed != test.routed {
+			t.Errorf("%s routed to %q, want %q", test.path, routed, test.routed)
+		}
+	}
+
+	// Trailing slash redirects keep working
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/Search", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/Search/" {
+		t.Errorf("trailing slash redirect failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// Routes differing only in case conflict
+	recv := catchPanic(func() {
+		router.GET("/SEARCH/", handle("conflict"))
+	})
+	if recv == nil {
+		t.Error("registering route differing only in case did not panic")
+	}
+
+	// disabled
+	router = New()
+	router.GET("/users/:name", handle("user"))
+	if handle, _, _ := router.Lookup(http.MethodGet, "/Users/Bob"); handle != nil {
+		t.Error("Got handle for path with different case although disabled")
+	}
+}
+
 type mockFileSystem struct {
 	opened bool
 }
@@ -0,0 +1,154 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "sort"
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method string
+	Path   string
+	Handle Handle
+}
+
+// Routes returns all routes registered with the router, sorted by path and
+// then by method. The paths are the ones the routes were registered with,
+// including the wildcards, e.g. /user/:name or /src/*filepath, and the case
+// of their static parts even with CaseInsensitive.
+// Routes of host routers (see Host) are not included.
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	for method, root := range r.loadTrees().trees {
+		root.walk(func(path string, handle Handle) {
+			routes = append(routes, RouteInfo{
+				Method: method,
+				Path:   path,
+				Handle: handle,
+			})
+		})
+	}
+	sort.Sort(routesByPath(routes))
+	return routes
+}
+
+type routesByPath []RouteInfo
+
+func (r routesByPath) Len() int      { return len(r) }
+func (r routesByPath) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r routesByPath) Less(i, j int) bool {
+	if r[i].Path != r[j].Path {
+		return r[i].Path < r[j].Path
+	}
+	return r[i].Method < r[j].Method
+}
+
+// RouterStats summarizes the routes registered with a router, see
+// Router.Stats.
+type RouterStats struct {
+	// The number of routes per method, e.g. http.MethodGet or MethodWildcard
+	RoutesByMethod map[string]int
+
+	// The total number of routes
+	Routes int
+
+	// The number of routes with at least one named parameter (:name)
+	ParamRoutes int
+
+	// The number of routes with a catch-all parameter (*name)
+	CatchAllRoutes int
+
+	// The number of nodes on the longest path from the root of a tree to a
+	// leaf, including both
+	MaxDepth int
+}
+
+// Stats returns the numbers of routes registered with the router and the
+// depth of its trees. Unlike Routes, Stats walks the trees without
+// reassembling the paths of the routes, so it is cheap enough to be called
+// periodically, e.g. for metrics.
+// Routes of host routers (see Host) are not included.
+func (r *Router) Stats() RouterStats {
+	trees := r.loadTrees().trees
+	stats := RouterStats{RoutesByMethod: make(map[string]int, len(trees))}
+	for method, root := range trees {
+		if n := root.stats(1, false, false, &stats); n > 0 {
+			stats.RoutesByMethod[method] = n
+			stats.Routes += n
+		}
+	}
+	return stats
+}
+
+// Adds the routes of the subtree to the param and catch-all counts of stats
+// and returns their number. The depth is the one of the node, inParam and
+// inCatchAll tell whether the path down to it contains such wildcards.
+func (n *node) stats(depth int, inParam, inCatchAll bool, stats *RouterStats) int {
+	inParam = inParam || n.nType == param
+	inCatchAll = inCatchAll || n.nType == catchAll
+	if depth > stats.MaxDepth {
+		stats.MaxDepth = depth
+	}
+
+	routes := 0
+	if n.handle != nil {
+		routes++
+		if inParam {
+			stats.ParamRoutes++
+		}
+		if inCatchAll {
+			stats.CatchAllRoutes++
+		}
+	}
+	for _, child := range n.children {
+		routes += child.stats(depth+1, inParam, inCatchAll, stats)
+	}
+	return routes
+}
+
+// HandleBatch registers all given routes in the given order, like calling
+// TryHandle for each of them.
+// The routes are registered atomically: if one of them is invalid or conflicts
+// with another route, an error describing it is returned and none of the
+// routes is registered.
+//
+// HandleBatch is not faster than sequential Handle calls (see
+// BenchmarkHandleBatch). The shape of the trees does not depend on the
+// insertion order, and sorting the routes by path beforehand even slows the
+// insertion down. Since the trees of the affected methods are copied first,
+// adding a small batch to a large router is slower than calling Handle.
+//
+// The trees are replaced atomically like by HandleSafe, so HandleBatch may be
+// called while requests are served. This includes the routes without query
+// key of query routes (see HandleQuery) and without media type of accept
+// routes (see HandleAccept), which are published along with the trees.
+func (r *Router) HandleBatch(routes []RouteInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Work on copies of the existing trees
+	t := r.loadTrees().copy()
+	cloned := make(map[string]bool)
+	for _, route := range routes {
+		err := r.checkRoute(route.Method, route.Path, route.Handle)
+		if err == nil {
+			if t.setFallback(route.Method, route.Path, route.Handle) {
+				continue
+			}
+
+			if !cloned[route.Method] {
+				cloned[route.Method] = true
+				if root := t.trees[route.Method]; root != nil {
+					t.trees[route.Method] = root.clone()
+				}
+			}
+			err = r.tryHandle(t, route.Method, route.Path, route.Handle)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.trees.Store(t)
+	return nil
+}
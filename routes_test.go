@@ -0,0 +1,267 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestRouterRoutes(t *testing.T) {
+	router := New()
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Fatalf("Got routes for empty router: %v", routes)
+	}
+
+	routes := []RouteInfo{
+		{http.MethodGet, "/", nil},
+		{http.MethodGet, "/cmd/:tool/", nil},
+		{http.MethodGet, "/cmd/:tool/:sub", nil},
+		{http.MethodPost, "/cmd/:tool/:sub", nil},
+		{http.MethodGet, "/contact", nil},
+		{http.MethodGet, "/co", nil},
+		{http.MethodGet, "/search/", nil},
+		{http.MethodGet, "/search/:query", nil},
+		{http.MethodGet, "/src/*filepath", nil},
+		{http.MethodDelete, "/user/:id(\\d+)", nil},
+		{http.MethodGet, "/user/:id(\\d+)", nil},
+	}
+	for i := len(routes) - 1; i >= 0; i-- {
+		method, path := routes[i].Method, routes[i].Path
+		router.Handle(method, path, func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Header().Set("X-Route", method+" "+path)
+		})
+	}
+
+	got := router.Routes()
+	if len(got) != len(routes) {
+		t.Fatalf("Got %d routes, want %d: %v", len(got), len(routes), got)
+	}
+
+	// Sorted by path, then method
+	sorted := []string{
+		"GET /",
+		"GET /cmd/:tool/",
+		"GET /cmd/:tool/:sub",
+		"POST /cmd/:tool/:sub",
+		"GET /co",
+		"GET /contact",
+		"GET /search/",
+		"GET /search/:query",
+		"GET /src/*filepath",
+		"DELETE /user/:id(\\d+)",
+		"GET /user/:id(\\d+)",
+	}
+	for i, route := range got {
+		if s := route.Method + " " + route.Path; s != sorted[i] {
+			t.Errorf("route %d: got %q, want %q", i, s, sorted[i])
+		}
+
+		// The handle belongs to the route
+		w := httptest.NewRecorder()
+		route.Handle(w, nil, nil)
+		if s := w.Header().Get("X-Route"); s != sorted[i] {
+			t.Errorf("route %d: got handle of %q", i, s)
+		}
+	}
+}
+
+func TestRouterRoutesCaseInsensitive(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.CaseInsensitive = true
+	router.GET("/Users/:Name", handle)
+	router.GET("/Src/*Path/Raw", handle)
+	router.GET("/Docs/:Page?", handle)
+
+	var got []string
+	for _, route := range router.Routes() {
+		got = append(got, route.Path)
+	}
+	want := []string{"/Docs", "/Docs/:Page", "/Src/*Path/Raw", "/Users/:Name"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got routes %q, want %q", got, want)
+	}
+
+	if errs := router.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+
+	// Lookups report the registered route as well
+	if res := router.LookupDetailed(http.MethodGet, "/users/bob"); res.Route != "/Users/:Name" {
+		t.Errorf("Got route %q, want /Users/:Name", res.Route)
+	}
+}
+
+func TestRouterStats(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	if stats := router.Stats(); !reflect.DeepEqual(stats, RouterStats{RoutesByMethod: map[string]int{}}) {
+		t.Errorf("Got stats for empty router: %+v", stats)
+	}
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/cmd/:tool/"},
+		{http.MethodGet, "/cmd/:tool/:sub"},
+		{http.MethodPost, "/cmd/:tool/:sub"},
+		{http.MethodGet, "/contact"},
+		{http.MethodGet, "/src/*filepath"},
+		{http.MethodGet, "/files/:dir/*filepath"},
+		{http.MethodDelete, "/user/:id(\\d+)"},
+		{MethodWildcard, "/health"},
+	} {
+		router.Handle(route.method, route.path, handle)
+	}
+
+	want := RouterStats{
+		RoutesByMethod: map[string]int{
+			http.MethodGet:    6,
+			http.MethodPost:   1,
+			http.MethodDelete: 1,
+			MethodWildcard:    1,
+		},
+		Routes:         9,
+		ParamRoutes:    5,
+		CatchAllRoutes: 2,
+		MaxDepth:       6, // / c md/ :tool / :sub
+	}
+	if stats := router.Stats(); !reflect.DeepEqual(stats, want) {
+		t.Errorf("Got stats %+v, want %+v", stats, want)
+	}
+
+	// The depth counts the nodes from the root to the deepest leaf
+	for _, test := range []struct {
+		paths []string
+		depth int
+	}{
+		{[]string{"/a"}, 1},
+		{[]string{"/a", "/b"}, 2},
+		{[]string{"/a", "/ab", "/abc"}, 3},
+		{[]string{"/user/:id"}, 2},
+	} {
+		router := New()
+		for _, path := range test.paths {
+			router.GET(path, handle)
+		}
+		if depth := router.Stats().MaxDepth; depth != test.depth {
+			t.Errorf("%v: got depth %d, want %d", test.paths, depth, test.depth)
+		}
+	}
+}
+
+func TestRouterHandleBatch(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/", handle)
+
+	err := router.HandleBatch([]RouteInfo{
+		{http.MethodGet, "/user/:name", handle},
+		{http.MethodPost, "/user/:name", handle},
+		{http.MethodGet, "/src/*filepath", handle},
+		{http.MethodGet, "/cmd/:tool/:sub", handle},
+		{http.MethodGet, "/cmd/:tool/", handle},
+	})
+	if err != nil {
+		t.Fatalf("HandleBatch failed: %v", err)
+	}
+	if got := len(router.Routes()); got != 6 {
+		t.Errorf("Got %d routes, want 6", got)
+	}
+	if errs := router.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+
+	// A conflict registers none of the routes
+	before := router.Routes()
+	err = router.HandleBatch([]RouteInfo{
+		{http.MethodGet, "/new", handle},
+		{http.MethodPut, "/new/:id", handle},
+		{http.MethodGet, "/user/:id", handle},
+	})
+	rce, ok := err.(*RouteConflictError)
+	if !ok || rce.Method != http.MethodGet || rce.Path != "/user/:id" {
+		t.Fatalf("Got error %v, want conflict for GET /user/:id", err)
+	}
+	if after := router.Routes(); len(after) != len(before) {
+		t.Errorf("Got %d routes after conflict, want %d", len(after), len(before))
+	}
+	if handle, _, _ := router.Lookup(http.MethodGet, "/new"); handle != nil {
+		t.Error("Route of rejected batch was registered")
+	}
+	if _, ok := router.loadTrees().trees[http.MethodPut]; ok {
+		t.Error("Tree of rejected batch was added")
+	}
+	if allow := router.allowed("*", ""); allow != router.loadTrees().globalAllowed {
+		t.Errorf("globalAllowed out of sync: %q, want %q", router.loadTrees().globalAllowed, allow)
+	}
+	if errs := router.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+
+	if err := router.HandleBatch([]RouteInfo{{http.MethodGet, "/nil", nil}}); err == nil {
+		t.Error("HandleBatch accepted nil handle")
+	}
+}
+
+// Builds 10k routes in a pseudo-random order
+func benchRoutes() []RouteInfo {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	routes := make([]RouteInfo, 0, 10000)
+	for i := 0; i < 1000; i++ {
+		for j := 0; j < 10; j++ {
+			routes = append(routes, RouteInfo{
+				Method: http.MethodGet,
+				Path:   "/api/v" + strconv.Itoa(j) + "/resource" + strconv.Itoa(i) + "/:id",
+				Handle: handle,
+			})
+		}
+	}
+	for i := range routes {
+		j := (i * 7919) % len(routes)
+		routes[i], routes[j] = routes[j], routes[i]
+	}
+	return routes
+}
+
+func BenchmarkHandleSequential(b *testing.B) {
+	routes := benchRoutes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router := New()
+		for _, route := range routes {
+			router.Handle(route.Method, route.Path, route.Handle)
+		}
+	}
+}
+
+func BenchmarkHandleBatch(b *testing.B) {
+	routes := benchRoutes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router := New()
+		if err := router.HandleBatch(routes); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStats(b *testing.B) {
+	router := New()
+	if err := router.HandleBatch(benchRoutes()); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.Stats()
+	}
+}
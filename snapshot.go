@@ -0,0 +1,216 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"errors"
+	"regexp"
+)
+
+// TreeSnapshot is a copy of the trees of a router, see Router.Snapshot.
+// It can be marshaled, e.g. to JSON, and loaded into a router again with
+// Router.LoadSnapshot.
+type TreeSnapshot struct {
+	// The root node of the tree of each method
+	Trees map[string]*NodeSnapshot `json:"trees"`
+}
+
+// NodeSnapshot is a copy of a node of a tree, see TreeSnapshot.
+type NodeSnapshot struct {
+	// Path segment of the node. The path of a wildcard node includes the
+	// wildcard and its constraint, e.g. :id(\d+) or /*filepath.
+	Path string `json:"path"`
+
+	// Type of the node: "static", "root", "param" or "catchAll"
+	Type string `json:"type"`
+
+	// Name of the parameter of a wildcard node
+	Param string `json:"param,omitempty"`
+
+	// First bytes of the paths of the children of a static node
+	Indices string `json:"indices,omitempty"`
+
+	// Whether the only child of the node is a wildcard node
+	WildChild bool `json:"wildChild,omitempty"`
+
+	// Number of routes in the subtree
+	Priority uint32 `json:"priority"`
+
+	// Static path following the parameter of a catch-all node
+	Suffix string `json:"suffix,omitempty"`
+
+	// Registered path of the route, if the node holds a handle
+	Route string `json:"route,omitempty"`
+
+	Children []*NodeSnapshot `json:"children,omitempty"`
+}
+
+var nodeTypeNames = [...]string{
+	static:   "static",
+	root:     "root",
+	param:    "param",
+	catchAll: "catchAll",
+}
+
+// Snapshot returns a copy of the trees of the router. Modifying it does not
+// affect the router. Handles are not part of the snapshot, nodes holding a
+// handle are marked with the path of their route instead.
+// Routes of host routers (see Host) are not included.
+func (r *Router) Snapshot() *TreeSnapshot {
+	trees := r.loadTrees().trees
+	s := &TreeSnapshot{Trees: make(map[string]*NodeSnapshot, len(trees))}
+	for method, root := range trees {
+		s.Trees[method] = root.snapshot()
+	}
+	return s
+}
+
+func (n *node) snapshot() *NodeSnapshot {
+	s := &NodeSnapshot{
+		Path:      n.path,
+		Type:      nodeTypeNames[n.nType],
+		Indices:   n.indices,
+		WildChild: n.wildChild,
+		Priority:  n.priority,
+		Suffix:    n.suffix,
+	}
+	if n.nType == param || n.nType == catchAll {
+		s.Param = wildcardKey(n.path)
+	}
+	if n.handle != nil {
+		s.Route = n.fullPath
+	}
+	if len(n.children) > 0 {
+		s.Children = make([]*NodeSnapshot, len(n.children))
+		for i, child := range n.children {
+			s.Children[i] = child.snapshot()
+		}
+	}
+	return s
+}
+
+// Returns the key of the parameter of a wildcard node path like :id(\d+) or
+// /*filepath.
+func wildcardKey(path string) string {
+	if len(path) > 0 && path[0] == '/' {
+		path = path[1:]
+	}
+	if len(path) < 2 {
+		return ""
+	}
+	name, _ := splitConstraint(path)
+	return name[1:]
+}
+
+// LoadSnapshot replaces the routes of the router with the trees of the
+// snapshot, without inserting the routes one by one. The function handle is
+// called for each route of the snapshot and must return the handle for it.
+// The route path is the one listed by Routes, i.e. for a route with an
+// optional parameter it is called with the path with the parameter and the
+// path without it.
+// An error is returned if the snapshot is malformed, e.g. because it was
+// modified, or if handle returns nil. In this case the router is unchanged.
+// Routes of host routers (see Host) are not affected.
+// Query routes (see HandleQuery) and accept routes (see HandleAccept) are
+// removed, the handle returned for their path is registered like with Handle.
+// Route names (see HandleNamed) are removed as well, since the snapshot does
+// not contain them.
+func (r *Router) LoadSnapshot(s *TreeSnapshot, handle func(method, path string) Handle) error {
+	trees := make(map[string]*node, len(s.Trees))
+	paths := make(map[string][]string, len(s.Trees))
+	for method, root := range s.Trees {
+		if root == nil {
+			return errors.New("missing root node for method '" + method + "'")
+		}
+		var methodPaths []string
+		n, err := loadNode(root, method, handle, &methodPaths)
+		if err != nil {
+			return err
+		}
+		if errs, _ := n.validate(method, "", nil); len(errs) > 0 {
+			return errs[0]
+		}
+		trees[method] = n
+		paths[method] = methodPaths
+	}
+
+	t := &methodTrees{trees: trees}
+	t.globalAllowed = r.allowedIn(t, "*", "")
+	for method, methodPaths := range paths {
+		for _, path := range methodPaths {
+			r.updateMaxParams(t, trees[method], path)
+		}
+	}
+	r.trees.Store(t)
+	return nil
+}
+
+func loadNode(s *NodeSnapshot, method string, handle func(method, path string) Handle, paths *[]string) (n *node, err error) {
+	n = &node{
+		path:      s.Path,
+		indices:   s.Indices,
+		wildChild: s.WildChild,
+		priority:  s.Priority,
+		suffix:    s.Suffix,
+	}
+
+	found := false
+	for t, name := range nodeTypeNames {
+		if s.Type == name {
+			n.nType, found = nodeType(t), true
+		}
+	}
+	if !found {
+		return nil, errors.New("invalid node type '" + s.Type + "' in snapshot for method '" + method + "'")
+	}
+
+	if (n.nType == param || n.nType == catchAll) && s.Path != "" {
+		if wildcardKey(s.Path) != s.Param {
+			return nil, errors.New("parameter '" + s.Param + "' does not match node '" + s.Path + "' in snapshot for method '" + method + "'")
+		}
+		wildcard := s.Path
+		if n.nType == catchAll {
+			wildcard = wildcard[1:]
+		}
+		if n.constraint, err = tryCompileConstraint(wildcard, s.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Route != "" {
+		if n.handle = handle(method, s.Route); n.handle == nil {
+			return nil, errors.New("no handle for route '" + s.Route + "' in snapshot for method '" + method + "'")
+		}
+		n.fullPath = s.Route
+		*paths = append(*paths, s.Route)
+	}
+
+	if len(s.Children) > 0 {
+		n.children = make([]*node, len(s.Children))
+		for i, child := range s.Children {
+			if child == nil {
+				return nil, errors.New("missing child of node '" + s.Path + "' in snapshot for method '" + method + "'")
+			}
+			if n.children[i], err = loadNode(child, method, handle, paths); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Like compileConstraint, but returns an error instead of panicking.
+func tryCompileConstraint(wildcard, fullPath string) (re *regexp.Regexp, err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			msg, ok := rcv.(string)
+			if !ok {
+				panic(rcv)
+			}
+			err = errors.New(msg)
+		}
+	}()
+	return compileConstraint(wildcard, fullPath), nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterSnapshot(t *testing.T) {
+	handle := func(route string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, ps Params) {
+			w.Header().Set("X-Route", route)
+			w.Header().Set("X-Params", ps.ByName("id")+ps.ByName("filepath"))
+		}
+	}
+
+	router := New()
+	routes := []RouteInfo{
+		{http.MethodGet, "/", nil},
+		{http.MethodGet, "/user/:id(\\d+)", nil},
+		{http.MethodGet, "/user/:id(\\d+)/posts", nil},
+		{http.MethodGet, "/src/*filepath", nil},
+		{http.MethodGet, "/proxy/*filepath/info", nil},
+		{http.MethodPost, "/user/:id(\\d+)", nil},
+	}
+	for _, route := range routes {
+		router.Handle(route.Method, route.Path, handle(route.Method+" "+route.Path))
+	}
+
+	s := router.Snapshot()
+	if len(s.Trees) != 2 {
+		t.Fatalf("Got %d trees, want 2", len(s.Trees))
+	}
+	if root := s.Trees[http.MethodGet]; root.Type != "root" || root.Route != "/" || root.Priority != 5 {
+		t.Errorf("unexpected root node %+v", root)
+	}
+
+	// The snapshot is a copy
+	s.Trees[http.MethodGet].Path = "/changed"
+	if router.loadTrees().trees[http.MethodGet].path == "/changed" {
+		t.Fatal("Modifying the snapshot modified the tree")
+	}
+	s = router.Snapshot()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded TreeSnapshot
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&loaded, s) {
+		t.Fatalf("Snapshot changed by JSON round trip")
+	}
+
+	var rebound []string
+	reloaded := New()
+	err = reloaded.LoadSnapshot(&loaded, func(method, path string) Handle {
+		rebound = append(rebound, method+" "+path)
+		return handle(method + " " + path)
+	})
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if len(rebound) != len(routes) {
+		t.Errorf("handle called for %v, want %d routes", rebound, len(routes))
+	}
+	if errs := reloaded.Validate(); errs != nil {
+		t.Errorf("Validate failed: %v", errs)
+	}
+	if !reflect.DeepEqual(reloaded.Snapshot(), s) {
+		t.Error("Snapshot of the reloaded router differs")
+	}
+	if reloaded.loadTrees().globalAllowed != router.loadTrees().globalAllowed || reloaded.loadTrees().maxParams != router.loadTrees().maxParams {
+		t.Error("LoadSnapshot did not update the router state")
+	}
+
+	requests := []struct {
+		method, path, route, params string
+	}{
+		{http.MethodGet, "/", "GET /", ""},
+		{http.MethodGet, "/user/42", "GET /user/:id(\\d+)", "42"},
+		{http.MethodPost, "/user/42", "POST /user/:id(\\d+)", "42"},
+		{http.MethodGet, "/user/42/posts", "GET /user/:id(\\d+)/posts", "42"},
+		{http.MethodGet, "/user/gopher", "", ""}, // constraint
+		{http.MethodGet, "/src/a/b", "GET /src/*filepath", "/a/b"},
+		{http.MethodGet, "/proxy/a/info", "GET /proxy/*filepath/info", "/a"},
+	}
+	for _, req := range requests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(req.method, req.path, nil)
+		reloaded.ServeHTTP(w, r)
+		if route := w.Header().Get("X-Route"); route != req.route {
+			t.Errorf("%s %s: routed to %q, want %q", req.method, req.path, route, req.route)
+		}
+		if ps := w.Header().Get("X-Params"); ps != req.params {
+			t.Errorf("%s %s: got params %q, want %q", req.method, req.path, ps, req.params)
+		}
+	}
+}
+
+func TestRouterSnapshotCatchAllBelowRoute(t *testing.T) {
+	handle := func(route string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ Params) {
+			w.Header().Set("X-Route", route)
+		}
+	}
+
+	router := New()
+	router.GET("/x", handle("/x"))
+	router.GET("/x/*rest", handle("/x/*rest"))
+	router.HandleSubtree(http.MethodGet, "/admin", handle("/admin"))
+
+	s := router.Snapshot()
+	reloaded := New()
+	err := reloaded.LoadSnapshot(s, func(_, path string) Handle {
+		if path == "/admin/*"+SubtreePathParam {
+			path = "/admin"
+		}
+		return handle(path)
+	})
+	if err != nil {
+		t.Fatalf("LoadSnapshot failed: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.Snapshot(), s) {
+		t.Error("Snapshot of the reloaded router differs")
+	}
+
+	for path, route := range map[string]string{
+		"/x":        "/x",
+		"/x/a/b":    "/x/*rest",
+		"/admin":    "/admin",
+		"/admin/01": "/admin",
+	} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(http.MethodGet, path, nil)
+		reloaded.ServeHTTP(w, r)
+		if got := w.Header().Get("X-Route"); got != route {
+			t.Errorf("%s: routed to %q, want %q", path, got, route)
+		}
+	}
+}
+
+func TestRouterLoadSnapshotInvalid(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+	router := New()
+	router.GET("/user/:id(\\d+)", handle)
+	router.GET("/users", handle)
+	rebind := func(_, _ string) Handle { return handle }
+
+	corruptions := map[string]func(s *TreeSnapshot){
+		"type":       func(s *TreeSnapshot) { s.Trees["GET"].Type = "unknown" },
+		"param":      func(s *TreeSnapshot) { s.Trees["GET"].Children[0].Children[0].Param = "name" },
+		"constraint": func(s *TreeSnapshot) { s.Trees["GET"].Children[0].Children[0].Path = ":id(\\d+" },
+		"priority":   func(s *TreeSnapshot) { s.Trees["GET"].Priority = 3 },
+		"route":      func(s *TreeSnapshot) { s.Trees["GET"].Children[1].Route = "/other" },
+		"indices":    func(s *TreeSnapshot) { s.Trees["GET"].Indices = "x" },
+		"root":       func(s *TreeSnapshot) { s.Trees["POST"] = nil },
+		"child":      func(s *TreeSnapshot) { s.Trees["GET"].Children[0] = nil },
+	}
+	for name, corrupt := range corruptions {
+		s := router.Snapshot()
+		if root := s.Trees["GET"]; root.Path != "/user" || len(root.Children) != 2 || root.Children[0].Path != "/" {
+			t.Fatalf("unexpected tree %+v", root)
+		}
+		corrupt(s)
+
+		reloaded := New()
+		reloaded.GET("/existing", handle)
+		if err := reloaded.LoadSnapshot(s, rebind); err == nil {
+			t.Errorf("%s: LoadSnapshot accepted corrupted snapshot", name)
+		}
+		if h, _, _ := reloaded.Lookup(http.MethodGet, "/existing"); h == nil {
+			t.Errorf("%s: LoadSnapshot modified the router", name)
+		}
+	}
+
+	err := New().LoadSnapshot(router.Snapshot(), func(_, _ string) Handle { return nil })
+	if err == nil {
+		t.Error("LoadSnapshot accepted nil handle")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"time"
+)
+
+// HandleWithTimeout registers a new request handle with the given path and
+// method, like Handle, whose execution time is limited to d.
+// The handle runs like with http.TimeoutHandler: in its own goroutine, with a
+// request context which is canceled after d, and with an http.ResponseWriter
+// which buffers the response. If the handle returns within d, the buffered
+// response is written. Otherwise a 503 (Service Unavailable) response is
+// written and all writes of the handle afterwards fail with
+// http.ErrHandlerTimeout, so the handle and the timeout never write to the
+// connection concurrently. The handle keeps running until it returns, and
+// should therefore stop once its request context is done.
+// Since the response is buffered, streaming (http.Flusher) and hijacking are
+// not supported. The Params are copied, they stay valid after the timeout.
+func (r *Router) HandleWithTimeout(method, path string, d time.Duration, handle Handle) {
+	r.Handle(method, path, timeoutHandle(d, handle))
+}
+
+// HandleWithTimeout registers a new request handle with the given method and
+// the path prefixed by the group prefix, whose execution time is limited to d.
+// The middleware of the group is not limited. See Router.HandleWithTimeout.
+func (g *Group) HandleWithTimeout(method, path string, d time.Duration, handle Handle) {
+	g.Handle(method, path, timeoutHandle(d, handle))
+}
+
+func timeoutHandle(d time.Duration, handle Handle) Handle {
+	if handle == nil {
+		panic("handle must not be nil")
+	}
+	if d <= 0 {
+		panic("timeout must be positive")
+	}
+	return func(w http.ResponseWriter, req *http.Request, ps Params) {
+		// The Params may be reused once this handle returned, e.g. when
+		// UseParamsPool is enabled, while the handle is still running
+		if ps != nil {
+			ps = append(Params(nil), ps...)
+		}
+		h := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			handle(w, req, ps)
+		})
+		http.TimeoutHandler(h, d, "").ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterHandleWithTimeout(t *testing.T) {
+	done := make(chan error, 1)
+	release := make(chan struct{})
+
+	router := New()
+	router.HandleWithTimeout(http.MethodGet, "/fast/:name", time.Second, func(w http.ResponseWriter, _ *http.Request, ps Params) {
+		w.Header().Set("X-Name", ps.ByName("name"))
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "fast")
+	})
+	router.Group("/api").HandleWithTimeout(http.MethodGet, "/slow/:name", 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request, ps Params) {
+		<-r.Context().Done()
+		<-release
+		// Written after the timeout response
+		_, err := io.WriteString(w, "slow "+ps.ByName("name"))
+		done <- err
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest(http.MethodGet, "/fast/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated || w.Header().Get("X-Name") != "gopher" || w.Body.String() != "fast" {
+		t.Errorf("fast handle: Code=%d, Header=%v, Body=%q", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest(http.MethodGet, "/api/slow/gopher", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("slow handle: got Code %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != http.ErrHandlerTimeout {
+			t.Errorf("write after timeout: got error %v, want %v", err, http.ErrHandlerTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow handle did not return")
+	}
+	if body := w.Body.String(); body == "slow gopher" {
+		t.Errorf("write after timeout reached the response: %q", body)
+	}
+
+	for _, d := range []time.Duration{0, -time.Second} {
+		recv := catchPanic(func() {
+			router.HandleWithTimeout(http.MethodGet, "/invalid", d, func(_ http.ResponseWriter, _ *http.Request, _ Params) {})
+		})
+		if recv == nil {
+			t.Errorf("timeout %v did not panic", d)
+		}
+	}
+}
@@ -5,6 +5,7 @@
 package httprouter
 
 import (
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -26,6 +27,26 @@ func longestCommonPrefix(a, b string) int {
 	return i
 }
 
+// Returns a description of a route registered in the subtree of n, for the
+// panic message of a conflict with the subtree. The routes with the highest
+// priority come first, since the children are sorted by it.
+func (n *node) existingRoute() string {
+	for n.fullPath == "" {
+		if len(n.children) == 0 {
+			return ""
+		}
+		n = n.children[0]
+	}
+	return " of existing route '" + n.fullPath + "'"
+}
+
+// Appended to the panic messages for a static segment and a wildcard at the
+// same position. Such routes are never registered together, since either of
+// them would silently shadow the other one for some requests.
+const overlapHint = "; a static segment and a wildcard can not share the same " +
+	"position, check for the static value in the handle of the wildcard route " +
+	"or move one of the routes to a different path"
+
 // Search for a wildcard segment and check the name for invalid characters.
 // Returns -1 as index, if no wildcard was found.
 func findWildcard(path string) (wilcard string, i int, valid bool) {
@@ -38,12 +59,25 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 
 		// Find end and check for invalid characters
 		valid = true
-		for end, c := range []byte(path[start+1:]) {
-			switch c {
+		for end := start + 1; end < len(path); end++ {
+			switch path[end] {
 			case '/':
-				return path[start : start+1+end], start, valid
+				return path[start:end], start, valid
 			case ':', '*':
 				valid = false
+			case '(':
+				// Skip the constraint, it may contain any character.
+				// If it is not terminated, the rest of the path is returned
+				// and rejected when the constraint is compiled.
+				if cEnd := constraintEnd(path[end:]); cEnd > 0 {
+					end += cEnd
+					if end+1 < len(path) && path[end+1] != '/' {
+						// Something follows the constraint within the segment
+						valid = false
+					}
+				} else {
+					return path[start:], start, valid
+				}
 			}
 		}
 		return path[start:], start, valid
@@ -51,15 +85,128 @@ func findWildcard(path string) (wilcard string, i int, valid bool) {
 	return "", -1, false
 }
 
-func countParams(path string) uint16 {
-	var n uint
-	for i := range []byte(path) {
-		switch path[i] {
-		case ':', '*':
-			n++
+// Returns the index of the ')' closing the constraint at the beginning of s,
+// or -1 if the constraint is not terminated.
+// Escaped chars and chars within character classes are skipped.
+func constraintEnd(s string) int {
+	depth := 0
+	class := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Splits a wildcard like ':id(\d+)' into the wildcard name ':id' and the
+// constraint expression '\d+'. The expression is empty if the wildcard has no
+// constraint.
+func splitConstraint(wildcard string) (name, expr string) {
+	if i := strings.IndexByte(wildcard, '('); i >= 0 {
+		return wildcard[:i], wildcard[i:]
+	}
+	return wildcard, ""
+}
+
+// Splits an optional trailing parameter like in /files/:name? off the path.
+// It returns the path without the '?', the path without the parameter and the
+// key of the parameter. The key is empty if the path has no optional
+// parameter.
+func splitOptional(path string) (full, short, key string) {
+	if len(path) < 2 || path[len(path)-1] != '?' {
+		return path, "", ""
+	}
+	full = path[:len(path)-1]
+
+	// Find the last wildcard
+	for offset := 0; ; {
+		wildcard, i, valid := findWildcard(full[offset:])
+		if i < 0 {
+			return path, "", ""
+		}
+		offset += i
+		if offset+len(wildcard) < len(full) {
+			offset += len(wildcard)
+			continue
+		}
+
+		if wildcard[0] != ':' || !valid || offset == 0 {
+			return path, "", ""
+		}
+		short = full[:offset]
+		if len(short) > 1 && short[len(short)-1] == '/' {
+			short = short[:len(short)-1]
+		}
+		name, _ := splitConstraint(wildcard)
+		return full, short, name[1:]
+	}
+}
+
+// Compiles the constraint of the given wildcard, if it has one.
+// The expression must match the whole parameter value.
+func compileConstraint(wildcard, fullPath string) *regexp.Regexp {
+	_, expr := splitConstraint(wildcard)
+	if expr == "" {
+		return nil
+	}
+	if expr[len(expr)-1] != ')' || constraintEnd(expr) != len(expr)-1 {
+		panic("unterminated constraint '" + expr + "' in path '" + fullPath + "'")
+	}
+	if len(expr) == 2 {
+		panic("constraints must not be empty in path '" + fullPath + "'")
+	}
+	re, err := regexp.Compile("^(?:" + expr[1:len(expr)-1] + ")$")
+	if err != nil {
+		panic("invalid constraint '" + expr + "' in path '" + fullPath + "': " + err.Error())
+	}
+	return re
+}
+
+// Panics if a wildcard name is used more than once in the path, since only
+// the first of the values could be retrieved with Params.ByName.
+func checkWildcardNames(path string) {
+	var names []string
+	for rest := path; ; {
+		wildcard, i, valid := findWildcard(rest)
+		if i < 0 {
+			return
+		}
+		// Invalid wildcards are rejected on insertion
+		if name, _ := splitConstraint(wildcard); valid && len(name) > 1 {
+			for _, seen := range names {
+				if seen == name[1:] {
+					panic("wildcard name '" + seen + "' is used more than once in path '" + path + "'")
+				}
+			}
+			names = append(names, name[1:])
 		}
+		rest = rest[i+len(wildcard):]
+	}
+}
+
+func countParams(path string) int {
+	n := 0
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return n
+		}
+		n++
+		path = path[i+len(wildcard):]
 	}
-	return uint16(n)
 }
 
 type nodeType uint8
@@ -79,6 +226,19 @@ type node struct {
 	priority  uint32
 	children  []*node
 	handle    Handle
+
+	// Registered path of the route the handle belongs to
+	fullPath string
+
+	// Compiled constraint of param and catch-all nodes, if any
+	constraint *regexp.Regexp
+
+	// Static path following the catch-all parameter of a catch-all node
+	suffix string
+
+	// Maximum number of params of the routes in the tree, only set for the
+	// root node
+	maxParams uint16
 }
 
 // Increments priority of the given child and reorders if necessary
@@ -108,7 +268,15 @@ func (n *node) incrementChildPrio(pos int) int {
 // addRoute adds a node with the given handle to the path.
 // Not concurrency-safe!
 func (n *node) addRoute(path string, handle Handle) {
-	fullPath := path
+	n.insertRoute(path, path, handle)
+}
+
+// Like addRoute, but the route is registered as fullPath, e.g. the path
+// before its static parts were lowercased for CaseInsensitive. The fullPath
+// must have the same length as the path.
+func (n *node) insertRoute(path, fullPath string, handle Handle) {
+	key := path
+	checkWildcardNames(fullPath)
 	n.priority++
 
 	// Empty tree
@@ -134,6 +302,7 @@ walk:
 				indices:   n.indices,
 				children:  n.children,
 				handle:    n.handle,
+				fullPath:  n.fullPath,
 				priority:  n.priority - 1,
 			}
 
@@ -142,6 +311,7 @@ walk:
 			n.indices = string([]byte{n.path[i]})
 			n.path = path[:i]
 			n.handle = nil
+			n.fullPath = ""
 			n.wildChild = false
 		}
 
@@ -164,14 +334,34 @@ walk:
 					// Wildcard conflict
 					pathSeg := path
 					if n.nType != catchAll {
-						pathSeg = strings.SplitN(pathSeg, "/", 2)[0]
+						if wildcard, i, _ := findWildcard(pathSeg); i == 0 {
+							pathSeg = wildcard
+						} else {
+							pathSeg = strings.SplitN(pathSeg, "/", 2)[0]
+						}
+					}
+					prefix := key[:strings.Index(key, pathSeg)] + n.path
+
+					// Same wildcard, but with a different constraint
+					newName, newExpr := splitConstraint(pathSeg)
+					if name, expr := splitConstraint(n.path); name == newName && expr != newExpr {
+						panic("constraint '" + newExpr +
+							"' of wildcard '" + newName +
+							"' in new path '" + fullPath +
+							"' conflicts with existing constraint '" + expr +
+							"' in existing prefix '" + prefix +
+							"'" + n.existingRoute())
 					}
-					prefix := fullPath[:strings.Index(fullPath, pathSeg)] + n.path
-					panic("'" + pathSeg +
+
+					msg := "'" + pathSeg +
 						"' in new path '" + fullPath +
 						"' conflicts with existing wildcard '" + n.path +
 						"' in existing prefix '" + prefix +
-						"'")
+						"'" + n.existingRoute()
+					if pathSeg[0] != ':' && pathSeg[0] != '*' {
+						msg += overlapHint
+					}
+					panic(msg)
 				}
 			}
 
@@ -211,10 +401,61 @@ walk:
 			panic("a handle is already registered for path '" + fullPath + "'")
 		}
 		n.handle = handle
+		n.fullPath = fullPath
 		return
 	}
 }
 
+// tryAddRoute adds a node with the given handle to the path, like
+// insertRoute. Instead of panicking, it returns the message of the conflict.
+// Not concurrency-safe!
+func (n *node) tryAddRoute(path, fullPath string, handle Handle) (msg string, ok bool) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if msg, ok = rcv.(string); !ok {
+				panic(rcv)
+			}
+			ok = false
+
+			// The priorities along the path were already incremented
+			n.updatePriorities()
+		}
+	}()
+
+	// Check the path on an empty tree first, so that an invalid path does not
+	// leave partially inserted nodes behind
+	new(node).insertRoute(path, fullPath, handle)
+
+	n.insertRoute(path, fullPath, handle)
+	return "", true
+}
+
+// Recomputes the priorities of the subtree from the number of handles and
+// reorders the children accordingly. Returns the priority of n.
+func (n *node) updatePriorities() uint32 {
+	var prio uint32
+	if n.handle != nil {
+		prio++
+	}
+	for _, child := range n.children {
+		prio += child.updatePriorities()
+	}
+	n.priority = prio
+
+	if len(n.indices) == len(n.children) {
+		// Stable insertion sort by priority, keeping the indices in sync
+		cs, indices := n.children, []byte(n.indices)
+		for i := 1; i < len(cs); i++ {
+			for j := i; j > 0 && cs[j-1].priority < cs[j].priority; j-- {
+				cs[j-1], cs[j] = cs[j], cs[j-1]
+				indices[j-1], indices[j] = indices[j], indices[j-1]
+			}
+		}
+		n.indices = string(indices)
+	}
+	return prio
+}
+
 func (n *node) insertChild(path, fullPath string, handle Handle) {
 	for {
 		// Find prefix until first wildcard
@@ -230,15 +471,21 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 		}
 
 		// Check if the wildcard has a name
-		if len(wildcard) < 2 {
+		name, _ := splitConstraint(wildcard)
+		if len(name) < 2 {
 			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
 		}
+		if name[len(name)-1] == '?' {
+			panic("optional parameters are only allowed at the end of the path in path '" + fullPath + "'")
+		}
+		constraint := compileConstraint(wildcard, fullPath)
 
 		// Check if this node has existing children which would be
 		// unreachable if we insert the wildcard here
 		if len(n.children) > 0 {
 			panic("wildcard segment '" + wildcard +
-				"' conflicts with existing children in path '" + fullPath + "'")
+				"' conflicts with existing children in path '" + fullPath + "'" +
+				n.existingRoute() + overlapHint)
 		}
 
 		if wildcard[0] == ':' { // param
@@ -250,8 +497,9 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			n.wildChild = true
 			child := &node{
-				nType: param,
-				path:  wildcard,
+				nType:      param,
+				path:       wildcard,
+				constraint: constraint,
 			}
 			n.children = []*node{child}
 			n = child
@@ -271,15 +519,19 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			// Otherwise we're done. Insert the handle in the new leaf
 			n.handle = handle
+			n.fullPath = fullPath
 			return
 
 		} else { // catchAll
-			if i+len(wildcard) != len(path) {
-				panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
+			// A catch-all can only be followed by a static suffix
+			suffix := path[i+len(wildcard):]
+			if _, j, _ := findWildcard(suffix); j >= 0 {
+				panic("catch-all routes are only allowed at the end of the path or before a static suffix in path '" + fullPath + "'")
 			}
 
 			if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
-				panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
+				panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'" +
+					n.existingRoute())
 			}
 
 			// Currently fixed width 1 for '/'
@@ -302,10 +554,13 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 
 			// Second node: node holding the variable
 			child = &node{
-				path:     path[i:],
-				nType:    catchAll,
-				handle:   handle,
-				priority: 1,
+				path:       path[i : len(path)-len(suffix)],
+				nType:      catchAll,
+				handle:     handle,
+				fullPath:   fullPath,
+				priority:   1,
+				constraint: constraint,
+				suffix:     suffix,
 			}
 			n.children = []*node{child}
 
@@ -316,19 +571,64 @@ func (n *node) insertChild(path, fullPath string, handle Handle) {
 	// If no wildcard was found, simply insert the path and handle
 	n.path = path
 	n.handle = handle
+	n.fullPath = fullPath
 }
 
-// Returns the handle registered with the given path (key). The values of
-// wildcards are saved to a map.
+// Reports whether the catch-all node with a static suffix would match the
+// path with an extra (without the) trailing slash.
+func (n *node) suffixTSR(path string, foldCase bool) bool {
+	if l := len(path); l > 0 && path[l-1] == '/' {
+		end := l - 1 - len(n.suffix)
+		return end > 0 && equalPath(path[end:l-1], n.suffix, foldCase)
+	}
+	if l := len(n.suffix); n.suffix[l-1] == '/' {
+		end := len(path) - (l - 1)
+		return end > 0 && equalPath(path[end:], n.suffix[:l-1], foldCase)
+	}
+	return false
+}
+
+// Returns a deep copy of the subtree.
+func (n *node) clone() *node {
+	c := *n
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	return &c
+}
+
+// Calls fn for each handle in the subtree, with the path its route was
+// registered with.
+func (n *node) walk(fn func(path string, handle Handle)) {
+	if n.handle != nil {
+		fn(n.fullPath, n.handle)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+// Returns the handle registered with the given path (key) and the registered
+// path of its route. The values of wildcards are saved to a map.
 // If no handle can be found, a TSR (trailing slash redirect) recommendation is
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
-func (n *node) getValue(path string, params func() *Params) (handle Handle, ps *Params, tsr bool) {
+// If foldCase is true, static path elements are compared case-insensitively
+// (ASCII only). The static path elements of the tree must be lowercase then.
+func (n *node) getValue(path string, params func() *Params, foldCase bool) (handle Handle, ps *Params, tsr bool, fullPath string) {
+	// Whether the node the current one was reached from has a handle, i.e.
+	// whether a handle exists for the path without the remaining trailing
+	// slash
+	parentHandle := false
+
 walk: // Outer loop for walking the tree
 	for {
 		prefix := n.path
 		if len(path) > len(prefix) {
-			if path[:len(prefix)] == prefix {
+			if equalPath(path[:len(prefix)], prefix, foldCase) {
 				path = path[len(prefix):]
 
 				// If this node does not have a wildcard (param or catchAll)
@@ -336,8 +636,12 @@ walk: // Outer loop for walking the tree
 				// to walk down the tree
 				if !n.wildChild {
 					idxc := path[0]
+					if foldCase {
+						idxc = toLowerASCII(idxc)
+					}
 					for i, c := range []byte(n.indices) {
 						if c == idxc {
+							parentHandle = n.handle != nil
 							n = n.children[i]
 							prefix = n.path
 							continue walk
@@ -362,6 +666,15 @@ walk: // Outer loop for walking the tree
 						end++
 					}
 
+					// The value must satisfy the constraint, if any
+					key := n.path[1:]
+					if n.constraint != nil {
+						if !n.constraint.MatchString(path[:end]) {
+							return
+						}
+						key = key[:strings.IndexByte(key, '(')]
+					}
+
 					// Save param value
 					if params != nil {
 						if ps == nil {
@@ -371,7 +684,7 @@ walk: // Outer loop for walking the tree
 						i := len(*ps)
 						*ps = (*ps)[:i+1]
 						(*ps)[i] = Param{
-							Key:   n.path[1:],
+							Key:   key,
 							Value: path[:end],
 						}
 					}
@@ -380,17 +693,20 @@ walk: // Outer loop for walking the tree
 					if end < len(path) {
 						if len(n.children) > 0 {
 							path = path[end:]
+							parentHandle = n.handle != nil
 							n = n.children[0]
 							prefix = n.path
 							continue walk
 						}
 
-						// ... but we can't
-						tsr = (len(path) == end+1)
+						// ... but we can't. The value must not be empty, since
+						// an empty value at the end of the path does not match.
+						tsr = end > 0 && len(path) == end+1
 						return
 					}
 
 					if handle = n.handle; handle != nil {
+						fullPath = n.fullPath
 						return
 					} else if len(n.children) == 1 {
 						// No handle found. Check if a handle for this path + a
@@ -402,7 +718,27 @@ walk: // Outer loop for walking the tree
 					return
 
 				case catchAll:
-					// Save param value
+					// The static suffix, if any, must match the path end
+					if n.suffix != "" {
+						end := len(path) - len(n.suffix)
+						if end < 1 || !equalPath(path[end:], n.suffix, foldCase) {
+							tsr = n.suffixTSR(path, foldCase)
+							return
+						}
+						path = path[:end]
+					}
+
+					// The value must satisfy the constraint, if any
+					key := n.path[2:]
+					if n.constraint != nil {
+						if !n.constraint.MatchString(path) {
+							return
+						}
+						key = key[:strings.IndexByte(key, '(')]
+					}
+
+					// Save param value. It is a substring of the request
+					// path, which is never copied regardless of its length.
 					if params != nil {
 						if ps == nil {
 							ps = params()
@@ -411,29 +747,31 @@ walk: // Outer loop for walking the tree
 						i := len(*ps)
 						*ps = (*ps)[:i+1]
 						(*ps)[i] = Param{
-							Key:   n.path[2:],
+							Key:   key,
 							Value: path,
 						}
 					}
 
 					handle = n.handle
+					fullPath = n.fullPath
 					return
 
 				default:
 					panic("invalid node type")
 				}
 			}
-		} else if path == prefix {
+		} else if equalPath(path, prefix, foldCase) {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
 			if handle = n.handle; handle != nil {
+				fullPath = n.fullPath
 				return
 			}
 
 			// If there is no handle for this route, but this route has a
 			// wildcard child, there must be a handle for this path with an
 			// additional trailing slash
-			if path == "/" && n.wildChild && n.nType != root {
+			if path == "/" && n.wildChild && n.nType != root && parentHandle {
 				tsr = true
 				return
 			}
@@ -453,9 +791,9 @@ walk: // Outer loop for walking the tree
 
 		// Nothing found. We can recommend to redirect to the same URL with an
 		// extra trailing slash if a leaf exists for that path
-		tsr = (path == "/") ||
+		tsr = (path == "/" && parentHandle) ||
 			(len(prefix) == len(path)+1 && prefix[len(path)] == '/' &&
-				path == prefix[:len(prefix)-1] && n.handle != nil)
+				equalPath(path, prefix[:len(prefix)-1], foldCase) && n.handle != nil)
 		return
 	}
 }
@@ -470,11 +808,56 @@ func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (fixe
 		make([]byte, 0, len(path)+1), // Preallocate enough memory for new path
 		[4]byte{},                    // Empty rune buffer
 		fixTrailingSlash,
+		false,
 	)
 	return string(ciPath), ciPath != nil
 }
 
 // Shift bytes in array by n bytes left
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+// Reports whether the path element equals the lowercase static path element
+// of a node, ignoring the case of ASCII letters in path if foldCase is true.
+func equalPath(path, static string, foldCase bool) bool {
+	if path == static {
+		return true
+	}
+	if !foldCase || len(path) != len(static) {
+		return false
+	}
+	for i := 0; i < len(path); i++ {
+		if toLowerASCII(path[i]) != static[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the path with all ASCII letters lowercased, except within wildcards.
+func lowerStatic(path string) string {
+	buf := []byte(path)
+	for i := 0; i < len(path); {
+		wildcard, j, _ := findWildcard(path[i:])
+		end := len(path)
+		if j >= 0 {
+			end = i + j
+		}
+		for ; i < end; i++ {
+			buf[i] = toLowerASCII(buf[i])
+		}
+		if j < 0 {
+			break
+		}
+		i += len(wildcard)
+	}
+	return string(buf)
+}
+
 func shiftNRuneBytes(rb [4]byte, n int) [4]byte {
 	switch n {
 	case 0:
@@ -491,7 +874,9 @@ func shiftNRuneBytes(rb [4]byte, n int) [4]byte {
 }
 
 // Recursive case-insensitive lookup function used by n.findCaseInsensitivePath
-func (n *node) findCaseInsensitivePathRec(path string, ciPath []byte, rb [4]byte, fixTrailingSlash bool) []byte {
+// parentHandle reports whether the node n was reached from holds a handle,
+// i.e. whether the path without the remaining trailing slash has a handle.
+func (n *node) findCaseInsensitivePathRec(path string, ciPath []byte, rb [4]byte, fixTrailingSlash, parentHandle bool) []byte {
 	npLen := len(n.path)
 
 walk: // Outer loop for walking the tree
@@ -515,6 +900,7 @@ walk: // Outer loop for walking the tree
 					for i, c := range []byte(n.indices) {
 						if c == idxc {
 							// continue with child node
+							parentHandle = n.handle != nil
 							n = n.children[i]
 							npLen = len(n.path)
 							continue walk
@@ -551,7 +937,7 @@ walk: // Outer loop for walking the tree
 							// uppercase byte and the lowercase byte might exist
 							// as an index
 							if out := n.children[i].findCaseInsensitivePathRec(
-								path, ciPath, rb, fixTrailingSlash,
+								path, ciPath, rb, fixTrailingSlash, n.handle != nil,
 							); out != nil {
 								return out
 							}
@@ -570,6 +956,7 @@ walk: // Outer loop for walking the tree
 							// Uppercase matches
 							if c == idxc {
 								// Continue with child node
+								parentHandle = n.handle != nil
 								n = n.children[i]
 								npLen = len(n.path)
 								continue walk
@@ -595,6 +982,10 @@ walk: // Outer loop for walking the tree
 					end++
 				}
 
+				if n.constraint != nil && !n.constraint.MatchString(path[:end]) {
+					return nil
+				}
+
 				// Add param value to case insensitive path
 				ciPath = append(ciPath, path[:end]...)
 
@@ -602,6 +993,7 @@ walk: // Outer loop for walking the tree
 				if end < len(path) {
 					if len(n.children) > 0 {
 						// Continue with child node
+						parentHandle = n.handle != nil
 						n = n.children[0]
 						npLen = len(n.path)
 						path = path[end:]
@@ -628,7 +1020,17 @@ walk: // Outer loop for walking the tree
 				return nil
 
 			case catchAll:
-				return append(ciPath, path...)
+				if n.suffix != "" {
+					end := len(path) - len(n.suffix)
+					if end < 1 || !strings.EqualFold(path[end:], n.suffix) {
+						return nil
+					}
+					path = path[:end]
+				}
+				if n.constraint != nil && !n.constraint.MatchString(path) {
+					return nil
+				}
+				return append(append(ciPath, path...), n.suffix...)
 
 			default:
 				panic("invalid node type")
@@ -661,7 +1063,7 @@ walk: // Outer loop for walking the tree
 	// Nothing found.
 	// Try to fix the path by adding / removing a trailing slash
 	if fixTrailingSlash {
-		if path == "/" {
+		if path == "/" && parentHandle {
 			return ciPath
 		}
 		if len(path)+1 == npLen && n.path[len(path)] == '/' &&
@@ -46,7 +46,7 @@ func getParams() *Params {
 
 func checkRequests(t *testing.T, tree *node, requests testRequests) {
 	for _, request := range requests {
-		handler, psp, _ := tree.getValue(request.path, getParams)
+		handler, psp, _, fullPath := tree.getValue(request.path, getParams, false)
 
 		if handler == nil {
 			if !request.nilHandler {
@@ -59,6 +59,9 @@ func checkRequests(t *testing.T, tree *node, requests testRequests) {
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
 			}
+			if fullPath != request.route {
+				t.Errorf("full path mismatch for route '%s': Wrong full path (%s != %s)", request.path, fullPath, request.route)
+			}
 		}
 
 		var ps Params
@@ -99,6 +102,9 @@ func TestCountParams(t *testing.T) {
 	if countParams(strings.Repeat("/:param", 256)) != 256 {
 		t.Fail()
 	}
+	if countParams("/path/:param1(\\d*)/static/*catch-all(.*:.*)") != 2 {
+		t.Fail()
+	}
 }
 
 func TestTreeAddAndGet(t *testing.T) {
@@ -185,6 +191,105 @@ func TestTreeWildcard(t *testing.T) {
 	checkPriorities(t, tree)
 }
 
+func TestTreeWildcardConstraint(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/user/:id(\\d+)",
+		"/user/:id(\\d+)/posts/:slug([a-z-]+)",
+		"/hex/:color([0-9a-f]{6}|[0-9a-f]{3})",
+		"/paren/:x((a|b)[)])",
+		"/code/:lang(go|rust)/*file(/.*\\.(go|rs))",
+		"/static/*filepath",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/user/42", false, "/user/:id(\\d+)", Params{Param{"id", "42"}}},
+		{"/user/abc", true, "", nil},
+		{"/user/", true, "", nil},
+		{"/user/42/posts/hello-world", false, "/user/:id(\\d+)/posts/:slug([a-z-]+)", Params{Param{"id", "42"}, Param{"slug", "hello-world"}}},
+		{"/user/42/posts/Hello", true, "", Params{Param{"id", "42"}}},
+		{"/hex/fff", false, "/hex/:color([0-9a-f]{6}|[0-9a-f]{3})", Params{Param{"color", "fff"}}},
+		{"/hex/00ff00", false, "/hex/:color([0-9a-f]{6}|[0-9a-f]{3})", Params{Param{"color", "00ff00"}}},
+		{"/hex/0000", true, "", nil},
+		{"/paren/a)", false, "/paren/:x((a|b)[)])", Params{Param{"x", "a)"}}},
+		{"/code/go/main.go", false, "/code/:lang(go|rust)/*file(/.*\\.(go|rs))", Params{Param{"lang", "go"}, Param{"file", "/main.go"}}},
+		{"/code/rust/src/lib.rs", false, "/code/:lang(go|rust)/*file(/.*\\.(go|rs))", Params{Param{"lang", "rust"}, Param{"file", "/src/lib.rs"}}},
+		{"/code/go/README.md", true, "", Params{Param{"lang", "go"}}},
+		{"/code/c/main.c", true, "", nil},
+		{"/static/app.js", false, "/static/*filepath", Params{Param{"filepath", "/app.js"}}},
+	})
+
+	checkPriorities(t, tree)
+
+	// Case-insensitive lookups must respect constraints, too
+	if out, found := tree.findCaseInsensitivePath("/USER/42", true); !found || out != "/user/42" {
+		t.Errorf("Wrong result for '/USER/42': got %s, %t", out, found)
+	}
+	if out, found := tree.findCaseInsensitivePath("/USER/abc", true); found {
+		t.Errorf("Found constraint violating path '/USER/abc': got %s", out)
+	}
+	if out, found := tree.findCaseInsensitivePath("/CODE/go/README.md", true); found {
+		t.Errorf("Found constraint violating path '/CODE/go/README.md': got %s", out)
+	}
+}
+
+func TestTreeWildcardConstraintConflict(t *testing.T) {
+	routes := []testRoute{
+		{"/user/:id(\\d+)", false},
+		{"/user/:id(\\d+)/x", false},
+		{"/user/:id([a-z]+)", true},
+		{"/user/:id", true},
+		{"/user/:uid(\\d+)", true},
+		{"/item/:id", false},
+		{"/item/:id(\\d+)", true},
+		{"/src/*filepath(/.*)", false},
+		{"/src/*filepath", true},
+		{"/src/*filepath(/.*)", true},
+	}
+	testRoutes(t, routes)
+
+	tree := &node{}
+	tree.addRoute("/user/:id(\\d+)", nil)
+	recv := catchPanic(func() {
+		tree.addRoute("/user/:id([a-z]+)", nil)
+	})
+	const panicMsg = "constraint '([a-z]+)' of wildcard ':id' in new path '/user/:id([a-z]+)' conflicts with existing constraint '(\\d+)'"
+	if rs, ok := recv.(string); !ok || !strings.HasPrefix(rs, panicMsg) {
+		t.Fatalf("Expected panic '%s', got '%v'", panicMsg, recv)
+	}
+}
+
+func TestTreeInvalidWildcardConstraint(t *testing.T) {
+	routes := [...]string{
+		"/user/:id()",
+		"/user/:id(\\d+",
+		"/user/:id([)",
+		"/user/:id(\\d+)x",
+		"/user/:(\\d+)",
+		"/src/*(.*)",
+	}
+	for _, route := range routes {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+		if recv == nil {
+			t.Errorf("no panic while inserting route with invalid constraint '%s'", route)
+		}
+	}
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -315,15 +420,69 @@ func TestEmptyWildcardName(t *testing.T) {
 
 func TestTreeCatchAllConflict(t *testing.T) {
 	routes := []testRoute{
-		{"/src/*filepath/x", true},
+		{"/src/*filepath/x", false},
+		{"/src/*filepath/y", true},
+		{"/src/*filepath", true},
 		{"/src2/", false},
 		{"/src2/*filepath/x", true},
 		{"/src3/*filepath", false},
 		{"/src3/*filepath/x", true},
+		{"/src4/*filepath/:x", true},
+		{"/src5/*filepath/x/*y", true},
 	}
 	testRoutes(t, routes)
 }
 
+func TestTreeCatchAllSuffix(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/proxy/*target/info",
+		"/raw/*path(/[a-z/]+)/log/",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/proxy/a/info", false, "/proxy/*target/info", Params{Param{"target", "/a"}}},
+		{"/proxy/a/b/info", false, "/proxy/*target/info", Params{Param{"target", "/a/b"}}},
+		{"/proxy/a/info/info", false, "/proxy/*target/info", Params{Param{"target", "/a/info"}}},
+		{"/proxy//info", false, "/proxy/*target/info", Params{Param{"target", "/"}}},
+		{"/proxy/info", true, "", nil},
+		{"/proxy/a/inf", true, "", nil},
+		{"/proxy/a", true, "", nil},
+		{"/raw/a/b/log/", false, "/raw/*path(/[a-z/]+)/log/", Params{Param{"path", "/a/b"}}},
+		{"/raw/A/log/", true, "", nil},
+	})
+
+	// Trailing slash recommendations
+	tsrRoutes := [...]struct {
+		path string
+		tsr  bool
+	}{
+		{"/proxy/a/info/", true},
+		{"/proxy/info/", false},
+		{"/raw/a/log", true},
+		{"/raw/log", false},
+	}
+	for _, route := range tsrRoutes {
+		handler, _, tsr, _ := tree.getValue(route.path, nil, false)
+		if handler != nil {
+			t.Errorf("handle mismatch for route '%s': Expected nil handle", route.path)
+		}
+		if tsr != route.tsr {
+			t.Errorf("expected TSR recommendation %v for route '%s'", route.tsr, route.path)
+		}
+	}
+
+	// Case-insensitive lookup
+	out, found := tree.findCaseInsensitivePath("/PROXY/A/INFO", false)
+	if !found || string(out) != "/proxy/A/info" {
+		t.Errorf("findCaseInsensitivePath: got %q, %v", out, found)
+	}
+}
+
 func TestTreeCatchAllConflictRoot(t *testing.T) {
 	routes := []testRoute{
 		{"/", false},
@@ -359,16 +518,31 @@ func TestTreeDoubleWildcard(t *testing.T) {
 	}
 }
 
-/*func TestTreeDuplicateWildcard(t *testing.T) {
-	tree := &node{}
-
+func TestTreeDuplicateWildcard(t *testing.T) {
 	routes := [...]string{
 		"/:id/:name/:id",
+		"/a/:id/b/:id",
+		"/a/:id(\\d+)/b/:id",
+		"/src/:filepath/*filepath",
+		"/c/:foo/*foo/suffix",
 	}
 	for _, route := range routes {
-		...
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+		if rs, ok := recv.(string); !ok || !strings.Contains(rs, "is used more than once") {
+			t.Errorf("Expected panic for duplicate wildcard name in route '%s', got '%v'", route, recv)
+		}
 	}
-}*/
+
+	// Names which only share a prefix are distinct
+	tree := &node{}
+	tree.addRoute("/:id/:ident/*i", fakeHandler("/:id/:ident/*i"))
+	checkRequests(t, tree, testRequests{
+		{"/1/2/3", false, "/:id/:ident/*i", Params{{"id", "1"}, {"ident", "2"}, {"i", "/3"}}},
+	})
+}
 
 func TestTreeTrailingSlashRedirect(t *testing.T) {
 	tree := &node{}
@@ -427,7 +601,7 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 		"/doc/",
 	}
 	for _, route := range tsrRoutes {
-		handler, _, tsr := tree.getValue(route, nil)
+		handler, _, tsr, _ := tree.getValue(route, nil, false)
 		if handler != nil {
 			t.Fatalf("non-nil handler for TSR route '%s", route)
 		} else if !tsr {
@@ -444,7 +618,7 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 		"/api/world/abc",
 	}
 	for _, route := range noTsrRoutes {
-		handler, _, tsr := tree.getValue(route, nil)
+		handler, _, tsr, _ := tree.getValue(route, nil, false)
 		if handler != nil {
 			t.Fatalf("non-nil handler for No-TSR route '%s", route)
 		} else if tsr {
@@ -463,7 +637,7 @@ func TestTreeRootTrailingSlashRedirect(t *testing.T) {
 		t.Fatalf("panic inserting test route: %v", recv)
 	}
 
-	handler, _, tsr := tree.getValue("/", nil)
+	handler, _, tsr, _ := tree.getValue("/", nil, false)
 	if handler != nil {
 		t.Fatalf("non-nil handler")
 	} else if tsr {
@@ -638,7 +812,7 @@ func TestTreeInvalidNodeType(t *testing.T) {
 
 	// normal lookup
 	recv := catchPanic(func() {
-		tree.getValue("/test", nil)
+		tree.getValue("/test", nil, false)
 	})
 	if rs, ok := recv.(string); !ok || rs != panicMsg {
 		t.Fatalf("Expected panic '"+panicMsg+"', got '%v'", recv)
@@ -653,6 +827,59 @@ func TestTreeInvalidNodeType(t *testing.T) {
 	}
 }
 
+func TestTreeStaticWildcardOverlap(t *testing.T) {
+	overlaps := [][2]string{
+		{"/users/new", "/users/:id"},
+		{"/users/:id", "/users/new"},
+		{"/files/*filepath", "/files/new"},
+		{"/users/:id", "/users/:name"},
+	}
+	for i, overlap := range overlaps {
+		tree := &node{}
+		tree.addRoute(overlap[0], fakeHandler(overlap[0]))
+		recv := catchPanic(func() {
+			tree.addRoute(overlap[1], fakeHandler(overlap[1]))
+		})
+		if recv == nil {
+			t.Fatalf("no panic while inserting %s after %s", overlap[1], overlap[0])
+		}
+		// Two wildcards with different names are not a static overlap
+		hint := strings.HasSuffix(fmt.Sprint(recv), overlapHint)
+		if want := i < len(overlaps)-1; hint != want {
+			t.Errorf("inserting %s after %s: hint %v, want %v (%v)", overlap[1], overlap[0], hint, want, recv)
+		}
+	}
+}
+
+func TestTreeConflictExistingRoute(t *testing.T) {
+	conflicts := []struct {
+		routes   []string
+		route    string
+		existing string
+	}{
+		{[]string{"/users/new", "/users/new/edit"}, "/users/:id", "/users/new"},
+		{[]string{"/users/new/edit"}, "/users/:id", "/users/new/edit"},
+		{[]string{"/users/:id/posts"}, "/users/new", "/users/:id/posts"},
+		{[]string{"/users/:id", "/users/:id/posts"}, "/users/:name/", "/users/:id"},
+		{[]string{"/users/:id(\\d+)/posts"}, "/users/:id(\\w+)", "/users/:id(\\d+)/posts"},
+		{[]string{"/src/*filepath"}, "/src/:name", "/src/*filepath"},
+		{[]string{"/src/"}, "/src/*filepath", "/src/"},
+	}
+	for _, conflict := range conflicts {
+		tree := &node{}
+		for _, route := range conflict.routes {
+			tree.addRoute(route, fakeHandler(route))
+		}
+		recv := fmt.Sprint(catchPanic(func() {
+			tree.addRoute(conflict.route, fakeHandler(conflict.route))
+		}))
+		if !strings.Contains(recv, "path '"+conflict.route+"'") ||
+			!strings.Contains(recv, "existing route '"+conflict.existing+"'") {
+			t.Errorf("inserting %s: message does not name both routes: %s", conflict.route, recv)
+		}
+	}
+}
+
 func TestTreeWildcardConflictEx(t *testing.T) {
 	conflicts := [...]struct {
 		route        string
@@ -691,3 +918,47 @@ func TestTreeWildcardConflictEx(t *testing.T) {
 		}
 	}
 }
+
+func TestLowerStatic(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"/Users/Bob", "/users/bob"},
+		{"/Users/:Name", "/users/:Name"},
+		{"/Users/:Name/Posts/*File", "/users/:Name/posts/*File"},
+		{"/Src/:ID(\\d+[A-Z])/Raw", "/src/:ID(\\d+[A-Z])/raw"},
+		{"/ÄÖ/X", "/ÄÖ/x"},
+	}
+	for _, test := range tests {
+		if got := lowerStatic(test.path); got != test.want {
+			t.Errorf("lowerStatic(%q): got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestSplitOptional(t *testing.T) {
+	tests := []struct {
+		path  string
+		full  string
+		short string
+		key   string
+	}{
+		{"/files/:name?", "/files/:name", "/files", "name"},
+		{"/:name?", "/:name", "/", "name"},
+		{"/files/v:version?", "/files/v:version", "/files/v", "version"},
+		{"/user/:id(\\d?)?", "/user/:id(\\d?)", "/user", "id"},
+		{"/files/:name", "/files/:name", "", ""},
+		{"/files/:name(a?)", "/files/:name(a?)", "", ""},
+		{"/files?", "/files?", "", ""},
+		{"/src/*filepath?", "/src/*filepath?", "", ""},
+	}
+	for _, test := range tests {
+		full, short, key := splitOptional(test.path)
+		if full != test.full || short != test.short || key != test.key {
+			t.Errorf("splitOptional(%q): got (%q, %q, %q), want (%q, %q, %q)",
+				test.path, full, short, key, test.full, test.short, test.key)
+		}
+	}
+}
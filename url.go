@@ -0,0 +1,175 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import "errors"
+
+// A route registered with HandleNamed.
+type namedRoute struct {
+	method, path string
+}
+
+// HandleNamed registers a new request handle with the given path and method,
+// just like Handle, and additionally assigns the given name to the route.
+// The name can then be used to build URLs for the route with Router.URL.
+// An error is returned if the name is empty or is already assigned to another
+// route, or if the route can not be registered, see TryHandle. In both cases
+// neither the route nor the name is registered.
+func (r *Router) HandleNamed(method, path, name string, handle Handle) error {
+	if name == "" {
+		return errors.New("route name must not be empty in path '" + path + "'")
+	}
+	if existing, ok := r.loadTrees().names[name]; ok {
+		return errors.New("route name '" + name + "' for path '" + path +
+			"' is already used by path '" + existing.path + "'")
+	}
+
+	if err := r.TryHandle(method, path, handle); err != nil {
+		return err
+	}
+
+	t := r.writableTrees()
+	if t.names == nil {
+		t.names = make(map[string]namedRoute)
+	}
+	t.names[name] = namedRoute{method: method, path: path}
+	return nil
+}
+
+// HandleNamed registers a new named request handle with the given method and
+// the path prefixed by the group prefix. See Router.HandleNamed.
+func (g *Group) HandleNamed(method, path, name string, handle Handle) error {
+	if len(path) < 1 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+	return g.r.HandleNamed(method, g.prefix+path, name, g.wrap(handle))
+}
+
+// URL builds the path of the route with the given name, as registered with
+// HandleNamed. The parameter values are given as key-value pairs:
+//
+//	router.HandleNamed("GET", "/users/:id/posts/:pid", "user.post", handle)
+//	url, err := router.URL("user.post", "id", "42", "pid", "7")
+//	// url == "/users/42/posts/7"
+//
+// Values of named parameters are percent-encoded, values of catch-all
+// parameters are inserted as they are, including the leading '/'.
+// Constraints of parameters are not checked. If no value is given for an
+// optional parameter, the path without it is built, e.g. /files for the route
+// /files/:name?.
+// An error is returned if the name is unknown, a value for a parameter of the
+// route is missing or a value for a parameter the route does not have is
+// given.
+func (r *Router) URL(name string, pairs ...string) (string, error) {
+	route, ok := r.loadTrees().names[name]
+	if !ok {
+		return "", errors.New("unknown route name '" + name + "'")
+	}
+	if len(pairs)%2 != 0 {
+		return "", errors.New("odd number of parameter key-value pairs for route '" + name + "'")
+	}
+
+	// Without a value for the optional parameter, its segment is left out
+	path, short, optional := splitOptional(route.path)
+	if optional != "" && !hasKey(pairs, optional) {
+		path = short
+	}
+
+	for j := 0; j < len(pairs); j += 2 {
+		if !routeHasParam(path, pairs[j]) {
+			return "", errors.New("unknown parameter '" + pairs[j] + "' for route '" + name + "'")
+		}
+	}
+
+	var url []byte
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			break
+		}
+		wildcardName, _ := splitConstraint(wildcard)
+		key := wildcardName[1:]
+
+		value, found := "", false
+		for j := 0; j < len(pairs); j += 2 {
+			if pairs[j] == key {
+				if found {
+					return "", errors.New("duplicate value for parameter '" + key + "' of route '" + name + "'")
+				}
+				value, found = pairs[j+1], true
+			}
+		}
+		if !found {
+			return "", errors.New("missing value for parameter '" + key + "' of route '" + name + "'")
+		}
+
+		if wildcard[0] == ':' {
+			url = append(url, path[:i]...)
+			url = appendEscapedSegment(url, value)
+		} else {
+			// Catch-all values begin with the '/' in front of the wildcard
+			url = append(url, path[:i-1]...)
+			if len(value) == 0 || value[0] != '/' {
+				url = append(url, '/')
+			}
+			url = append(url, value...)
+		}
+		path = path[i+len(wildcard):]
+	}
+
+	return string(append(url, path...)), nil
+}
+
+// Reports whether the key-value pairs contain the given key.
+func hasKey(pairs []string, key string) bool {
+	for j := 0; j < len(pairs); j += 2 {
+		if pairs[j] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the route path has a parameter with the given key.
+func routeHasParam(path, key string) bool {
+	for {
+		wildcard, i, _ := findWildcard(path)
+		if i < 0 {
+			return false
+		}
+		if wildcardName, _ := splitConstraint(wildcard); wildcardName[1:] == key {
+			return true
+		}
+		path = path[i+len(wildcard):]
+	}
+}
+
+// Appends s to buf, percent-encoding all characters which are not allowed
+// within a path segment (pchar, see RFC 3986, section 3.3).
+func appendEscapedSegment(buf []byte, s string) []byte {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; isPathSegmentChar(c) {
+			buf = append(buf, c)
+		} else {
+			buf = append(buf, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return buf
+}
+
+func isPathSegmentChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	switch c {
+	case '-', '.', '_', '~', // unreserved
+		'!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=', // sub-delims
+		':', '@':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterURL(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	routes := []struct {
+		path string
+		name string
+	}{
+		{"/", "index"},
+		{"/users/:id/posts/:pid", "user.post"},
+		{"/user/:id(\\d+)", "user"},
+		{"/src/*filepath", "src"},
+		{"/files/:dir/*filepath", "files"},
+		{"/docs/:page?", "docs"},
+		{"/v/:id(\\d+)?", "version"},
+	}
+	for _, route := range routes {
+		if err := router.HandleNamed(http.MethodGet, route.path, route.name, handle); err != nil {
+			t.Fatalf("registering route %s failed: %v", route.name, err)
+		}
+	}
+	if err := router.Group("/api").HandleNamed(http.MethodGet, "/status", "api.status", handle); err != nil {
+		t.Fatalf("registering group route failed: %v", err)
+	}
+	if err := router.HandleNamed(http.MethodPost, "/:lang?", "home", handle); err != nil {
+		t.Fatalf("registering route home failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		pairs []string
+		url   string
+	}{
+		{"index", nil, "/"},
+		{"user.post", []string{"id", "42", "pid", "7"}, "/users/42/posts/7"},
+		{"user.post", []string{"pid", "7", "id", "42"}, "/users/42/posts/7"},
+		{"user.post", []string{"id", "a/b c", "pid", "?#%"}, "/users/a%2Fb%20c/posts/%3F%23%25"},
+		{"user.post", []string{"id", "ünì", "pid", "a:b@c+d"}, "/users/%C3%BCn%C3%AC/posts/a:b@c+d"},
+		{"user", []string{"id", "42"}, "/user/42"},
+		{"src", []string{"filepath", "/some/file.png"}, "/src/some/file.png"},
+		{"src", []string{"filepath", "some/file.png"}, "/src/some/file.png"},
+		{"src", []string{"filepath", "/"}, "/src/"},
+		{"files", []string{"dir", "js", "filepath", "/inc/framework.js"}, "/files/js/inc/framework.js"},
+		{"api.status", nil, "/api/status"},
+		{"docs", []string{"page", "intro"}, "/docs/intro"},
+		{"docs", nil, "/docs"},
+		{"version", []string{"id", "2"}, "/v/2"},
+		{"version", nil, "/v"},
+		{"home", []string{"lang", "de"}, "/de"},
+		{"home", nil, "/"},
+	}
+	for _, test := range tests {
+		url, err := router.URL(test.name, test.pairs...)
+		if err != nil {
+			t.Errorf("URL(%q, %q) failed: %v", test.name, test.pairs, err)
+		} else if url != test.url {
+			t.Errorf("URL(%q, %q) = %q, want %q", test.name, test.pairs, url, test.url)
+		}
+	}
+
+	errTests := []struct {
+		name  string
+		pairs []string
+	}{
+		{"nope", nil},
+		{"user.post", []string{"id", "42"}},
+		{"user.post", []string{"id", "42", "pid"}},
+		{"user.post", []string{"id", "42", "pid", "7", "x", "y"}},
+		{"user.post", []string{"id", "42", "pid", "7", "id", "43"}},
+		{"index", []string{"id", "42"}},
+		{"docs", []string{"page?", "intro"}},
+		{"docs", []string{"id", "42"}},
+	}
+	for _, test := range errTests {
+		if url, err := router.URL(test.name, test.pairs...); err == nil {
+			t.Errorf("URL(%q, %q) = %q, want error", test.name, test.pairs, url)
+		}
+	}
+}
+
+func TestRouterHandleNamedErrors(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	if err := router.HandleNamed(http.MethodGet, "/a", "", handle); err == nil {
+		t.Error("registering route with empty name did not fail")
+	}
+	if err := router.HandleNamed(http.MethodGet, "/a", "a", handle); err != nil {
+		t.Fatalf("registering route failed: %v", err)
+	}
+	if err := router.HandleNamed(http.MethodPost, "/b", "a", handle); err == nil {
+		t.Error("registering duplicate route name did not fail")
+	}
+	if handle, _, _ := router.Lookup(http.MethodPost, "/b"); handle != nil {
+		t.Error("route with duplicate name was registered")
+	}
+	if url, _ := router.URL("a"); url != "/a" {
+		t.Errorf("duplicate name replaced existing route: got %q", url)
+	}
+
+	// Route conflicts are returned instead of panicking
+	var err error
+	if recv := catchPanic(func() {
+		err = router.HandleNamed(http.MethodGet, "/a", "other", handle)
+	}); recv != nil {
+		t.Fatalf("registering conflicting route panicked: %v", recv)
+	}
+	if _, ok := err.(*RouteConflictError); !ok {
+		t.Errorf("registering conflicting route: got %v, want a *RouteConflictError", err)
+	}
+	if _, err := router.URL("other"); err == nil {
+		t.Error("name of the conflicting route was registered")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Validate checks the structure of the trees of the router and returns an
+// error for each problem found, e.g. nodes which can never be reached or
+// routes which are stored inconsistently. The errors are of type
+// *RouteConflictError and contain the method and the path of the affected
+// part of the tree. The trees are not modified.
+// Since conflicting routes are already rejected on registration, Validate
+// returns no errors for trees built with Handle and TryHandle. It is meant to
+// be used in tests, to make sure a route table is sound before it is deployed.
+func (r *Router) Validate() []error {
+	trees := r.loadTrees().trees
+	methods := make([]string, 0, len(trees))
+	for method := range trees {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	var errs []error
+	for _, method := range methods {
+		errs, _ = trees[method].validate(method, "", errs)
+	}
+	return errs
+}
+
+// Checks the subtree and appends the problems found to errs. Returns the
+// number of handles in the subtree.
+func (n *node) validate(method, prefix string, errs []error) ([]error, uint32) {
+	path := prefix + n.path + n.suffix
+	report := func(msg string) {
+		errs = append(errs, &RouteConflictError{Method: method, Path: path, Msg: msg + " in path '" + path + "'"})
+	}
+
+	switch {
+	case n.wildChild:
+		if len(n.children) != 1 || (n.children[0].nType != param && n.children[0].nType != catchAll) {
+			report("node with wildcard child must have exactly one wildcard child")
+		} else if n.indices != "" {
+			report("node with wildcard child must not have indices")
+		}
+	case n.nType == param || n.nType == catchAll:
+		if n.nType == param && (len(n.path) < 2 || n.path[0] != ':') ||
+			n.nType == catchAll && (len(n.path) < 3 || n.path[:2] != "/*") {
+			report("invalid wildcard node")
+		} else if len(n.children) > 1 || (n.nType == catchAll && len(n.children) > 0) {
+			report("wildcard node has too many children")
+		} else if len(n.children) == 1 && (len(n.children[0].path) == 0 || n.children[0].path[0] != '/') {
+			report("child of wildcard node must begin with '/'")
+		}
+	default:
+		if len(n.indices) != len(n.children) {
+			report("number of indices " + strconv.Itoa(len(n.indices)) +
+				" does not match number of children " + strconv.Itoa(len(n.children)))
+			break
+		}
+		for i, child := range n.children {
+			if child.nType == catchAll {
+				// The catch-all is indexed by the '/' in front of it
+				if child.path != "" || n.indices[i] != '/' {
+					report("invalid catch-all child of static node")
+				}
+			} else if child.nType != static || child.path == "" && !child.isCatchAllIndex() {
+				report("invalid child of static node")
+			} else if child.path == "" {
+				// Created when a catch-all is added below an existing route
+				if n.indices[i] != '/' {
+					report("index '" + n.indices[i:i+1] + "' does not match catch-all child")
+				}
+			} else if child.path[0] != n.indices[i] {
+				report("index '" + n.indices[i:i+1] + "' does not match child '" + child.path + "'")
+			}
+			if i > 0 && n.children[i-1].priority < child.priority {
+				report("children are not sorted by priority")
+			}
+		}
+	}
+
+	if len(n.children) == 0 && n.handle == nil && n.nType != root {
+		report("node has neither a handle nor children")
+	}
+	// The static parts of the path are lowercased with CaseInsensitive
+	if n.handle != nil && n.fullPath != path && lowerStatic(n.fullPath) != path {
+		report("handle is registered for path '" + n.fullPath + "'")
+	}
+
+	var handles uint32
+	if n.handle != nil {
+		handles++
+	}
+	for _, child := range n.children {
+		var childHandles uint32
+		errs, childHandles = child.validate(method, path, errs)
+		handles += childHandles
+	}
+	if n.priority != handles {
+		report("priority " + strconv.FormatUint(uint64(n.priority), 10) +
+			" does not match number of handles " + strconv.FormatUint(uint64(handles), 10))
+	}
+	return errs, handles
+}
+
+// Reports whether the static node only holds the catch-all child indexed by
+// the '/' in front of it. Such nodes without path are created when a
+// catch-all is added below an existing route, e.g. /src/*filepath after /src.
+func (n *node) isCatchAllIndex() bool {
+	return n.indices == "/" && len(n.children) == 1 && n.children[0].nType == catchAll
+}
@@ -0,0 +1,126 @@
+// Copyright 2013 Julien Schmidt. All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRouterValidate(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	for _, path := range []string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/*filepath",
+		"/search/",
+		"/search/:query",
+		"/files/:name?",
+		"/proxy/*target/info",
+		"/user_:name",
+		"/user_:name/about",
+		"/info/:user/public",
+		"/info/:user/project/:project",
+	} {
+		router.GET(path, handle)
+	}
+	router.POST("/users/:id", handle)
+	if errs := router.Validate(); errs != nil {
+		t.Fatalf("valid router: got errors %v", errs)
+	}
+
+	// Rejected routes must not leave the tree in an inconsistent state
+	for _, path := range []string{
+		"/cmd/:other",
+		"/src/:file",
+		"/search/*query",
+		"/user_:other",
+		"/info/:user/project/*all",
+		"/",
+	} {
+		if err := router.TryHandle(http.MethodGet, path, handle); err == nil {
+			t.Errorf("TryHandle(%q) did not fail", path)
+		}
+	}
+	if errs := router.Validate(); errs != nil {
+		t.Fatalf("after rejected routes: got errors %v", errs)
+	}
+
+	// Corrupt the tree
+	root := router.loadTrees().trees[http.MethodGet]
+	root.priority++
+	root.fullPath = "/wrong"
+	errs := router.Validate()
+	if len(errs) != 2 {
+		t.Fatalf("corrupted tree: got %d errors %v, want 2", len(errs), errs)
+	}
+	for _, err := range errs {
+		rce, ok := err.(*RouteConflictError)
+		if !ok || rce.Method != http.MethodGet {
+			t.Errorf("unexpected error %#v", err)
+		}
+	}
+	if rce := errs[0].(*RouteConflictError); rce.Path != "/" || !strings.Contains(rce.Msg, "/wrong") {
+		t.Errorf("unexpected error for the handle: %v", rce)
+	}
+	if rce := errs[1].(*RouteConflictError); rce.Path != "/" || !strings.Contains(rce.Msg, "priority") {
+		t.Errorf("unexpected error for the priority: %v", rce)
+	}
+}
+
+func TestRouterValidateCatchAllBelowRoute(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) {}
+
+	router := New()
+	router.GET("/a/x", handle)
+	router.GET("/a/x/*rest", handle)
+	router.HandleSubtree(http.MethodGet, "/admin", handle)
+	router.HandleSubtree(http.MethodPost, "/", handle)
+	if errs := router.Validate(); errs != nil {
+		t.Fatalf("catch-all below route: got errors %v", errs)
+	}
+
+	// The node without path must only hold the catch-all
+	root := router.loadTrees().trees[http.MethodGet]
+	var n *node
+	for n = root; n.path != ""; n = n.children[0] {
+	}
+	n.children[0].nType = static
+	if errs := router.Validate(); len(errs) == 0 {
+		t.Error("corrupted catch-all index: got no errors")
+	}
+}
+
+func TestTreeUpdatePriorities(t *testing.T) {
+	tree := &node{}
+	for _, route := range []string{"/a", "/b/1", "/b/2", "/b/3", "/c/1", "/c/2"} {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	// Reset the priorities and recompute them
+	var reset func(n *node)
+	reset = func(n *node) {
+		n.priority = 0
+		for _, child := range n.children {
+			reset(child)
+		}
+	}
+	reset(tree)
+	tree.updatePriorities()
+	checkPriorities(t, tree)
+
+	if tree.indices == "" || tree.children[0].path[0] != tree.indices[0] {
+		t.Fatalf("indices out of sync: %q", tree.indices)
+	}
+	for i := 1; i < len(tree.children); i++ {
+		if tree.children[i-1].priority < tree.children[i].priority {
+			t.Errorf("children not sorted by priority: %q", tree.indices)
+		}
+	}
+}